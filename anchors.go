@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// parseLineRange parses a --lines flag: a single line ("12") or an inclusive range ("40-45")
+func parseLineRange(s string) (int, int, error) {
+	startText, endText, isRange := strings.Cut(strings.TrimSpace(s), "-")
+	start, err := strconv.Atoi(strings.TrimSpace(startText))
+	end := start
+	if err == nil && isRange {
+		end, err = strconv.Atoi(strings.TrimSpace(endText))
+	}
+	if err != nil || start <= 0 || end <= 0 {
+		return 0, 0, fmt.Errorf("invalid line range %q (expected e.g. 12 or 40-45)", s)
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("invalid line range %q: the end is before the start", s)
+	}
+	return start, end, nil
+}
+
+// anchorComment anchors a new root comment to lines of its file ("" for the whole document), optionally to a quote on
+// those lines
+func anchorComment(c *Comment, lines, quote string) error {
+	if lines == "" {
+		_, err := os.Stat(filepath.Join(c.ProjectDirectory, c.FilePath))
+		return err
+	}
+
+	lineStart, lineEnd, err := parseLineRange(lines)
+	if err != nil {
+		return err
+	}
+	selected, err := anchorSelection(c.ProjectDirectory, c.FilePath, lineStart, lineEnd, quote)
+	if err != nil {
+		return err
+	}
+	c.LineStart, c.LineEnd, c.SelectedText = &lineStart, &lineEnd, selected
+	return nil
+}
+
+// blockMarker matches what starts a Markdown heading, quote or list item
+var blockMarker = regexp.MustCompile(`^(#{1,6}\s+|>\s*|[-*+]\s+(\[[ xX]\]\s+)?|\d+[.)]\s+)+`)
+
+// inlineMarker matches emphasis and code span markers
+var inlineMarker = regexp.MustCompile("\\*\\*|__|\\*|`")
+
+// plainText strips Markdown block and inline markers from a line, leaving roughly the text a viewer shows
+func plainText(line string) string {
+	line = blockMarker.ReplaceAllString(strings.TrimSpace(line), "")
+	return strings.TrimSpace(inlineMarker.ReplaceAllString(line, ""))
+}
+
+// collapseSpace replaces runs of whitespace with single spaces so quotes can span line breaks
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// anchorSelection checks a line range against a document and returns the text to anchor a comment to. A quote must
+// appear on those lines, either as written in the source or as shown in the viewer. Without a quote, the text of the
+// first block on those lines is used, so the viewer can highlight it.
+func anchorSelection(projectDir, filePath string, lineStart, lineEnd int, quote string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(projectDir, filePath))
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if lineEnd > len(lines) {
+		return "", fmt.Errorf("lines %d-%d are outside %s, which has %d lines", lineStart, lineEnd, filePath,
+			len(lines))
+	}
+	selected := lines[lineStart-1 : lineEnd]
+
+	if quote = strings.TrimSpace(quote); quote != "" {
+		plain := make([]string, len(selected))
+		for i, line := range selected {
+			plain[i] = plainText(line)
+		}
+		wanted := collapseSpace(quote)
+		if !strings.Contains(collapseSpace(strings.Join(selected, "\n")), wanted) &&
+			!strings.Contains(collapseSpace(strings.Join(plain, "\n")), wanted) {
+			return "", fmt.Errorf("%q is not on lines %d-%d of %s", quote, lineStart, lineEnd, filePath)
+		}
+		return quote, nil
+	}
+
+	// A heading is a block of its own, and a blank line ends any other block
+	var block []string
+	for _, line := range selected {
+		if strings.TrimSpace(line) == "" {
+			if len(block) > 0 {
+				break
+			}
+			continue
+		}
+		block = append(block, plainText(line))
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			break
+		}
+	}
+	if len(block) == 0 {
+		return "", fmt.Errorf("lines %d-%d of %s are blank", lineStart, lineEnd, filePath)
+	}
+	return strings.Join(block, "\n"), nil
+}
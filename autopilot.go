@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultAutopilotSettle is how long new comments must settle when the project doesn't set settle_seconds
+	defaultAutopilotSettle = 30 * time.Second
+	// defaultAutopilotTimeout is how long a job may run when the project doesn't set timeout_minutes
+	defaultAutopilotTimeout = 30 * time.Minute
+	// maxAutopilotOutput is how much of the end of a job's output is kept
+	maxAutopilotOutput = 64 * 1024
+)
+
+// AutopilotConfig is the [autopilot] section of a project's configuration. Autopilot is off without a command.
+type AutopilotConfig struct {
+	Command        string `toml:"command"`         // Run with sh -c in the project directory, CR_FILE_PATH is the file
+	SettleSeconds  int    `toml:"settle_seconds"`  // Quiet time after a new comment before the command runs
+	TimeoutMinutes int    `toml:"timeout_minutes"` // Jobs running longer are killed
+}
+
+func (a AutopilotConfig) settle() time.Duration {
+	if a.SettleSeconds > 0 {
+		return time.Duration(a.SettleSeconds) * time.Second
+	}
+	return defaultAutopilotSettle
+}
+
+func (a AutopilotConfig) timeout() time.Duration {
+	if a.TimeoutMinutes > 0 {
+		return time.Duration(a.TimeoutMinutes) * time.Minute
+	}
+	return defaultAutopilotTimeout
+}
+
+type autopilotFile struct {
+	projectDir string
+	filePath   string
+}
+
+// autopilotScheduler runs the autopilot command of a project for files with new feedback, one job per file at a time.
+// Feedback arriving while a job runs starts another job when it's done.
+type autopilotScheduler struct {
+	mu      sync.Mutex
+	timers  map[autopilotFile]*time.Timer
+	running map[autopilotFile]bool
+	pending map[autopilotFile]bool
+}
+
+var autopilot = &autopilotScheduler{
+	timers:  make(map[autopilotFile]*time.Timer),
+	running: make(map[autopilotFile]bool),
+	pending: make(map[autopilotFile]bool),
+}
+
+// scheduleAutopilot starts the autopilot of a project for an event: right away when a review is submitted, and once
+// new comments by the reviewer have settled otherwise
+func scheduleAutopilot(projectDir, filePath, event string, data interface{}) {
+	settle := false
+	switch event {
+	case "review_submitted":
+	case "comment_added":
+		userComment, err := isUserCommentAdded(data)
+		if err != nil {
+			log.Printf("Not running autopilot: %v", err)
+			return
+		}
+		// The agent's own replies must not start it again
+		if !userComment {
+			return
+		}
+		settle = true
+	default:
+		return
+	}
+
+	config, err := loadProjectConfig(projectDir)
+	if err != nil {
+		log.Printf("Not running autopilot: %v", err)
+		return
+	}
+	if config.Autopilot.Command == "" {
+		return
+	}
+	if err := config.checkCommandsAllowed(); err != nil {
+		log.Printf("Not running autopilot: %v", err)
+		return
+	}
+	var delay time.Duration
+	if settle {
+		delay = config.Autopilot.settle()
+	}
+
+	autopilot.schedule(autopilotFile{projectDir: projectDir, filePath: filePath}, delay)
+}
+
+// schedule starts a job for a file after delay. Scheduling the file again before then restarts the wait.
+func (a *autopilotScheduler) schedule(file autopilotFile, delay time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if timer, ok := a.timers[file]; ok {
+		timer.Stop()
+	}
+	a.timers[file] = time.AfterFunc(delay, func() { a.start(file) })
+}
+
+func (a *autopilotScheduler) start(file autopilotFile) {
+	a.mu.Lock()
+	delete(a.timers, file)
+	if a.running[file] {
+		a.pending[file] = true
+		a.mu.Unlock()
+		return
+	}
+	a.running[file] = true
+	a.mu.Unlock()
+
+	go func() {
+		for {
+			runAutopilotJob(file)
+
+			a.mu.Lock()
+			if !a.pending[file] {
+				delete(a.running, file)
+				a.mu.Unlock()
+				return
+			}
+			delete(a.pending, file)
+			a.mu.Unlock()
+		}
+	}()
+}
+
+// runAutopilotJob runs the autopilot command for a file, recording the job and telling the file's viewers about it
+func runAutopilotJob(file autopilotFile) {
+	// The configuration may have changed while the job was waiting
+	config, err := loadProjectConfig(file.projectDir)
+	if err != nil {
+		log.Printf("Not running autopilot: %v", err)
+		return
+	}
+	if config.Autopilot.Command == "" {
+		return
+	}
+	if err := config.checkCommandsAllowed(); err != nil {
+		log.Printf("Not running autopilot: %v", err)
+		return
+	}
+
+	job := &AutopilotJob{
+		ProjectDirectory: file.projectDir,
+		FilePath:         file.filePath,
+		Command:          config.Autopilot.Command,
+	}
+	if err := createAutopilotJob(job); err != nil {
+		log.Printf("Failed to record autopilot job for %s: %v", file.filePath, err)
+		return
+	}
+	log.Printf("Autopilot job %d started for %s", job.ID, file.filePath)
+	sseHub.broadcast(file.projectDir, file.filePath, "autopilot_started", job)
+
+	timeout := config.Autopilot.timeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", job.Command)
+	cmd.Dir = file.projectDir
+	cmd.Env = append(os.Environ(), "CR_FILE_PATH="+file.filePath)
+	// Don't wait for background processes of the command that keep its output open
+	cmd.WaitDelay = time.Second
+
+	output, err := cmd.CombinedOutput()
+	if len(output) > maxAutopilotOutput {
+		output = append([]byte("[...]\n"), output[len(output)-maxAutopilotOutput:]...)
+	}
+
+	status := jobSucceeded
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		status = jobFailed
+		output = append(output, "\n(timed out after "+timeout.String()+")"...)
+	case err != nil:
+		status = jobFailed
+		output = append(output, "\n("+err.Error()+")"...)
+	}
+
+	if err := finishAutopilotJob(job, status, string(output)); err != nil {
+		log.Printf("Failed to record the end of autopilot job %d: %v", job.ID, err)
+	}
+	log.Printf("Autopilot job %d for %s %s", job.ID, file.filePath, status)
+
+	// The output can be large; viewers only need the status
+	finished := *job
+	finished.Output = ""
+	sseHub.broadcast(file.projectDir, file.filePath, "autopilot_finished", finished)
+}
+
+func runAutopilot() {
+	// Parse flags
+	autopilotCmd := flag.NewFlagSet("autopilot", flag.ExitOnError)
+	projectDir := autopilotCmd.String("project", "", "Project directory")
+	filePath := autopilotCmd.String("file", "", "File path relative to project directory")
+	jobID := autopilotCmd.Int("job", 0, "Show the output of this job")
+
+	if err := autopilotCmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	// Initialize database
+	if err := initDB(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	if *jobID != 0 {
+		job, err := getAutopilotJob(*jobID)
+		if err != nil {
+			log.Fatalf("Failed to get autopilot job: %v", err)
+		}
+		if job == nil {
+			fmt.Printf("Error: autopilot job %d not found\n", *jobID)
+			os.Exit(1)
+		}
+		fmt.Printf("Job %d for %s: %s\n", job.ID, job.FilePath, formatJob(*job))
+		fmt.Printf("Command: %s\n\n", job.Command)
+		fmt.Print(job.Output)
+		if job.Output != "" && !strings.HasSuffix(job.Output, "\n") {
+			fmt.Println()
+		}
+		return
+	}
+
+	*projectDir, *filePath = resolveFileFlags(*projectDir, *filePath)
+	jobs, err := getAutopilotJobs(*projectDir, *filePath, 20)
+	if err != nil {
+		log.Fatalf("Failed to get autopilot jobs: %v", err)
+	}
+	if len(jobs) == 0 {
+		fmt.Printf("No autopilot jobs for %s\n", *filePath)
+		return
+	}
+
+	fmt.Printf("Autopilot jobs for %s:\n", *filePath)
+	for _, job := range jobs {
+		fmt.Printf("  %d  %s\n", job.ID, formatJob(job))
+	}
+	fmt.Println("\nRun claude-review autopilot --job <id> to see the output of a job")
+}
+
+// formatJob describes the status of a job, e.g. "succeeded (started 2025-01-02 15:04, took 2m3s)"
+func formatJob(job AutopilotJob) string {
+	started := job.StartedAt.Local().Format("2006-01-02 15:04")
+	if job.FinishedAt == nil {
+		return fmt.Sprintf("%s (started %s)", job.Status, started)
+	}
+	took := job.FinishedAt.Sub(job.StartedAt).Round(time.Second)
+	return fmt.Sprintf("%s (started %s, took %s)", job.Status, started, took)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// renderCacheSize is the maximum number of rendered documents kept in memory
+const renderCacheSize = 512
+
+// commentRenderCacheSize is the maximum number of rendered comments kept in memory. Comments have a cache of their
+// own so that a busy thread list can't evict whole documents.
+const commentRenderCacheSize = 1024
+
+// commandLookupTTL is how long whether a diagram command is installed is remembered. Looking through PATH on every
+// cache hit would make serving a cached document as slow as a directory scan, while installing a renderer is rare.
+const commandLookupTTL = 10 * time.Second
+
+// RenderCache is an LRU cache of rendered Markdown and diagrams
+type RenderCache struct {
+	mu        sync.Mutex
+	capacity  int
+	entries   map[string]*list.Element
+	order     *list.List          // Most recently used at the front
+	documents map[string][]string // Cache keys per document, for invalidation
+}
+
+type renderCacheEntry struct {
+	key      string
+	document string
+	html     []byte
+	deps     *renderDependencies // What else the rendering depended on, nil if only its source
+}
+
+var (
+	renderCache        = newRenderCache(renderCacheSize)
+	commentRenderCache = newRenderCache(commentRenderCacheSize)
+)
+
+// renderDependencies records what a rendering depended on besides its source: whether linked files existed and
+// whether diagram commands were installed. A cached rendering is only reused while these are unchanged.
+type renderDependencies struct {
+	files    map[string]bool // Absolute path -> whether it existed
+	commands map[string]bool // Executable -> whether it was found in PATH
+}
+
+type commandLookup struct {
+	found     bool
+	checkedAt time.Time
+}
+
+var (
+	commandLookupsMu sync.Mutex
+	commandLookups   = make(map[string]commandLookup)
+)
+
+// lookPathCached reports whether an executable is in PATH, looking it up at most once per commandLookupTTL
+func lookPathCached(name string) bool {
+	commandLookupsMu.Lock()
+	lookup, ok := commandLookups[name]
+	commandLookupsMu.Unlock()
+	if ok && time.Since(lookup.checkedAt) < commandLookupTTL {
+		return lookup.found
+	}
+
+	_, err := exec.LookPath(name)
+	commandLookupsMu.Lock()
+	commandLookups[name] = commandLookup{found: err == nil, checkedAt: time.Now()}
+	commandLookupsMu.Unlock()
+	return err == nil
+}
+
+func newRenderDependencies() *renderDependencies {
+	return &renderDependencies{files: make(map[string]bool), commands: make(map[string]bool)}
+}
+
+// fileExists checks whether a file exists, recording the result. It can be called on nil to check without recording.
+func (d *renderDependencies) fileExists(path string) bool {
+	_, err := os.Stat(path)
+	if d != nil {
+		d.files[path] = err == nil
+	}
+	return err == nil
+}
+
+// commandExists checks whether an executable is in PATH, recording the result. It can be called on nil to check
+// without recording.
+func (d *renderDependencies) commandExists(name string) bool {
+	found := lookPathCached(name)
+	if d != nil {
+		d.commands[name] = found
+	}
+	return found
+}
+
+// unchanged reports whether all recorded files and commands are still as they were
+func (d *renderDependencies) unchanged() bool {
+	for path, existed := range d.files {
+		if _, err := os.Stat(path); (err == nil) != existed {
+			return false
+		}
+	}
+	for name, found := range d.commands {
+		if lookPathCached(name) != found {
+			return false
+		}
+	}
+	return true
+}
+
+func newRenderCache(capacity int) *RenderCache {
+	return &RenderCache{
+		capacity:  capacity,
+		entries:   make(map[string]*list.Element),
+		order:     list.New(),
+		documents: make(map[string][]string),
+	}
+}
+
+// renderCacheKey derives a cache key from the kind of rendering, the content and any render options
+func renderCacheKey(kind string, source []byte, options ...string) string {
+	hash := sha256.New()
+	hash.Write([]byte(kind))
+	hash.Write([]byte{0})
+	for _, option := range options {
+		hash.Write([]byte(option))
+		hash.Write([]byte{0})
+	}
+	hash.Write(source)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// renderCacheDocument identifies a document for invalidation
+func renderCacheDocument(projectDir, filePath string) string {
+	return filepath.Join(projectDir, filePath)
+}
+
+func (c *RenderCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	element, ok := c.entries[key]
+	if !ok {
+		c.mu.Unlock()
+		return nil, false
+	}
+	entry := element.Value.(*renderCacheEntry)
+	c.mu.Unlock()
+
+	// Checking the dependencies touches the filesystem, so other lookups don't wait for it. Entries are replaced
+	// rather than changed, so the entry can be read without the lock.
+	stale := entry.deps != nil && !entry.deps.unchanged()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// The entry may have been evicted or replaced meanwhile
+	if current, ok := c.entries[key]; !ok || current.Value.(*renderCacheEntry) != entry {
+		return entry.html, !stale
+	}
+	if stale {
+		c.removeElement(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.html, true
+}
+
+// add caches a rendering. deps may be nil for renderings that only depend on their source.
+func (c *RenderCache) add(key, document string, html []byte, deps *renderDependencies) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		previous := element.Value.(*renderCacheEntry)
+		element.Value = &renderCacheEntry{key: key, document: previous.document, html: html, deps: deps}
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&renderCacheEntry{key: key, document: document, html: html, deps: deps})
+	if document != "" {
+		c.documents[document] = append(c.documents[document], key)
+	}
+
+	for c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// invalidate drops all cached renderings of a document and returns how many were dropped
+func (c *RenderCache) invalidate(projectDir, filePath string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	document := renderCacheDocument(projectDir, filePath)
+	removed := 0
+	for _, key := range c.documents[document] {
+		if element, ok := c.entries[key]; ok {
+			c.removeElement(element)
+			removed++
+		}
+	}
+	delete(c.documents, document)
+	return removed
+}
+
+// len returns the number of cached entries
+func (c *RenderCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// removeElement must be called with the lock held
+func (c *RenderCache) removeElement(element *list.Element) {
+	entry := c.order.Remove(element).(*renderCacheEntry)
+	delete(c.entries, entry.key)
+
+	if entry.document == "" {
+		return
+	}
+	keys := c.documents[entry.document]
+	for i, key := range keys {
+		if key == entry.key {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	if len(keys) == 0 {
+		delete(c.documents, entry.document)
+	} else {
+		c.documents[entry.document] = keys
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderCache(t *testing.T) {
+	t.Run("evicts least recently used entries", func(t *testing.T) {
+		cache := newRenderCache(2)
+		cache.add("a", "", []byte("A"), nil)
+		cache.add("b", "", []byte("B"), nil)
+
+		// Touch "a" so that "b" becomes the eviction candidate
+		if _, ok := cache.get("a"); !ok {
+			t.Fatal("Expected a to be cached")
+		}
+		cache.add("c", "", []byte("C"), nil)
+
+		if _, ok := cache.get("b"); ok {
+			t.Error("Expected b to be evicted")
+		}
+		if html, ok := cache.get("a"); !ok || string(html) != "A" {
+			t.Errorf("Expected a to be kept, got %q", html)
+		}
+		if cache.len() != 2 {
+			t.Errorf("Expected 2 entries, got %d", cache.len())
+		}
+	})
+
+	t.Run("invalidates all renderings of a document", func(t *testing.T) {
+		cache := newRenderCache(10)
+		doc := renderCacheDocument("/project", "PLAN.md")
+		cache.add("v1", doc, []byte("1"), nil)
+		cache.add("v2", doc, []byte("2"), nil)
+		cache.add("other", renderCacheDocument("/project", "OTHER.md"), []byte("3"), nil)
+
+		if removed := cache.invalidate("/project", "PLAN.md"); removed != 2 {
+			t.Errorf("Expected 2 entries removed, got %d", removed)
+		}
+		if _, ok := cache.get("v1"); ok {
+			t.Error("Expected v1 to be invalidated")
+		}
+		if _, ok := cache.get("other"); !ok {
+			t.Error("Expected other document to be kept")
+		}
+	})
+
+	t.Run("document renders are cached by content", func(t *testing.T) {
+		projectDir := t.TempDir()
+		source := []byte("# Cached\n")
+
+		first, err := RenderMarkdownWithLineNumbers(source, WithDocumentPath(projectDir, "PLAN.md"))
+		if err != nil {
+			t.Fatalf("RenderMarkdownWithLineNumbers failed: %v", err)
+		}
+		if removed := renderCache.invalidate(projectDir, "PLAN.md"); removed != 1 {
+			t.Errorf("Expected the render to be cached under its document, got %d entries", removed)
+		}
+
+		second, err := RenderMarkdownWithLineNumbers(source, WithDocumentPath(projectDir, "PLAN.md"))
+		if err != nil {
+			t.Fatalf("RenderMarkdownWithLineNumbers failed: %v", err)
+		}
+		if string(first) != string(second) {
+			t.Errorf("Expected identical output, got %q and %q", first, second)
+		}
+	})
+
+	t.Run("document renders follow linked files", func(t *testing.T) {
+		projectDir := t.TempDir()
+		source := []byte("See [the next step](NEXT.md).\n")
+
+		html, err := RenderMarkdownWithLineNumbers(source, WithDocumentPath(projectDir, "PLAN.md"))
+		if err != nil {
+			t.Fatalf("RenderMarkdownWithLineNumbers failed: %v", err)
+		}
+		if !strings.Contains(string(html), "broken-link") {
+			t.Fatalf("Expected a broken link, got %s", html)
+		}
+
+		if err := os.WriteFile(filepath.Join(projectDir, "NEXT.md"), []byte("# Next\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		html, err = RenderMarkdownWithLineNumbers(source, WithDocumentPath(projectDir, "PLAN.md"))
+		if err != nil {
+			t.Fatalf("RenderMarkdownWithLineNumbers failed: %v", err)
+		}
+		if strings.Contains(string(html), "broken-link") {
+			t.Errorf("Expected the link to be fixed once the file exists, got %s", html)
+		}
+	})
+
+	t.Run("comment renders have their own cache", func(t *testing.T) {
+		documents := renderCache.len()
+		if _, err := RenderMarkdown([]byte("A comment that is only rendered here")); err != nil {
+			t.Fatalf("RenderMarkdown failed: %v", err)
+		}
+		if renderCache.len() != documents {
+			t.Error("Expected comment renders to stay out of the document cache")
+		}
+	})
+	t.Run("diagram commands are looked up at most once per TTL", func(t *testing.T) {
+		binDir := t.TempDir()
+		t.Setenv("PATH", binDir)
+		command := filepath.Join(binDir, "cr-test-renderer")
+		if err := os.WriteFile(command, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if !lookPathCached("cr-test-renderer") {
+			t.Fatal("Expected the command to be found")
+		}
+
+		if err := os.Remove(command); err != nil {
+			t.Fatal(err)
+		}
+		if !lookPathCached("cr-test-renderer") {
+			t.Error("Expected the earlier lookup to be reused")
+		}
+
+		commandLookupsMu.Lock()
+		commandLookups["cr-test-renderer"] = commandLookup{found: true, checkedAt: time.Now().Add(-commandLookupTTL)}
+		commandLookupsMu.Unlock()
+		if lookPathCached("cr-test-renderer") {
+			t.Error("Expected the command to be looked up again once the lookup expired")
+		}
+	})
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// claudeHookEvents maps the Claude Code hook events that claude-review installs to the argument of the hook command
+var claudeHookEvents = map[string]string{
+	"UserPromptSubmit": "user-prompt-submit",
+	"Stop":             "stop",
+}
+
+// claudeHookInput is the part of the JSON that Claude Code passes to hooks on stdin that we use
+type claudeHookInput struct {
+	SessionID      string `json:"session_id"`
+	Cwd            string `json:"cwd"`
+	StopHookActive bool   `json:"stop_hook_active"` // Set when Claude Code is already continuing because of a Stop hook
+}
+
+// runHook is run by Claude Code (see installClaudeCodeHooks). It tells the agent about review comments that arrived
+// since the session last heard about them: as context for the prompt on user-prompt-submit, and by asking the
+// agent to keep going on stop. A hook must never get in the agent's way, so failures are only reported on stderr.
+func runHook() {
+	if len(os.Args) < 3 {
+		fmt.Println("Usage: claude-review hook <user-prompt-submit|stop>")
+		os.Exit(1)
+	}
+	event := os.Args[2]
+	if event != claudeHookEvents["UserPromptSubmit"] && event != claudeHookEvents["Stop"] {
+		fmt.Printf("Unknown hook event: %s\n", event)
+		os.Exit(1)
+	}
+
+	var input claudeHookInput
+	if err := json.NewDecoder(os.Stdin).Decode(&input); err != nil {
+		fmt.Fprintf(os.Stderr, "claude-review: failed to read hook input: %v\n", err)
+	}
+
+	// Don't keep the agent from stopping twice in a row
+	if event == claudeHookEvents["Stop"] && input.StopHookActive {
+		return
+	}
+
+	projectDir := os.Getenv("CLAUDE_PROJECT_DIR")
+	if projectDir == "" {
+		projectDir = input.Cwd
+	}
+	if projectDir == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "claude-review: failed to get current directory: %v\n", err)
+			return
+		}
+		projectDir = cwd
+	}
+
+	if err := initDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "claude-review: failed to initialize database: %v\n", err)
+		return
+	}
+
+	awaiting, err := getAwaitingComments(projectDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "claude-review: failed to get comments: %v\n", err)
+		return
+	}
+	if input.SessionID != "" {
+		awaiting, err = recordHookNotices(input.SessionID, awaiting)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "claude-review: failed to record notices: %v\n", err)
+			return
+		}
+	}
+	if len(awaiting) == 0 {
+		return
+	}
+
+	message := awaitingCommentsMessage(awaiting)
+	if event == claudeHookEvents["Stop"] {
+		// Blocking is what marks the comments as seen, so that the agent is held back at most once for them.
+		// Without a session to remember that for, every stop would be blocked again.
+		if input.SessionID == "" {
+			return
+		}
+		output, err := json.Marshal(map[string]string{"decision": "block", "reason": message})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "claude-review: failed to encode hook output: %v\n", err)
+			return
+		}
+		fmt.Println(string(output))
+		return
+	}
+	fmt.Println(message)
+}
+
+// awaitingCommentsMessage summarizes comments per file, e.g.
+// "2 new review comment(s) awaiting you on PLAN.md, 1 on docs/spec.md. Run /cr-address <file> to address them."
+func awaitingCommentsMessage(comments []Comment) string {
+	var files []string
+	counts := make(map[string]int)
+	for _, c := range comments {
+		if counts[c.FilePath] == 0 {
+			files = append(files, c.FilePath)
+		}
+		counts[c.FilePath]++
+	}
+
+	parts := make([]string, len(files))
+	for i, file := range files {
+		if i == 0 {
+			parts[i] = fmt.Sprintf("%d new review comment(s) awaiting you on %s", counts[file], file)
+		} else {
+			parts[i] = fmt.Sprintf("%d on %s", counts[file], file)
+		}
+	}
+	return strings.Join(parts, ", ") + ". Run /cr-address <file> to address them."
+}
+
+// installClaudeCodeHooks adds the claude-review hooks to a Claude Code settings file, keeping all other settings
+// and hooks. Hooks from an earlier install are replaced.
+func installClaudeCodeHooks(settingsPath string) error {
+	settings, err := readJSONConfig(settingsPath)
+	if err != nil {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate claude-review executable: %w", err)
+	}
+
+	hooks, ok := settings["hooks"].(map[string]interface{})
+	if !ok {
+		hooks = make(map[string]interface{})
+	}
+
+	events := make([]string, 0, len(claudeHookEvents))
+	for event := range claudeHookEvents {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+
+	for _, event := range events {
+		arg := claudeHookEvents[event]
+		groups, _ := hooks[event].([]interface{})
+
+		kept, _ := removeClaudeReviewHooks(groups, arg)
+		kept = append(kept, map[string]interface{}{
+			"hooks": []interface{}{
+				map[string]interface{}{
+					"type":    "command",
+					"command": shellQuote(executable) + " hook " + arg,
+				},
+			},
+		})
+		hooks[event] = kept
+	}
+	settings["hooks"] = hooks
+
+	if err := writeJSONConfig(settingsPath, settings, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Installed hooks for %s to %s\n", strings.Join(events, " and "), settingsPath)
+	return nil
+}
+
+// uninstallClaudeCodeHooks removes the hooks added by installClaudeCodeHooks from a Claude Code settings file
+func uninstallClaudeCodeHooks(settingsPath string) error {
+	settings, err := readJSONConfig(settingsPath)
+	if err != nil {
+		return err
+	}
+	hooks, _ := settings["hooks"].(map[string]interface{})
+
+	removed := 0
+	for event, arg := range claudeHookEvents {
+		groups, _ := hooks[event].([]interface{})
+
+		kept, n := removeClaudeReviewHooks(groups, arg)
+		removed += n
+		if len(kept) == 0 {
+			delete(hooks, event)
+		} else {
+			hooks[event] = kept
+		}
+	}
+	if removed == 0 {
+		return nil
+	}
+	if len(hooks) == 0 {
+		delete(settings, "hooks")
+	}
+
+	if err := writeJSONConfig(settingsPath, settings, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %d hook(s) from %s\n", removed, settingsPath)
+	return nil
+}
+
+// removeClaudeReviewHooks removes the hooks running `claude-review hook <arg>` from the hook matcher groups of a
+// Claude Code settings file, returning the remaining groups and how many hooks were removed. Other hooks in the same
+// group are kept; a group is only dropped once it has no hooks left.
+func removeClaudeReviewHooks(groups []interface{}, arg string) ([]interface{}, int) {
+	kept := make([]interface{}, 0, len(groups)+1)
+	removed := 0
+	for _, group := range groups {
+		groupMap, ok := group.(map[string]interface{})
+		if !ok {
+			kept = append(kept, group)
+			continue
+		}
+		hooks, _ := groupMap["hooks"].([]interface{})
+
+		others := make([]interface{}, 0, len(hooks))
+		for _, hook := range hooks {
+			if isClaudeReviewHook(hook, arg) {
+				removed++
+			} else {
+				others = append(others, hook)
+			}
+		}
+		switch {
+		case len(others) == len(hooks):
+			kept = append(kept, group)
+		case len(others) > 0:
+			groupMap["hooks"] = others
+			kept = append(kept, groupMap)
+		}
+	}
+	return kept, removed
+}
+
+// isClaudeReviewHook reports whether a hook from Claude Code settings runs `claude-review hook <arg>`
+func isClaudeReviewHook(hook interface{}, arg string) bool {
+	hookMap, ok := hook.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	command, _ := hookMap["command"].(string)
+	return strings.Contains(command, "claude-review") && strings.HasSuffix(command, " hook "+arg)
+}
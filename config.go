@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// projectConfigFile is the name of the optional configuration file in a project's root directory
+const projectConfigFile = ".claude-review.toml"
+
+// ProjectConfig is the configuration of a project, read from its .claude-review.toml
+type ProjectConfig struct {
+	Hooks     EventHooks      `toml:"hooks"`
+	Webhooks  []WebhookConfig `toml:"webhooks"`
+	Autopilot AutopilotConfig `toml:"autopilot"`
+
+	path    string
+	hash    string // Identifies this version of the file (see projectConfigHash)
+	allowed bool   // The user allowed this version of the file to run commands (see runAllow)
+}
+
+// loadProjectConfig reads the configuration of a project. It is read again for every use, so changes take effect
+// without restarting the server. A project without a configuration file gets the zero config.
+func loadProjectConfig(projectDir string) (*ProjectConfig, error) {
+	path := filepath.Join(projectDir, projectConfigFile)
+
+	config := ProjectConfig{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &config, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	meta, err := toml.Decode(string(data), &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	// Catch typos in hook names instead of silently ignoring them
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("unknown keys in %s: %s", path, strings.Join(keys, ", "))
+	}
+
+	for _, webhook := range config.Webhooks {
+		if webhook.URL == "" {
+			return nil, fmt.Errorf("a webhook in %s has no url", path)
+		}
+		for _, event := range webhook.Events {
+			if !slices.Contains(webhookEvents, event) {
+				return nil, fmt.Errorf("unknown webhook event %q in %s, expected one of %s", event, path,
+					strings.Join(webhookEvents, ", "))
+			}
+		}
+	}
+
+	allowedHash, err := getAllowedConfigHash(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	config.hash = projectConfigHash(data)
+	config.allowed = allowedHash == config.hash
+
+	return &config, nil
+}
+
+// projectConfigHash identifies a version of a project configuration file
+func projectConfigHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// commands returns the shell commands the configuration would run and the URLs it would send review activity to,
+// by the setting they come from
+func (c *ProjectConfig) commands() [][2]string {
+	var commands [][2]string
+	for _, hook := range []string{"on_user_comment", "on_thread_resolved", "on_verdict", "on_file_changed"} {
+		if command := c.Hooks.command(hook); command != "" {
+			commands = append(commands, [2]string{"hooks." + hook, command})
+		}
+	}
+	if c.Autopilot.Command != "" {
+		commands = append(commands, [2]string{"autopilot.command", c.Autopilot.Command})
+	}
+	for _, webhook := range c.Webhooks {
+		commands = append(commands, [2]string{"webhooks.url", webhook.URL})
+	}
+	return commands
+}
+
+// checkCommandsAllowed returns an error unless the user allowed this version of the configuration to run commands.
+// A repository's configuration is written by whoever committed it, so its commands don't run just because it was
+// checked out or pulled.
+func (c *ProjectConfig) checkCommandsAllowed() error {
+	if c.allowed {
+		return nil
+	}
+	return fmt.Errorf("%s is not allowed to run commands; review it, then run `claude-review allow` in %s", c.path,
+		filepath.Dir(c.path))
+}
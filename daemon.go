@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -104,8 +105,8 @@ func isServerRunning() bool {
 	return true
 }
 
-// daemonize starts the process as a daemon using double-fork
-func daemonize() error {
+// daemonize starts the process as a daemon using double-fork, reporting where it runs to out
+func daemonize(out io.Writer) error {
 	// Check if server is already running
 	if isServerRunning() {
 		pidFile, _ := getPIDFilePath()
@@ -154,10 +155,10 @@ func daemonize() error {
 	if port == "" {
 		port = "4779"
 	}
-	fmt.Printf("Server started as daemon\n")
-	fmt.Printf("Port: %s\n", port)
-	fmt.Printf("PID file: %s\n", pidFile)
-	fmt.Printf("Log file: %s\n", logFile)
+	fmt.Fprintf(out, "Server started as daemon\n")
+	fmt.Fprintf(out, "Port: %s\n", port)
+	fmt.Fprintf(out, "PID file: %s\n", pidFile)
+	fmt.Fprintf(out, "Log file: %s\n", logFile)
 	return nil
 }
 
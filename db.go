@@ -2,10 +2,12 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -37,12 +39,68 @@ type Comment struct {
 	CreatedAt        time.Time  `json:"created_at"`
 	ResolvedAt       *time.Time `json:"resolved_at,omitempty"`
 	RootID           *int       `json:"root_id,omitempty"`
-	Author           string     `json:"author"`
-	ResolvedBy       *string    `json:"resolved_by,omitempty"`
+	Author           string     `json:"author"`                      // Role: "user" or "agent"
+	AuthorName       string     `json:"author_name,omitempty"`       // Reviewer name, may be empty
+	AgentID          string     `json:"agent_id,omitempty"`          // Agent session that wrote the comment, if any
+	ResolvedBy       *string    `json:"resolved_by,omitempty"`       // Role: "user" or "agent"
+	ResolvedAgentID  string     `json:"resolved_agent_id,omitempty"` // Agent session that resolved the thread
+	EditedAt         *time.Time `json:"edited_at,omitempty"`
+	Draft            bool       `json:"draft,omitempty"`        // Hidden from the agent until the review is submitted
+	ReviewRound      *int       `json:"review_round,omitempty"` // Set when a draft is published by submitting a review
 }
 
+// IsDocumentLevel reports whether a root comment is about the whole document rather than a selection
+func (c *Comment) IsDocumentLevel() bool {
+	return c.RootID == nil && c.LineStart == nil && c.LineEnd == nil && c.SelectedText == ""
+}
+
+// CommentRevision records a change to a comment: the text it had before an edit, or the text at the
+// time it was deleted or restored
+type CommentRevision struct {
+	ID          int       `json:"id"`
+	CommentID   int       `json:"comment_id"`
+	Action      string    `json:"action"`
+	CommentText string    `json:"comment_text"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ReviewRound is one submitted pass over a file: the drafts published together and a snapshot of the file at the time
+type ReviewRound struct {
+	ID               int       `json:"id"`
+	ProjectDirectory string    `json:"project_directory"`
+	FilePath         string    `json:"file_path"`
+	Round            int       `json:"round"`
+	SubmittedAt      time.Time `json:"submitted_at"`
+	AuthorName       string    `json:"author_name,omitempty"`
+	Snapshot         *string   `json:"-"` // File content when the review was submitted, nil if it couldn't be read
+}
+
+// Review statuses of a document, recorded as verdicts
+const (
+	statusInProgress       = "in_progress"
+	statusChangesRequested = "changes_requested"
+	statusApproved         = "approved"
+)
+
+// Verdict is a reviewer's decision on a document. The latest verdict is the document's review status.
+type Verdict struct {
+	ID               int       `json:"id"`
+	ProjectDirectory string    `json:"project_directory"`
+	FilePath         string    `json:"file_path"`
+	Status           string    `json:"status"`
+	AuthorName       string    `json:"author_name,omitempty"`
+	Note             string    `json:"note,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// errCommentNotFound is returned when a comment doesn't exist or has been deleted
+var errCommentNotFound = errors.New("comment not found")
+
 var db *sql.DB
 
+// dbBusyTimeoutMs is how long a connection waits for a lock held by another process
+const dbBusyTimeoutMs = 5000
+
 // getDataDir returns the data directory for claude-review and ensures it exists
 func getDataDir() (string, error) {
 	var dataDir string
@@ -73,9 +131,11 @@ func initDB() error {
 		return err
 	}
 
-	// Open database
+	// Open database. The daemon and short-lived CLI processes write concurrently, so use WAL with a
+	// busy timeout, and enforce foreign keys so that ON DELETE CASCADE works for replies.
 	dbPath := filepath.Join(dbDir, "comments.db")
-	db, err = sql.Open("sqlite3", dbPath)
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=%d&_foreign_keys=on", dbPath, dbBusyTimeoutMs)
+	db, err = sql.Open("sqlite3", dsn)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
@@ -99,14 +159,115 @@ func initDB() error {
 		resolved_at TIMESTAMP,
 		root_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
 		author TEXT CHECK(author IN ('user', 'agent')),
+		author_name TEXT,
+		agent_id TEXT,
 		resolved_by TEXT,
+		resolved_agent_id TEXT,
+		edited_at TIMESTAMP,
+		deleted_at TIMESTAMP,
+		draft INTEGER NOT NULL DEFAULT 0,
+		review_round INTEGER,
+		FOREIGN KEY (project_directory) REFERENCES projects(directory)
+	);
+
+	CREATE TABLE IF NOT EXISTS comment_revisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+		action TEXT NOT NULL CHECK(action IN ('edit', 'delete', 'restore')),
+		comment_text TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS review_rounds (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_directory TEXT NOT NULL,
+		file_path TEXT NOT NULL,
+		round INTEGER NOT NULL,
+		submitted_at TIMESTAMP NOT NULL,
+		author_name TEXT,
+		snapshot TEXT,
+		UNIQUE (project_directory, file_path, round),
+		FOREIGN KEY (project_directory) REFERENCES projects(directory)
+	);
+
+	CREATE TABLE IF NOT EXISTS verdicts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_directory TEXT NOT NULL,
+		file_path TEXT NOT NULL,
+		status TEXT NOT NULL CHECK(status IN ('in_progress', 'changes_requested', 'approved')),
+		author_name TEXT,
+		note TEXT,
+		created_at TIMESTAMP NOT NULL,
 		FOREIGN KEY (project_directory) REFERENCES projects(directory)
 	);
 
+	CREATE TABLE IF NOT EXISTS hook_notices (
+		session_id TEXT NOT NULL,
+		comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (session_id, comment_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS thread_statuses (
+		root_id INTEGER PRIMARY KEY REFERENCES comments(id) ON DELETE CASCADE,
+		state TEXT NOT NULL CHECK(state IN ('working', 'done', 'blocked')),
+		note TEXT,
+		agent_id TEXT,
+		updated_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		signature TEXT,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP NOT NULL,
+		last_error TEXT,
+		failed_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS autopilot_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_directory TEXT NOT NULL,
+		file_path TEXT NOT NULL,
+		command TEXT NOT NULL,
+		status TEXT NOT NULL CHECK(status IN ('running', 'succeeded', 'failed')),
+		output TEXT,
+		started_at TIMESTAMP NOT NULL,
+		finished_at TIMESTAMP,
+		FOREIGN KEY (project_directory) REFERENCES projects(directory)
+	);
+
+	CREATE TABLE IF NOT EXISTS allowed_configs (
+		project_directory TEXT PRIMARY KEY,
+		sha256 TEXT NOT NULL,
+		allowed_at TIMESTAMP NOT NULL
+	);
+
 	CREATE INDEX IF NOT EXISTS idx_comments_lookup ON comments(project_directory, file_path, resolved_at, created_at DESC);
 	CREATE INDEX IF NOT EXISTS idx_comments_thread ON comments(root_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_comment_revisions_comment ON comment_revisions(comment_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_verdicts_lookup ON verdicts(project_directory, file_path, created_at);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(failed_at, next_attempt_at);
+	CREATE INDEX IF NOT EXISTS idx_autopilot_jobs_lookup ON autopilot_jobs(project_directory, file_path, started_at);
 	`
 
+	// Databases created by older versions lack the newer columns
+	if err := addMissingColumns("comments", map[string]string{
+		"author_name":       "TEXT",
+		"agent_id":          "TEXT",
+		"resolved_agent_id": "TEXT",
+		"edited_at":         "TIMESTAMP",
+		"deleted_at":        "TIMESTAMP",
+		"draft":             "INTEGER NOT NULL DEFAULT 0",
+		"review_round":      "INTEGER",
+	}); err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
 	logQuery(schema)
 	if _, err := db.Exec(schema); err != nil {
 		return fmt.Errorf("failed to create schema: %w", err)
@@ -115,6 +276,55 @@ func initDB() error {
 	return nil
 }
 
+// addMissingColumns adds the given columns (name to type) to an existing table if they aren't there yet.
+// Tables that don't exist yet are left alone; the schema creates them with all columns.
+func addMissingColumns(table string, columns map[string]string) error {
+	query := fmt.Sprintf("PRAGMA table_info(%s)", table)
+	logQuery(query)
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	_ = rows.Close()
+
+	if len(existing) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if existing[name] {
+			continue
+		}
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, name, columns[name])
+		logQuery(query)
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func createProject(directory string) (*Project, error) {
 	// Idempotent insert
 	query := "INSERT OR IGNORE INTO projects (directory) VALUES (?)"
@@ -136,6 +346,23 @@ func createProject(directory string) (*Project, error) {
 	return &project, nil
 }
 
+// getProject returns a registered project, or nil if the directory isn't registered
+func getProject(directory string) (*Project, error) {
+	query := "SELECT directory, created_at FROM projects WHERE directory = ?"
+	logQuery(query, directory)
+
+	var project Project
+	err := db.QueryRow(query, directory).Scan(&project.Directory, &project.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &project, nil
+}
+
 func getAllProjects() ([]Project, error) {
 	query := "SELECT directory, created_at FROM projects ORDER BY created_at DESC"
 	logQuery(query)
@@ -162,8 +389,8 @@ func createComment(c *Comment) error {
 	c.CreatedAt = time.Now()
 
 	query := `
-		INSERT INTO comments (project_directory, file_path, line_start, line_end, selected_text, comment_text, root_id, author, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		INSERT INTO comments (project_directory, file_path, line_start, line_end, selected_text, comment_text, root_id, author, author_name, agent_id, draft, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?)`
 	logQuery(
 		query,
 		c.ProjectDirectory,
@@ -174,6 +401,9 @@ func createComment(c *Comment) error {
 		c.CommentText,
 		c.RootID,
 		c.Author,
+		c.AuthorName,
+		c.AgentID,
+		c.Draft,
 		c.CreatedAt,
 	)
 	result, err := db.Exec(
@@ -186,6 +416,9 @@ func createComment(c *Comment) error {
 		c.CommentText,
 		c.RootID,
 		c.Author,
+		c.AuthorName,
+		c.AgentID,
+		c.Draft,
 		c.CreatedAt,
 	)
 	if err != nil {
@@ -201,23 +434,27 @@ func createComment(c *Comment) error {
 	return nil
 }
 
-func getComments(projectDir, filePath string, resolved bool) ([]Comment, error) {
+// getComments returns the resolved or unresolved comments of a file. Drafts are only included for the reviewer's
+// own browser; the agent must not act on a review that hasn't been submitted.
+func getComments(projectDir, filePath string, resolved, includeDrafts bool) ([]Comment, error) {
 	var query string
 	if resolved {
 		query = `
-			SELECT id, project_directory, file_path, line_start, line_end, selected_text, comment_text, created_at, resolved_at, root_id, author, resolved_by
+			SELECT id, project_directory, file_path, line_start, line_end, selected_text, comment_text, created_at, resolved_at, root_id, author, COALESCE(author_name, ''), COALESCE(agent_id, ''), resolved_by, COALESCE(resolved_agent_id, ''), edited_at, draft, review_round
 			FROM comments
-			WHERE project_directory = ? AND file_path = ? AND resolved_at IS NOT NULL
+			WHERE project_directory = ? AND file_path = ? AND resolved_at IS NOT NULL AND deleted_at IS NULL
+				AND (draft = 0 OR ?)
 			ORDER BY COALESCE(root_id, id) ASC, created_at ASC`
 	} else {
 		query = `
-			SELECT id, project_directory, file_path, line_start, line_end, selected_text, comment_text, created_at, resolved_at, root_id, author, resolved_by
+			SELECT id, project_directory, file_path, line_start, line_end, selected_text, comment_text, created_at, resolved_at, root_id, author, COALESCE(author_name, ''), COALESCE(agent_id, ''), resolved_by, COALESCE(resolved_agent_id, ''), edited_at, draft, review_round
 			FROM comments
-			WHERE project_directory = ? AND file_path = ? AND resolved_at IS NULL
+			WHERE project_directory = ? AND file_path = ? AND resolved_at IS NULL AND deleted_at IS NULL
+				AND (draft = 0 OR ?)
 			ORDER BY COALESCE(root_id, id) ASC, created_at ASC`
 	}
-	logQuery(query, projectDir, filePath)
-	rows, err := db.Query(query, projectDir, filePath)
+	logQuery(query, projectDir, filePath, includeDrafts)
+	rows, err := db.Query(query, projectDir, filePath, includeDrafts)
 	if err != nil {
 		return nil, err
 	}
@@ -226,7 +463,7 @@ func getComments(projectDir, filePath string, resolved bool) ([]Comment, error)
 	var comments []Comment
 	for rows.Next() {
 		var c Comment
-		if err := rows.Scan(&c.ID, &c.ProjectDirectory, &c.FilePath, &c.LineStart, &c.LineEnd, &c.SelectedText, &c.CommentText, &c.CreatedAt, &c.ResolvedAt, &c.RootID, &c.Author, &c.ResolvedBy); err != nil {
+		if err := rows.Scan(&c.ID, &c.ProjectDirectory, &c.FilePath, &c.LineStart, &c.LineEnd, &c.SelectedText, &c.CommentText, &c.CreatedAt, &c.ResolvedAt, &c.RootID, &c.Author, &c.AuthorName, &c.AgentID, &c.ResolvedBy, &c.ResolvedAgentID, &c.EditedAt, &c.Draft, &c.ReviewRound); err != nil {
 			return nil, err
 		}
 		comments = append(comments, c)
@@ -235,32 +472,173 @@ func getComments(projectDir, filePath string, resolved bool) ([]Comment, error)
 	return comments, nil
 }
 
-func updateComment(commentID, commentText string) error {
-	query := `
+// updateComment replaces the text of a comment, keeping the previous text as a revision
+func updateComment(commentID int, commentText string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var previousText string
+	query := "SELECT comment_text FROM comments WHERE id = ? AND deleted_at IS NULL"
+	logQuery(query, commentID)
+	if err := tx.QueryRow(query, commentID).Scan(&previousText); err != nil {
+		if err == sql.ErrNoRows {
+			return errCommentNotFound
+		}
+		return err
+	}
+
+	if previousText == commentText {
+		return nil
+	}
+
+	now := time.Now()
+	if err := addRevision(tx, commentID, "edit", previousText, now); err != nil {
+		return err
+	}
+
+	query = `
 		UPDATE comments
-		SET comment_text = ?
+		SET comment_text = ?, edited_at = ?
 		WHERE id = ?`
-	logQuery(query, commentText, commentID)
-	_, err := db.Exec(query, commentText, commentID)
-	return err
+	logQuery(query, commentText, now, commentID)
+	if _, err := tx.Exec(query, commentText, now, commentID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func deleteComment(commentID string) error {
+// deleteComment soft-deletes a comment together with its replies, so that it can be restored
+func deleteComment(commentID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var commentText string
+	query := "SELECT comment_text FROM comments WHERE id = ? AND deleted_at IS NULL"
+	logQuery(query, commentID)
+	if err := tx.QueryRow(query, commentID).Scan(&commentText); err != nil {
+		if err == sql.ErrNoRows {
+			return errCommentNotFound
+		}
+		return err
+	}
+
+	now := time.Now()
+	if err := addRevision(tx, commentID, "delete", commentText, now); err != nil {
+		return err
+	}
+
+	// Replies share the deletion timestamp, which is how restoreComment finds them again
+	query = `
+		UPDATE comments
+		SET deleted_at = ?
+		WHERE (id = ? OR root_id = ?) AND deleted_at IS NULL`
+	logQuery(query, now, commentID, commentID)
+	if _, err := tx.Exec(query, now, commentID, commentID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// restoreComment undoes deleteComment, bringing back the replies that were deleted along with the comment.
+// Returns errCommentNotFound if the comment doesn't exist or isn't deleted.
+func restoreComment(commentID int) (*Comment, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var commentText string
+	var rootDeleted bool
 	query := `
-		DELETE FROM comments
-		WHERE id = ?`
+		SELECT c.comment_text, root.deleted_at IS NOT NULL
+		FROM comments c
+		LEFT JOIN comments root ON root.id = c.root_id
+		WHERE c.id = ? AND c.deleted_at IS NOT NULL`
 	logQuery(query, commentID)
-	_, err := db.Exec(query, commentID)
+	if err := tx.QueryRow(query, commentID).Scan(&commentText, &rootDeleted); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errCommentNotFound
+		}
+		return nil, err
+	}
+	if rootDeleted {
+		return nil, fmt.Errorf("cannot restore reply #%d: its thread is deleted", commentID)
+	}
+
+	query = `
+		UPDATE comments
+		SET deleted_at = NULL
+		WHERE (id = ? OR root_id = ?) AND deleted_at = (SELECT deleted_at FROM comments WHERE id = ?)`
+	logQuery(query, commentID, commentID, commentID)
+	if _, err := tx.Exec(query, commentID, commentID, commentID); err != nil {
+		return nil, err
+	}
+
+	if err := addRevision(tx, commentID, "restore", commentText, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return getCommentByID(commentID)
+}
+
+func addRevision(tx *sql.Tx, commentID int, action, commentText string, createdAt time.Time) error {
+	query := `
+		INSERT INTO comment_revisions (comment_id, action, comment_text, created_at)
+		VALUES (?, ?, ?, ?)`
+	logQuery(query, commentID, action, commentText, createdAt)
+	_, err := tx.Exec(query, commentID, action, commentText, createdAt)
 	return err
 }
 
-func resolveComments(projectDir, filePath string) (int, error) {
+// getCommentRevisions returns the revisions of a comment, oldest first
+func getCommentRevisions(commentID int) ([]CommentRevision, error) {
+	query := `
+		SELECT id, comment_id, action, comment_text, created_at
+		FROM comment_revisions
+		WHERE comment_id = ?
+		ORDER BY created_at ASC, id ASC`
+	logQuery(query, commentID)
+	rows, err := db.Query(query, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	revisions := []CommentRevision{}
+	for rows.Next() {
+		var r CommentRevision
+		if err := rows.Scan(&r.ID, &r.CommentID, &r.Action, &r.CommentText, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+
+	return revisions, rows.Err()
+}
+
+// resolveComments resolves all comments on a file on behalf of the agent. agentID identifies the agent session, if any.
+func resolveComments(projectDir, filePath, agentID string) (int, error) {
 	query := `
 		UPDATE comments
-		SET resolved_at = CURRENT_TIMESTAMP, resolved_by = 'user'
-		WHERE project_directory = ? AND file_path = ? AND resolved_at IS NULL`
-	logQuery(query, projectDir, filePath)
-	result, err := db.Exec(query, projectDir, filePath)
+		SET resolved_at = ?, resolved_by = 'agent', resolved_agent_id = NULLIF(?, '')
+		WHERE project_directory = ? AND file_path = ? AND resolved_at IS NULL AND deleted_at IS NULL AND draft = 0`
+	// Generate timestamp in Go, with the same precision as created_at, so that review rounds can order them
+	resolvedAt := time.Now()
+	logQuery(query, resolvedAt, agentID, projectDir, filePath)
+	result, err := db.Exec(query, resolvedAt, agentID, projectDir, filePath)
 	if err != nil {
 		return 0, err
 	}
@@ -275,16 +653,17 @@ func resolveComments(projectDir, filePath string) (int, error) {
 
 func getCommentByID(commentID int) (*Comment, error) {
 	query := `
-		SELECT id, project_directory, file_path, line_start, line_end, selected_text, comment_text, created_at, resolved_at, root_id, author, resolved_by
+		SELECT id, project_directory, file_path, line_start, line_end, selected_text, comment_text, created_at, resolved_at, root_id, author, COALESCE(author_name, ''), COALESCE(agent_id, ''), resolved_by, COALESCE(resolved_agent_id, ''), edited_at, draft, review_round
 		FROM comments
-		WHERE id = ?`
+		WHERE id = ? AND deleted_at IS NULL`
 	logQuery(query, commentID)
 
 	var c Comment
 	err := db.QueryRow(query, commentID).Scan(
 		&c.ID, &c.ProjectDirectory, &c.FilePath, &c.LineStart, &c.LineEnd,
 		&c.SelectedText, &c.CommentText, &c.CreatedAt,
-		&c.ResolvedAt, &c.RootID, &c.Author, &c.ResolvedBy,
+		&c.ResolvedAt, &c.RootID, &c.Author, &c.AuthorName, &c.AgentID, &c.ResolvedBy, &c.ResolvedAgentID, &c.EditedAt,
+		&c.Draft, &c.ReviewRound,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -296,13 +675,16 @@ func getCommentByID(commentID int) (*Comment, error) {
 	return &c, nil
 }
 
-func resolveThread(rootCommentID int, resolvedBy string) (int, error) {
+// resolveThread resolves a thread. resolvedBy is the role resolving it, and agentID identifies the agent session doing
+// so, if any.
+func resolveThread(rootCommentID int, resolvedBy, agentID string) (int, error) {
 	query := `
 		UPDATE comments
-		SET resolved_at = CURRENT_TIMESTAMP, resolved_by = ?
-		WHERE (id = ? OR root_id = ?) AND resolved_at IS NULL`
-	logQuery(query, resolvedBy, rootCommentID, rootCommentID)
-	result, err := db.Exec(query, resolvedBy, rootCommentID, rootCommentID)
+		SET resolved_at = ?, resolved_by = ?, resolved_agent_id = NULLIF(?, '')
+		WHERE (id = ? OR root_id = ?) AND resolved_at IS NULL AND deleted_at IS NULL AND draft = 0`
+	resolvedAt := time.Now()
+	logQuery(query, resolvedAt, resolvedBy, agentID, rootCommentID, rootCommentID)
+	result, err := db.Exec(query, resolvedAt, resolvedBy, agentID, rootCommentID, rootCommentID)
 	if err != nil {
 		return 0, err
 	}
@@ -315,18 +697,609 @@ func resolveThread(rootCommentID int, resolvedBy string) (int, error) {
 	return int(count), nil
 }
 
-func hasReplies(commentID int) (bool, error) {
+// submitReview publishes the drafts of a file as the next numbered review round, recording a snapshot of the file.
+// Returns the round and the number of comments published, or nil and 0 when there are no drafts.
+func submitReview(projectDir, filePath, authorName string, snapshot *string) (*ReviewRound, int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	round := &ReviewRound{
+		ProjectDirectory: projectDir,
+		FilePath:         filePath,
+		SubmittedAt:      time.Now(),
+		AuthorName:       authorName,
+		Snapshot:         snapshot,
+	}
+
 	query := `
-		SELECT COUNT(*) FROM comments WHERE root_id = ?`
-	logQuery(query, commentID)
+		SELECT COALESCE(MAX(round), 0) + 1
+		FROM review_rounds
+		WHERE project_directory = ? AND file_path = ?`
+	logQuery(query, projectDir, filePath)
+	if err := tx.QueryRow(query, projectDir, filePath).Scan(&round.Round); err != nil {
+		return nil, 0, err
+	}
+
+	query = `
+		UPDATE comments
+		SET draft = 0, review_round = ?
+		WHERE project_directory = ? AND file_path = ? AND draft = 1 AND deleted_at IS NULL`
+	logQuery(query, round.Round, projectDir, filePath)
+	result, err := tx.Exec(query, round.Round, projectDir, filePath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return nil, 0, err
+	}
+	if count == 0 {
+		return nil, 0, nil
+	}
+
+	query = `
+		INSERT INTO review_rounds (project_directory, file_path, round, submitted_at, author_name, snapshot)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	logQuery(query, projectDir, filePath, round.Round, round.SubmittedAt, authorName, "<snapshot>")
+	result, err = tx.Exec(query, projectDir, filePath, round.Round, round.SubmittedAt, authorName, snapshot)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, 0, err
+	}
+	round.ID = int(id)
+
+	if err := tx.Commit(); err != nil {
+		return nil, 0, err
+	}
+
+	return round, int(count), nil
+}
+
+// getReviewRounds returns the review rounds of a file in order, without their snapshots
+func getReviewRounds(projectDir, filePath string) ([]ReviewRound, error) {
+	query := `
+		SELECT id, project_directory, file_path, round, submitted_at, COALESCE(author_name, '')
+		FROM review_rounds
+		WHERE project_directory = ? AND file_path = ?
+		ORDER BY round ASC`
+	logQuery(query, projectDir, filePath)
+	rows, err := db.Query(query, projectDir, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	rounds := []ReviewRound{}
+	for rows.Next() {
+		var r ReviewRound
+		if err := rows.Scan(&r.ID, &r.ProjectDirectory, &r.FilePath, &r.Round, &r.SubmittedAt, &r.AuthorName); err != nil {
+			return nil, err
+		}
+		rounds = append(rounds, r)
+	}
+
+	return rounds, rows.Err()
+}
+
+// getReviewRoundSnapshot returns the file content recorded when a round was submitted
+func getReviewRoundSnapshot(projectDir, filePath string, round int) (*string, error) {
+	query := `
+		SELECT snapshot
+		FROM review_rounds
+		WHERE project_directory = ? AND file_path = ? AND round = ?`
+	logQuery(query, projectDir, filePath, round)
+
+	var snapshot *string
+	err := db.QueryRow(query, projectDir, filePath, round).Scan(&snapshot)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return snapshot, err
+}
+
+// countDrafts returns the number of unsubmitted draft comments on a file
+func countDrafts(projectDir, filePath string) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM comments
+		WHERE project_directory = ? AND file_path = ? AND draft = 1 AND deleted_at IS NULL`
+	logQuery(query, projectDir, filePath)
 
 	var count int
-	err := db.QueryRow(query, commentID).Scan(&count)
+	err := db.QueryRow(query, projectDir, filePath).Scan(&count)
+	return count, err
+}
+
+// getAwaitingComments returns the published reviewer messages of a project that the agent hasn't answered yet:
+// those after the last agent reply in each unresolved thread, ordered by file and thread
+func getAwaitingComments(projectDir string) ([]Comment, error) {
+	query := `
+		SELECT id, project_directory, file_path, line_start, line_end, selected_text, comment_text, created_at, resolved_at, root_id, author, COALESCE(author_name, ''), COALESCE(agent_id, ''), resolved_by, COALESCE(resolved_agent_id, ''), edited_at, draft, review_round
+		FROM comments
+		WHERE project_directory = ? AND resolved_at IS NULL AND deleted_at IS NULL AND draft = 0
+		ORDER BY file_path ASC, COALESCE(root_id, id) ASC, created_at ASC`
+	logQuery(query, projectDir)
+	rows, err := db.Query(query, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var comments []Comment
+	for rows.Next() {
+		var c Comment
+		if err := rows.Scan(&c.ID, &c.ProjectDirectory, &c.FilePath, &c.LineStart, &c.LineEnd, &c.SelectedText,
+			&c.CommentText, &c.CreatedAt, &c.ResolvedAt, &c.RootID, &c.Author, &c.AuthorName, &c.AgentID, &c.ResolvedBy,
+			&c.ResolvedAgentID, &c.EditedAt, &c.Draft, &c.ReviewRound); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var awaiting []Comment
+	for _, thread := range groupCommentsByThread(comments) {
+		last := len(thread)
+		for last > 0 && thread[last-1].Author == "user" {
+			last--
+		}
+		awaiting = append(awaiting, thread[last:]...)
+	}
+	return awaiting, nil
+}
+
+// recordHookNotices remembers that a Claude Code session has been told about the given comments, and returns the
+// ones it hadn't been told about before
+func recordHookNotices(sessionID string, comments []Comment) ([]Comment, error) {
+	tx, err := db.Begin()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
+	defer func() { _ = tx.Rollback() }()
 
-	return count > 0, nil
+	query := "INSERT OR IGNORE INTO hook_notices (session_id, comment_id) VALUES (?, ?)"
+	var unseen []Comment
+	for _, c := range comments {
+		logQuery(query, sessionID, c.ID)
+		result, err := tx.Exec(query, sessionID, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			unseen = append(unseen, c)
+		}
+	}
+
+	return unseen, tx.Commit()
+}
+
+// allowProjectConfig records that the user allowed the version of a project's configuration with the given hash to
+// run commands. An empty hash revokes the permission.
+func allowProjectConfig(projectDir, hash string) error {
+	if hash == "" {
+		query := "DELETE FROM allowed_configs WHERE project_directory = ?"
+		logQuery(query, projectDir)
+		_, err := db.Exec(query, projectDir)
+		return err
+	}
+
+	query := `
+		INSERT INTO allowed_configs (project_directory, sha256, allowed_at) VALUES (?, ?, ?)
+		ON CONFLICT (project_directory) DO UPDATE SET sha256 = excluded.sha256, allowed_at = excluded.allowed_at`
+	now := time.Now()
+	logQuery(query, projectDir, hash, now)
+	_, err := db.Exec(query, projectDir, hash, now)
+	return err
+}
+
+// getAllowedConfigHash returns the hash of the project configuration the user last allowed, or "" if none
+func getAllowedConfigHash(projectDir string) (string, error) {
+	query := "SELECT sha256 FROM allowed_configs WHERE project_directory = ?"
+	logQuery(query, projectDir)
+
+	var hash string
+	err := db.QueryRow(query, projectDir).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return hash, err
+}
+
+func createVerdict(v *Verdict) error {
+	v.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO verdicts (project_directory, file_path, status, author_name, note, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	logQuery(query, v.ProjectDirectory, v.FilePath, v.Status, v.AuthorName, v.Note, v.CreatedAt)
+	result, err := db.Exec(query, v.ProjectDirectory, v.FilePath, v.Status, v.AuthorName, v.Note, v.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	v.ID = int(id)
+
+	return nil
+}
+
+// getVerdicts returns the verdict history of a file, oldest first
+func getVerdicts(projectDir, filePath string) ([]Verdict, error) {
+	query := `
+		SELECT id, project_directory, file_path, status, COALESCE(author_name, ''), COALESCE(note, ''), created_at
+		FROM verdicts
+		WHERE project_directory = ? AND file_path = ?
+		ORDER BY created_at ASC, id ASC`
+	logQuery(query, projectDir, filePath)
+	rows, err := db.Query(query, projectDir, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	verdicts := []Verdict{}
+	for rows.Next() {
+		var v Verdict
+		if err := rows.Scan(&v.ID, &v.ProjectDirectory, &v.FilePath, &v.Status, &v.AuthorName, &v.Note, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		verdicts = append(verdicts, v)
+	}
+
+	return verdicts, rows.Err()
+}
+
+// States an agent reports while it works through threads
+const (
+	threadWorking = "working"
+	threadDone    = "done"
+	threadBlocked = "blocked"
+)
+
+// ThreadStatus is the progress an agent last reported on a thread
+type ThreadStatus struct {
+	ThreadID  int       `json:"thread_id"`
+	State     string    `json:"state"`
+	Note      string    `json:"note,omitempty"`
+	AgentID   string    `json:"agent_id,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// setThreadStatus records the progress of an agent on a thread, replacing what it reported before
+func setThreadStatus(s *ThreadStatus) error {
+	s.UpdatedAt = time.Now()
+
+	query := `
+		INSERT INTO thread_statuses (root_id, state, note, agent_id, updated_at)
+		VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), ?)
+		ON CONFLICT (root_id) DO UPDATE SET
+			state = excluded.state, note = excluded.note, agent_id = excluded.agent_id, updated_at = excluded.updated_at`
+	logQuery(query, s.ThreadID, s.State, s.Note, s.AgentID, s.UpdatedAt)
+	_, err := db.Exec(query, s.ThreadID, s.State, s.Note, s.AgentID, s.UpdatedAt)
+	return err
+}
+
+// getThreadStatuses returns the statuses of the threads of a file by thread ID
+func getThreadStatuses(projectDir, filePath string) (map[int]ThreadStatus, error) {
+	query := `
+		SELECT s.root_id, s.state, COALESCE(s.note, ''), COALESCE(s.agent_id, ''), s.updated_at
+		FROM thread_statuses s
+		JOIN comments c ON c.id = s.root_id AND c.deleted_at IS NULL
+		WHERE c.project_directory = ? AND c.file_path = ?`
+	logQuery(query, projectDir, filePath)
+	rows, err := db.Query(query, projectDir, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	statuses := make(map[int]ThreadStatus)
+	for rows.Next() {
+		var s ThreadStatus
+		if err := rows.Scan(&s.ThreadID, &s.State, &s.Note, &s.AgentID, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		statuses[s.ThreadID] = s
+	}
+
+	return statuses, rows.Err()
+}
+
+// WebhookDelivery is a webhook request in the delivery queue. Delivered requests are removed from the queue; the ones
+// that were given up on are kept with failed_at set.
+type WebhookDelivery struct {
+	ID            int
+	URL           string
+	Event         string
+	Payload       string
+	Signature     string // Empty when the webhook has no secret
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	CreatedAt     time.Time
+}
+
+// enqueueWebhookDeliveries adds requests to the delivery queue, due immediately. Queue times are kept in UTC so that
+// they compare correctly as text.
+func enqueueWebhookDeliveries(deliveries []WebhookDelivery) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now().UTC()
+	query := `
+		INSERT INTO webhook_deliveries (url, event, payload, signature, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	for _, d := range deliveries {
+		logQuery(query, d.URL, d.Event, d.Payload, d.Signature, now, now)
+		if _, err := tx.Exec(query, d.URL, d.Event, d.Payload, d.Signature, now, now); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// getDueWebhookDeliveries returns up to limit queued requests whose next attempt is due, oldest first
+func getDueWebhookDeliveries(limit int) ([]WebhookDelivery, error) {
+	query := `
+		SELECT id, url, event, payload, COALESCE(signature, ''), attempts, next_attempt_at, COALESCE(last_error, ''), created_at
+		FROM webhook_deliveries
+		WHERE failed_at IS NULL AND next_attempt_at <= ?
+		ORDER BY id ASC
+		LIMIT ?`
+	now := time.Now().UTC()
+	logQuery(query, now, limit)
+	rows, err := db.Query(query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.URL, &d.Event, &d.Payload, &d.Signature, &d.Attempts, &d.NextAttemptAt, &d.LastError, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// deleteWebhookDelivery removes a delivered request from the queue
+func deleteWebhookDelivery(id int) error {
+	query := "DELETE FROM webhook_deliveries WHERE id = ?"
+	logQuery(query, id)
+	_, err := db.Exec(query, id)
+	return err
+}
+
+// recordWebhookFailure records a failed delivery attempt. The request is tried again at retryAt, or given up on if
+// retryAt is nil.
+func recordWebhookFailure(id, attempts int, lastError string, retryAt *time.Time) error {
+	if retryAt == nil {
+		query := "UPDATE webhook_deliveries SET attempts = ?, last_error = ?, failed_at = ? WHERE id = ?"
+		now := time.Now().UTC()
+		logQuery(query, attempts, lastError, now, id)
+		_, err := db.Exec(query, attempts, lastError, now, id)
+		return err
+	}
+
+	query := "UPDATE webhook_deliveries SET attempts = ?, last_error = ?, next_attempt_at = ? WHERE id = ?"
+	next := retryAt.UTC()
+	logQuery(query, attempts, lastError, next, id)
+	_, err := db.Exec(query, attempts, lastError, next, id)
+	return err
+}
+
+// Statuses of autopilot jobs
+const (
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+// AutopilotJob is a run of a project's autopilot command on a file
+type AutopilotJob struct {
+	ID               int        `json:"id"`
+	ProjectDirectory string     `json:"project_directory"`
+	FilePath         string     `json:"file_path"`
+	Command          string     `json:"command"`
+	Status           string     `json:"status"`
+	Output           string     `json:"output,omitempty"` // Combined stdout and stderr, set when the job finishes
+	StartedAt        time.Time  `json:"started_at"`
+	FinishedAt       *time.Time `json:"finished_at,omitempty"`
+}
+
+// createAutopilotJob records a job that is starting now
+func createAutopilotJob(j *AutopilotJob) error {
+	j.Status = jobRunning
+	j.StartedAt = time.Now()
+
+	query := `
+		INSERT INTO autopilot_jobs (project_directory, file_path, command, status, started_at)
+		VALUES (?, ?, ?, ?, ?)`
+	logQuery(query, j.ProjectDirectory, j.FilePath, j.Command, j.Status, j.StartedAt)
+	result, err := db.Exec(query, j.ProjectDirectory, j.FilePath, j.Command, j.Status, j.StartedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	j.ID = int(id)
+
+	return nil
+}
+
+// finishAutopilotJob records the status and output of a job that has finished now
+func finishAutopilotJob(j *AutopilotJob, status, output string) error {
+	now := time.Now()
+	query := "UPDATE autopilot_jobs SET status = ?, output = ?, finished_at = ? WHERE id = ?"
+	logQuery(query, status, output, now, j.ID)
+	if _, err := db.Exec(query, status, output, now, j.ID); err != nil {
+		return err
+	}
+
+	j.Status = status
+	j.Output = output
+	j.FinishedAt = &now
+	return nil
+}
+
+// failInterruptedAutopilotJobs marks jobs that were still running when the server stopped as failed
+func failInterruptedAutopilotJobs() error {
+	query := "UPDATE autopilot_jobs SET status = ?, output = COALESCE(output, '') || ?, finished_at = ? WHERE status = ?"
+	now := time.Now()
+	logQuery(query, jobFailed, "(interrupted by a server restart)", now, jobRunning)
+	_, err := db.Exec(query, jobFailed, "(interrupted by a server restart)", now, jobRunning)
+	return err
+}
+
+// getAutopilotJobs returns the latest jobs of a project, or of one of its files if filePath isn't empty, newest first
+func getAutopilotJobs(projectDir, filePath string, limit int) ([]AutopilotJob, error) {
+	query := `
+		SELECT id, project_directory, file_path, command, status, COALESCE(output, ''), started_at, finished_at
+		FROM autopilot_jobs
+		WHERE project_directory = ? AND (? = '' OR file_path = ?)
+		ORDER BY started_at DESC, id DESC
+		LIMIT ?`
+	logQuery(query, projectDir, filePath, filePath, limit)
+	rows, err := db.Query(query, projectDir, filePath, filePath, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	jobs := []AutopilotJob{}
+	for rows.Next() {
+		var j AutopilotJob
+		if err := rows.Scan(&j.ID, &j.ProjectDirectory, &j.FilePath, &j.Command, &j.Status, &j.Output, &j.StartedAt, &j.FinishedAt); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+
+	return jobs, rows.Err()
+}
+
+// getAutopilotJob returns a job by ID, or nil if it doesn't exist
+func getAutopilotJob(id int) (*AutopilotJob, error) {
+	query := `
+		SELECT id, project_directory, file_path, command, status, COALESCE(output, ''), started_at, finished_at
+		FROM autopilot_jobs
+		WHERE id = ?`
+	logQuery(query, id)
+
+	var j AutopilotJob
+	err := db.QueryRow(query, id).Scan(
+		&j.ID, &j.ProjectDirectory, &j.FilePath, &j.Command, &j.Status, &j.Output, &j.StartedAt, &j.FinishedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// FileReviewState summarizes the open review feedback of one file
+type FileReviewState struct {
+	FilePath          string
+	UnresolvedThreads int
+	Verdict           *Verdict // Latest verdict, nil when the file has none
+}
+
+// NeedsAttention reports whether the file has unresolved threads or a verdict other than approved
+func (s *FileReviewState) NeedsAttention() bool {
+	return s.UnresolvedThreads > 0 || (s.Verdict != nil && s.Verdict.Status != statusApproved)
+}
+
+// getReviewStates returns the review state of every file of a project that has comments or verdicts, keyed by
+// file path. Drafts don't count as unresolved threads since the agent can't see them yet.
+func getReviewStates(projectDir string) (map[string]*FileReviewState, error) {
+	states := make(map[string]*FileReviewState)
+	state := func(filePath string) *FileReviewState {
+		if states[filePath] == nil {
+			states[filePath] = &FileReviewState{FilePath: filePath}
+		}
+		return states[filePath]
+	}
+
+	query := `
+		SELECT file_path, COUNT(*)
+		FROM comments
+		WHERE project_directory = ? AND root_id IS NULL AND resolved_at IS NULL AND deleted_at IS NULL AND draft = 0
+		GROUP BY file_path`
+	logQuery(query, projectDir)
+	rows, err := db.Query(query, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var filePath string
+		var count int
+		if err := rows.Scan(&filePath, &count); err != nil {
+			return nil, err
+		}
+		state(filePath).UnresolvedThreads = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT id, project_directory, file_path, status, COALESCE(author_name, ''), COALESCE(note, ''), created_at
+		FROM verdicts v
+		WHERE project_directory = ? AND id = (
+			SELECT id FROM verdicts
+			WHERE project_directory = v.project_directory AND file_path = v.file_path
+			ORDER BY created_at DESC, id DESC
+			LIMIT 1
+		)`
+	logQuery(query, projectDir)
+	verdictRows, err := db.Query(query, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = verdictRows.Close() }()
+
+	for verdictRows.Next() {
+		var v Verdict
+		if err := verdictRows.Scan(&v.ID, &v.ProjectDirectory, &v.FilePath, &v.Status, &v.AuthorName, &v.Note,
+			&v.CreatedAt); err != nil {
+			return nil, err
+		}
+		state(v.FilePath).Verdict = &v
+	}
+
+	return states, verdictRows.Err()
 }
 
 // renderCommentsAsHTML renders the comment_text field of each comment as HTML
@@ -342,3 +1315,166 @@ func renderCommentsAsHTML(comments []Comment) error {
 	}
 	return nil
 }
+
+// DBCheckReport lists the consistency problems found in the database
+type DBCheckReport struct {
+	IntegrityErrors      []string
+	OrphanedReplies      []Comment      // Replies whose root comment no longer exists
+	UnregisteredProjects []string       // Project directories referenced by comments but not registered
+	MissingProjects      map[string]int // Registered projects whose directory is gone, with their comment count
+}
+
+// HasProblems reports whether the check found anything to repair
+func (r *DBCheckReport) HasProblems() bool {
+	return len(r.IntegrityErrors) > 0 || len(r.OrphanedReplies) > 0 ||
+		len(r.UnregisteredProjects) > 0 || len(r.MissingProjects) > 0
+}
+
+// checkDB looks for integrity errors, orphaned replies and dangling projects
+func checkDB() (*DBCheckReport, error) {
+	report := &DBCheckReport{MissingProjects: make(map[string]int)}
+
+	query := "PRAGMA integrity_check"
+	logQuery(query)
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		if result != "ok" {
+			report.IntegrityErrors = append(report.IntegrityErrors, result)
+		}
+	}
+	_ = rows.Close()
+
+	query = `
+		SELECT r.id, r.project_directory, r.file_path, r.line_start, r.line_end, COALESCE(r.selected_text, ''), r.comment_text, r.created_at, r.resolved_at, r.root_id, r.author, r.resolved_by
+		FROM comments r
+		LEFT JOIN comments root ON root.id = r.root_id
+		WHERE r.root_id IS NOT NULL AND root.id IS NULL
+		ORDER BY r.id`
+	logQuery(query)
+	rows, err = db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var c Comment
+		if err := rows.Scan(&c.ID, &c.ProjectDirectory, &c.FilePath, &c.LineStart, &c.LineEnd, &c.SelectedText, &c.CommentText, &c.CreatedAt, &c.ResolvedAt, &c.RootID, &c.Author, &c.ResolvedBy); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		report.OrphanedReplies = append(report.OrphanedReplies, c)
+	}
+	_ = rows.Close()
+
+	query = `
+		SELECT DISTINCT c.project_directory
+		FROM comments c
+		LEFT JOIN projects p ON p.directory = c.project_directory
+		WHERE p.directory IS NULL
+		ORDER BY c.project_directory`
+	logQuery(query)
+	rows, err = db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var directory string
+		if err := rows.Scan(&directory); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		report.UnregisteredProjects = append(report.UnregisteredProjects, directory)
+	}
+	_ = rows.Close()
+
+	projects, err := getAllProjects()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range projects {
+		if info, err := os.Stat(p.Directory); err == nil && info.IsDir() {
+			continue
+		}
+
+		var count int
+		query = "SELECT COUNT(*) FROM comments WHERE project_directory = ?"
+		logQuery(query, p.Directory)
+		if err := db.QueryRow(query, p.Directory).Scan(&count); err != nil {
+			return nil, err
+		}
+		report.MissingProjects[p.Directory] = count
+	}
+
+	return report, nil
+}
+
+// repairDB fixes the problems found by checkDB: orphaned replies are deleted and unregistered projects are
+// registered. Projects whose directory is gone are left alone, as the directory may only have been moved or be on a
+// disk that isn't mounted; pruneMissingProjects deletes them. Integrity errors can't be repaired here.
+func repairDB(report *DBCheckReport) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, c := range report.OrphanedReplies {
+		query := "DELETE FROM comments WHERE id = ?"
+		logQuery(query, c.ID)
+		if _, err := tx.Exec(query, c.ID); err != nil {
+			return err
+		}
+	}
+
+	for _, directory := range report.UnregisteredProjects {
+		query := "INSERT OR IGNORE INTO projects (directory) VALUES (?)"
+		logQuery(query, directory)
+		if _, err := tx.Exec(query, directory); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// pruneMissingProjects removes the projects found by checkDB whose directory is gone, together with their comments
+// and everything else recorded about them
+func pruneMissingProjects(report *DBCheckReport) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Everything that refers to a comment goes before the comments, and everything that refers to the project before
+	// the project. Replies go before their roots, so that deleting the roots doesn't depend on the cascade order.
+	queries := []string{
+		"DELETE FROM comment_revisions WHERE comment_id IN (SELECT id FROM comments WHERE project_directory = ?)",
+		"DELETE FROM hook_notices WHERE comment_id IN (SELECT id FROM comments WHERE project_directory = ?)",
+		"DELETE FROM thread_statuses WHERE root_id IN (SELECT id FROM comments WHERE project_directory = ?)",
+		"DELETE FROM comments WHERE project_directory = ? AND root_id IS NOT NULL",
+		"DELETE FROM comments WHERE project_directory = ?",
+		"DELETE FROM verdicts WHERE project_directory = ?",
+		"DELETE FROM review_rounds WHERE project_directory = ?",
+		"DELETE FROM autopilot_jobs WHERE project_directory = ?",
+		"DELETE FROM allowed_configs WHERE project_directory = ?",
+		"DELETE FROM projects WHERE directory = ?",
+	}
+	for directory := range report.MissingProjects {
+		for _, query := range queries {
+			logQuery(query, directory)
+			if _, err := tx.Exec(query, directory); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
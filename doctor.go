@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// doctorReport prints the findings of the doctor command and counts the problems
+type doctorReport struct {
+	problems int
+}
+
+func (r *doctorReport) ok(format string, args ...interface{}) {
+	fmt.Printf("  ok    "+format+"\n", args...)
+}
+
+func (r *doctorReport) note(format string, args ...interface{}) {
+	fmt.Printf("  note  "+format+"\n", args...)
+}
+
+func (r *doctorReport) problem(format string, args ...interface{}) {
+	r.problems++
+	fmt.Printf("  FAIL  "+format+"\n", args...)
+}
+
+func runDoctor() {
+	executable, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Failed to locate claude-review executable: %v", err)
+	}
+	fmt.Printf("claude-review %s (%s)\n", Version, executable)
+
+	report := &doctorReport{}
+
+	fmt.Println("\nPATH:")
+	checkPath(report, executable)
+
+	fmt.Println("\nSlash commands:")
+	checkSlashCommands(report)
+
+	fmt.Println("\nServer:")
+	checkServerVersion(report)
+
+	fmt.Println("\nDatabase:")
+	checkDatabase(report)
+
+	if report.problems == 0 {
+		fmt.Println("\nNo problems found")
+		return
+	}
+	fmt.Printf("\n%d problem(s) found\n", report.problems)
+	os.Exit(1)
+}
+
+// checkPath verifies that the slash commands, which run claude-review from the PATH, get this binary
+func checkPath(report *doctorReport, executable string) {
+	found, err := exec.LookPath("claude-review")
+	if err != nil {
+		report.problem("claude-review is not on your PATH, so the slash commands can't run it")
+		return
+	}
+
+	foundInfo, err := os.Stat(found)
+	if err != nil {
+		report.problem("failed to inspect %s: %v", found, err)
+		return
+	}
+	executableInfo, err := os.Stat(executable)
+	if err != nil {
+		report.problem("failed to inspect %s: %v", executable, err)
+		return
+	}
+	if !os.SameFile(foundInfo, executableInfo) {
+		report.problem("claude-review on your PATH is %s, not this binary", found)
+		return
+	}
+	report.ok("claude-review on your PATH is this binary")
+}
+
+// checkSlashCommands reports slash commands installed by other versions of claude-review, for the user and the
+// current project. A command only needs to be installed in one of the two.
+func checkSlashCommands(report *doctorReport) {
+	commands, err := embeddedSlashCommands()
+	if err != nil {
+		report.problem("failed to read embedded slash commands: %v", err)
+		return
+	}
+
+	var dirs []string
+	for _, project := range []bool{false, true} {
+		dir, err := slashCommandsDir(project)
+		if err != nil {
+			report.problem("%v", err)
+			return
+		}
+		dirs = append(dirs, dir)
+	}
+
+	for _, command := range commands {
+		installed := false
+		for _, dir := range dirs {
+			existing, err := readInstalledCommand(filepath.Join(dir, command.Filename))
+			if err != nil {
+				report.problem("%v", err)
+				continue
+			}
+			if existing == nil {
+				continue
+			}
+			installed = true
+
+			switch {
+			case existing.Version == "":
+				report.problem("%s was installed by an older version; run claude-review install", existing.Path)
+			case existing.Version != Version:
+				report.problem("%s is from version %s, this is %s; run claude-review install", existing.Path,
+					existing.Version, Version)
+			case existing.Modified:
+				report.note("%s is up to date, with your modifications", existing.Path)
+			default:
+				report.ok("%s is up to date", existing.Path)
+			}
+		}
+
+		if !installed {
+			report.problem("%s is not installed; run claude-review install", command.Filename)
+		}
+	}
+}
+
+// checkServerVersion compares the version of the running server with this binary's
+func checkServerVersion(report *doctorReport) {
+	port := os.Getenv("CR_LISTEN_PORT")
+	if port == "" {
+		port = "4779"
+	}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get("http://localhost:" + port + "/api/version")
+	if err != nil {
+		report.note("server is not running on port %s (claude-review review starts it)", port)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var result struct {
+		Version string `json:"version"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&result) != nil {
+		report.problem("server on port %s predates version reporting; restart it with claude-review server --stop",
+			port)
+		return
+	}
+	if result.Version != Version {
+		report.problem("server on port %s runs version %s, this is %s; restart it with claude-review server --stop",
+			port, result.Version, Version)
+		return
+	}
+	report.ok("server on port %s runs this version", port)
+}
+
+// checkDatabase summarizes the db check command
+func checkDatabase(report *doctorReport) {
+	if err := initDB(); err != nil {
+		report.problem("failed to open the database: %v", err)
+		return
+	}
+
+	dbReport, err := checkDB()
+	if err != nil {
+		report.problem("failed to check the database: %v", err)
+		return
+	}
+	if dbReport.HasProblems() {
+		report.problem("the database has inconsistencies; run claude-review db check for details")
+		return
+	}
+	report.ok("the database is consistent")
+}
@@ -0,0 +1,255 @@
+package main_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type autopilotJob struct {
+	ID         int        `json:"id"`
+	Status     string     `json:"status"`
+	Output     string     `json:"output"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+func (env *TestEnv) getAutopilotJobs(t *testing.T) []autopilotJob {
+	t.Helper()
+
+	resp, err := http.Get(fmt.Sprintf("%s/api/autopilot?project_directory=%s&file_path=test.md", env.BaseURL,
+		url.QueryEscape(env.ProjectDir)))
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var jobs []autopilotJob
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&jobs))
+	return jobs
+}
+
+// waitForAutopilotEvent waits for the next autopilot event on an SSE stream and returns the event name and job
+func waitForAutopilotEvent(t *testing.T, events <-chan [2]string, timeout time.Duration) (string, autopilotJob) {
+	t.Helper()
+
+	deadline := time.After(timeout)
+	for {
+		select {
+		case event := <-events:
+			if !strings.HasPrefix(event[0], "autopilot_") {
+				continue
+			}
+			var job autopilotJob
+			require.NoError(t, json.Unmarshal([]byte(event[1]), &job))
+			return event[0], job
+		case <-deadline:
+			t.Fatal("Timed out waiting for autopilot event")
+			return "", autopilotJob{}
+		}
+	}
+}
+
+func TestE2E_Autopilot(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	// The command sees the feedback the way an agent would
+	env.writeProjectConfig(t, fmt.Sprintf(`
+[autopilot]
+command = '%s address --file "$CR_FILE_PATH"; sleep 1'
+settle_seconds = 1
+`, env.BinaryPath))
+	env.allowProjectConfig(t)
+
+	sseResp, err := http.Get(fmt.Sprintf("%s/api/events?project_directory=%s&file_path=test.md", env.BaseURL,
+		url.QueryEscape(env.ProjectDir)))
+	require.NoError(t, err)
+	defer func() { _ = sseResp.Body.Close() }()
+	events := make(chan [2]string, 20)
+	go func() {
+		scanner := bufio.NewScanner(sseResp.Body)
+		var name string
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "event: ") {
+				name = strings.TrimPrefix(line, "event: ")
+			} else if strings.HasPrefix(line, "data: ") {
+				events <- [2]string{name, strings.TrimPrefix(line, "data: ")}
+			}
+		}
+	}()
+
+	var firstJob autopilotJob
+	t.Run("submitting a review starts a job", func(t *testing.T) {
+		resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"line_start":        1,
+			"line_end":          1,
+			"selected_text":     "Test Document",
+			"comment_text":      "Please expand",
+			"draft":             true,
+		})
+		_ = resp.Body.Close()
+		resp = env.postJSON(t, "/api/reviews", map[string]string{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+		})
+		_ = resp.Body.Close()
+
+		event, job := waitForAutopilotEvent(t, events, 5*time.Second)
+		assert.Equal(t, "autopilot_started", event)
+		assert.Equal(t, "running", job.Status)
+
+		event, job = waitForAutopilotEvent(t, events, 10*time.Second)
+		assert.Equal(t, "autopilot_finished", event)
+		assert.Equal(t, "succeeded", job.Status)
+		firstJob = job
+
+		jobs := env.getAutopilotJobs(t)
+		require.Len(t, jobs, 1)
+		assert.Contains(t, jobs[0].Output, "Please expand")
+	})
+
+	t.Run("jobs can be inspected from the CLI", func(t *testing.T) {
+		output, err := env.runCLI(t, "autopilot", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, fmt.Sprintf("%d  succeeded", firstJob.ID))
+
+		output, err = env.runCLI(t, "autopilot", "--job", fmt.Sprintf("%d", firstJob.ID))
+		require.NoError(t, err)
+		assert.Contains(t, output, "address --file")
+		assert.Contains(t, output, "Please expand")
+	})
+
+	t.Run("new comments start a job once they settle, one job at a time", func(t *testing.T) {
+		var rootID int
+		for i, text := range []string{"First", "Second"} {
+			resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+				"project_directory": env.ProjectDir,
+				"file_path":         "test.md",
+				"line_start":        3,
+				"line_end":          3,
+				"selected_text":     "This is a test paragraph",
+				"comment_text":      text,
+			})
+			var comment map[string]interface{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&comment))
+			_ = resp.Body.Close()
+			rootID = int(comment["id"].(float64))
+			if i == 0 {
+				time.Sleep(300 * time.Millisecond)
+			}
+		}
+
+		// Both comments are handled by a single job
+		event, _ := waitForAutopilotEvent(t, events, 5*time.Second)
+		require.Equal(t, "autopilot_started", event)
+
+		// A comment arriving while the job runs starts another job when it's done
+		resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"comment_text":      "And another thing",
+			"root_id":           rootID,
+		})
+		_ = resp.Body.Close()
+
+		// Agent replies don't start jobs
+		_, err := env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", rootID), "--message", "On it")
+		require.NoError(t, err)
+
+		event, _ = waitForAutopilotEvent(t, events, 10*time.Second)
+		require.Equal(t, "autopilot_finished", event)
+		event, _ = waitForAutopilotEvent(t, events, 10*time.Second)
+		require.Equal(t, "autopilot_started", event)
+		event, _ = waitForAutopilotEvent(t, events, 10*time.Second)
+		require.Equal(t, "autopilot_finished", event)
+
+		// Wait out the settle time of the agent reply, which must not start a job
+		time.Sleep(1500 * time.Millisecond)
+		jobs := env.getAutopilotJobs(t)
+		require.Len(t, jobs, 3)
+		require.NotNil(t, jobs[1].FinishedAt)
+		assert.False(t, jobs[0].StartedAt.Before(*jobs[1].FinishedAt), "jobs for a file must not overlap")
+	})
+
+	t.Run("failed jobs are recorded", func(t *testing.T) {
+		env.writeProjectConfig(t, `
+[autopilot]
+command = "echo giving up; exit 2"
+`)
+		env.allowProjectConfig(t)
+		resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"comment_text":      "Whole document feedback",
+			"draft":             true,
+		})
+		_ = resp.Body.Close()
+		resp = env.postJSON(t, "/api/reviews", map[string]string{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+		})
+		_ = resp.Body.Close()
+
+		waitForAutopilotEvent(t, events, 5*time.Second)
+		event, job := waitForAutopilotEvent(t, events, 5*time.Second)
+		require.Equal(t, "autopilot_finished", event)
+		assert.Equal(t, "failed", job.Status)
+
+		jobs := env.getAutopilotJobs(t)
+		assert.Contains(t, jobs[0].Output, "giving up")
+		assert.Contains(t, jobs[0].Output, "exit status 2")
+
+		// The viewer shows the state of the latest job
+		pageResp, err := http.Get(fmt.Sprintf("%s/projects%s/test.md", env.BaseURL, env.ProjectDir))
+		require.NoError(t, err)
+		defer func() { _ = pageResp.Body.Close() }()
+		var page strings.Builder
+		_, err = bufio.NewReader(pageResp.Body).WriteTo(&page)
+		require.NoError(t, err)
+		assert.Contains(t, page.String(), `"status":"failed"`)
+	})
+}
+
+func TestE2E_Autopilot_NeedsAllowing(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	env.writeProjectConfig(t, `
+[autopilot]
+command = "echo should not run"
+`)
+	resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+		"project_directory": env.ProjectDir,
+		"file_path":         "test.md",
+		"comment_text":      "Whole document feedback",
+		"draft":             true,
+	})
+	_ = resp.Body.Close()
+	resp = env.postJSON(t, "/api/reviews", map[string]string{
+		"project_directory": env.ProjectDir,
+		"file_path":         "test.md",
+	})
+	_ = resp.Body.Close()
+
+	require.Eventually(t, func() bool {
+		logs, err := os.ReadFile(env.LogFile)
+		return err == nil && strings.Contains(string(logs), "Not running autopilot: "+
+			filepath.Join(env.ProjectDir, ".claude-review.toml")+" is not allowed to run commands")
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Empty(t, env.getAutopilotJobs(t))
+}
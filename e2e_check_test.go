@@ -0,0 +1,190 @@
+package main_test
+
+import (
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// git runs a git command in the test project, with the test environment's data directory for hooks
+func (env *TestEnv) git(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = env.ProjectDir
+	cmd.Env = append(os.Environ(),
+		"CR_DATA_DIR="+env.DataDir,
+		"CR_LISTEN_PORT="+env.Port,
+		"GIT_AUTHOR_NAME=Test",
+		"GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test",
+		"GIT_COMMITTER_EMAIL=test@example.com",
+	)
+
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+func TestE2E_Check(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	_, err = env.git(t, "init", "-q")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(env.ProjectDir, "other.md"), []byte("# Other\n"), 0644))
+
+	t.Run("no feedback", func(t *testing.T) {
+		output, err := env.runCLI(t, "check", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, "No open review feedback")
+	})
+
+	resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+		"project_directory": env.ProjectDir,
+		"file_path":         "test.md",
+		"line_start":        1,
+		"line_end":          1,
+		"selected_text":     "Test Document",
+		"comment_text":      "Rename this",
+	})
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	t.Run("unresolved threads are reported", func(t *testing.T) {
+		output, err := env.runCLI(t, "check", "--project", env.ProjectDir)
+		require.Error(t, err)
+		assert.Contains(t, output, "1 file(s) with open review feedback")
+		assert.Contains(t, output, "test.md: 1 unresolved thread(s)")
+	})
+
+	t.Run("staged only checks staged files", func(t *testing.T) {
+		_, err := env.git(t, "add", "other.md")
+		require.NoError(t, err)
+
+		output, err := env.runCLI(t, "check", "--staged", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, "No open review feedback")
+
+		_, err = env.git(t, "add", "test.md")
+		require.NoError(t, err)
+
+		output, err = env.runCLI(t, "check", "--staged", "--project", env.ProjectDir)
+		require.Error(t, err)
+		assert.Contains(t, output, "test.md: 1 unresolved thread(s)")
+		assert.NotContains(t, output, "other.md")
+	})
+
+	t.Run("non-approved verdicts are reported", func(t *testing.T) {
+		_, err := env.runCLI(t, "resolve", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		_, err = env.runCLI(t, "verdict", "--file", "other.md", "--project", env.ProjectDir, "--request-changes")
+		require.NoError(t, err)
+
+		output, err := env.runCLI(t, "check", "--project", env.ProjectDir)
+		require.Error(t, err)
+		assert.Contains(t, output, "other.md: changes requested")
+		assert.NotContains(t, output, "test.md")
+	})
+
+	t.Run("git hook blocks commits", func(t *testing.T) {
+		cmd := exec.Command(env.BinaryPath, "install", "--git-hook")
+		cmd.Dir = env.ProjectDir
+		cmd.Env = append(os.Environ(), "CR_DATA_DIR="+env.DataDir)
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+		assert.Contains(t, string(output), "Installed pre-commit hook")
+
+		hook, err := os.ReadFile(filepath.Join(env.ProjectDir, ".git", "hooks", "pre-commit"))
+		require.NoError(t, err)
+		assert.Contains(t, string(hook), "check --staged")
+
+		gitOutput, err := env.git(t, "commit", "-q", "-m", "Add docs")
+		require.Error(t, err, "Commit should be blocked")
+		assert.Contains(t, gitOutput, "other.md: changes requested")
+
+		_, err = env.runCLI(t, "verdict", "--file", "other.md", "--project", env.ProjectDir, "--approve")
+		require.NoError(t, err)
+
+		gitOutput, err = env.git(t, "commit", "-q", "-m", "Add docs")
+		require.NoError(t, err, gitOutput)
+	})
+
+	t.Run("foreign hooks are not overwritten", func(t *testing.T) {
+		hookPath := filepath.Join(env.ProjectDir, ".git", "hooks", "pre-commit")
+		require.NoError(t, os.WriteFile(hookPath, []byte("#!/bin/sh\nexit 0\n"), 0755))
+
+		cmd := exec.Command(env.BinaryPath, "install", "--git-hook")
+		cmd.Dir = env.ProjectDir
+		output, err := cmd.CombinedOutput()
+		require.Error(t, err)
+		assert.Contains(t, string(output), "already exists")
+
+		hook, err := os.ReadFile(hookPath)
+		require.NoError(t, err)
+		assert.False(t, strings.Contains(string(hook), "claude-review"))
+	})
+}
+
+func TestE2E_Check_StagedInSubproject(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// The repository root isn't a project, only its docs directory is
+	env := setupE2E(t)
+	docsDir := filepath.Join(env.ProjectDir, "docs")
+	require.NoError(t, os.Mkdir(docsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(docsDir, "plan.md"), []byte("# Plan\n"), 0644))
+	_, err := env.runCLI(t, "register", "--project", docsDir)
+	require.NoError(t, err)
+	_, err = env.git(t, "init", "-q")
+	require.NoError(t, err)
+
+	resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+		"project_directory": docsDir,
+		"file_path":         "plan.md",
+		"line_start":        1,
+		"line_end":          1,
+		"selected_text":     "Plan",
+		"comment_text":      "Add milestones",
+	})
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// A path that sh would expand or mangle if it were quoted like a Go string
+	binDir := filepath.Join(env.TempDir, "it's $HOME `x` \\ bin")
+	require.NoError(t, os.Mkdir(binDir, 0755))
+	binary, err := os.ReadFile(env.BinaryPath)
+	require.NoError(t, err)
+	binaryPath := filepath.Join(binDir, "claude-review")
+	require.NoError(t, os.WriteFile(binaryPath, binary, 0755))
+
+	cmd := exec.Command(binaryPath, "install", "--git-hook")
+	cmd.Dir = env.ProjectDir
+	cmd.Env = append(os.Environ(), "CR_DATA_DIR="+env.DataDir)
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+
+	_, err = env.git(t, "add", "docs/plan.md", "test.md")
+	require.NoError(t, err)
+	gitOutput, err := env.git(t, "commit", "-q", "-m", "Add plan")
+	require.Error(t, err, "Commit should be blocked")
+	assert.Contains(t, gitOutput, "plan.md: 1 unresolved thread(s)")
+	assert.NotContains(t, gitOutput, "test.md")
+
+	_, err = env.runCLI(t, "resolve", "--file", "plan.md", "--project", docsDir)
+	require.NoError(t, err)
+	gitOutput, err = env.git(t, "commit", "-q", "-m", "Add plan")
+	require.NoError(t, err, gitOutput)
+}
@@ -0,0 +1,225 @@
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runHook runs `claude-review hook <event>` the way Claude Code does, with the hook input on stdin
+func (env *TestEnv) runHook(t *testing.T, event string, input map[string]interface{}) string {
+	t.Helper()
+
+	data, err := json.Marshal(input)
+	require.NoError(t, err)
+
+	cmd := exec.Command(env.BinaryPath, "hook", event)
+	cmd.Stdin = strings.NewReader(string(data))
+	cmd.Env = append(os.Environ(),
+		"CR_DATA_DIR="+env.DataDir,
+		"CR_LISTEN_PORT="+env.Port,
+		"CLAUDE_PROJECT_DIR="+env.ProjectDir,
+		"GOCOVERDIR=tmp/coverage",
+	)
+
+	output, err := cmd.Output()
+	require.NoError(t, err)
+	return strings.TrimSpace(string(output))
+}
+
+func TestE2E_ClaudeCodeHooks(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	session := map[string]interface{}{"session_id": "session-a", "cwd": env.ProjectDir}
+
+	t.Run("nothing to announce", func(t *testing.T) {
+		assert.Empty(t, env.runHook(t, "user-prompt-submit", session))
+	})
+
+	var rootID int
+	for _, text := range []string{"First", "Second"} {
+		resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"line_start":        1,
+			"line_end":          1,
+			"selected_text":     "Test Document",
+			"comment_text":      text,
+		})
+		var root map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&root))
+		_ = resp.Body.Close()
+		rootID = int(root["id"].(float64))
+	}
+
+	// Drafts aren't announced
+	resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+		"project_directory": env.ProjectDir,
+		"file_path":         "simple.md",
+		"line_start":        1,
+		"line_end":          1,
+		"selected_text":     "Simple",
+		"comment_text":      "Draft",
+		"draft":             true,
+	})
+	_ = resp.Body.Close()
+
+	t.Run("new comments are announced once per session", func(t *testing.T) {
+		output := env.runHook(t, "user-prompt-submit", session)
+		assert.Equal(t,
+			"2 new review comment(s) awaiting you on test.md. Run /cr-address <file> to address them.", output)
+
+		assert.Empty(t, env.runHook(t, "user-prompt-submit", session))
+
+		other := map[string]interface{}{"session_id": "session-b"}
+		assert.Contains(t, env.runHook(t, "user-prompt-submit", other), "2 new review comment(s)")
+	})
+
+	t.Run("answered threads are not announced", func(t *testing.T) {
+		_, err := env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", rootID), "--message", "Done")
+		require.NoError(t, err)
+
+		// A new session only hears about the thread that hasn't been answered
+		output := env.runHook(t, "user-prompt-submit", map[string]interface{}{"session_id": "session-c"})
+		assert.Contains(t, output, "1 new review comment(s) awaiting you on test.md")
+
+		resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"comment_text":      "Not quite",
+			"root_id":           rootID,
+		})
+		_ = resp.Body.Close()
+	})
+
+	t.Run("stop hook asks the agent to continue", func(t *testing.T) {
+		active := map[string]interface{}{"session_id": "session-a", "stop_hook_active": true}
+		assert.Empty(t, env.runHook(t, "stop", active))
+
+		var output map[string]string
+		require.NoError(t, json.Unmarshal([]byte(env.runHook(t, "stop", session)), &output))
+		assert.Equal(t, "block", output["decision"])
+		assert.Contains(t, output["reason"], "1 new review comment(s) awaiting you on test.md")
+
+		// The agent is only held back once for the same comments
+		assert.Empty(t, env.runHook(t, "stop", session))
+	})
+
+	t.Run("stop hook never blocks without a session", func(t *testing.T) {
+		assert.Empty(t, env.runHook(t, "stop", map[string]interface{}{"cwd": env.ProjectDir}))
+		assert.Empty(t, env.runHook(t, "stop", map[string]interface{}{"cwd": env.ProjectDir}))
+	})
+}
+
+func TestE2E_CLI_InstallHooks(t *testing.T) {
+	tempDir := t.TempDir()
+	homeDir := filepath.Join(tempDir, "home")
+	projectDir := filepath.Join(tempDir, "project")
+	require.NoError(t, os.MkdirAll(filepath.Join(homeDir, ".claude"), 0755))
+	require.NoError(t, os.MkdirAll(projectDir, 0755))
+
+	// The hook command has to survive a shell, whatever the path of the binary
+	binaryPath := filepath.Join(tempDir, "it's $HOME", "claude-review")
+	buildCmd := exec.Command("go", "build", "-cover", "-o", binaryPath, ".")
+	require.NoError(t, buildCmd.Run())
+
+	install := func(t *testing.T, args ...string) string {
+		cmd := exec.Command(binaryPath, append([]string{"install", "--hooks"}, args...)...)
+		cmd.Dir = projectDir
+		cmd.Env = append(os.Environ(), "HOME="+homeDir, "GOCOVERDIR=tmp/coverage")
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+		return string(output)
+	}
+
+	type settingsFile struct {
+		Model string `json:"model"`
+		Hooks map[string][]struct {
+			Hooks []struct {
+				Command string `json:"command"`
+			} `json:"hooks"`
+		} `json:"hooks"`
+	}
+	readSettings := func(t *testing.T, path string) settingsFile {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var settings settingsFile
+		require.NoError(t, json.Unmarshal(data, &settings))
+		return settings
+	}
+
+	t.Run("user settings are merged", func(t *testing.T) {
+		settingsPath := filepath.Join(homeDir, ".claude", "settings.json")
+		existing := `{"model": "opus",
+			"hooks": {"Stop": [{"hooks": [{"type": "command", "command": "notify-send done"}]}]}}`
+		require.NoError(t, os.WriteFile(settingsPath, []byte(existing), 0644))
+
+		output := install(t)
+		assert.Contains(t, output, "Installed hooks for Stop and UserPromptSubmit to "+settingsPath)
+
+		// Installing again replaces the earlier hooks instead of adding more
+		install(t)
+
+		settings := readSettings(t, settingsPath)
+		assert.Equal(t, "opus", settings.Model)
+		require.Len(t, settings.Hooks["Stop"], 2)
+		assert.Equal(t, "notify-send done", settings.Hooks["Stop"][0].Hooks[0].Command)
+		quoted := "'" + strings.ReplaceAll(binaryPath, "'", `'\''`) + "'"
+		assert.Equal(t, quoted+" hook stop", settings.Hooks["Stop"][1].Hooks[0].Command)
+		require.Len(t, settings.Hooks["UserPromptSubmit"], 1)
+		assert.Equal(t, quoted+" hook user-prompt-submit", settings.Hooks["UserPromptSubmit"][0].Hooks[0].Command)
+
+		// Claude Code runs the command with a shell
+		cmd := exec.Command("sh", "-c", settings.Hooks["Stop"][1].Hooks[0].Command)
+		cmd.Stdin = strings.NewReader(`{"stop_hook_active": true}`)
+		cmd.Env = append(os.Environ(), "HOME="+homeDir, "GOCOVERDIR=tmp/coverage")
+		hookOutput, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(hookOutput))
+	})
+
+	t.Run("project settings", func(t *testing.T) {
+		install(t, "--project")
+
+		settings := readSettings(t, filepath.Join(projectDir, ".claude", "settings.json"))
+		assert.Len(t, settings.Hooks["Stop"], 1)
+		assert.Len(t, settings.Hooks["UserPromptSubmit"], 1)
+	})
+
+	t.Run("other hooks in the same group are kept", func(t *testing.T) {
+		settingsPath := filepath.Join(projectDir, ".claude", "settings.json")
+		existing := `{"hooks": {"Stop": [{"hooks": [
+			{"type": "command", "command": "notify-send done"},
+			{"type": "command", "command": "/old/claude-review hook stop"}]}]}}`
+		require.NoError(t, os.WriteFile(settingsPath, []byte(existing), 0644))
+
+		install(t, "--project")
+
+		settings := readSettings(t, settingsPath)
+		require.Len(t, settings.Hooks["Stop"], 2)
+		require.Len(t, settings.Hooks["Stop"][0].Hooks, 1)
+		assert.Equal(t, "notify-send done", settings.Hooks["Stop"][0].Hooks[0].Command)
+		assert.Contains(t, settings.Hooks["Stop"][1].Hooks[0].Command, "hook stop")
+
+		cmd := exec.Command(binaryPath, "uninstall", "--project")
+		cmd.Dir = projectDir
+		cmd.Env = append(os.Environ(), "HOME="+homeDir, "GOCOVERDIR=tmp/coverage")
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+		assert.Contains(t, string(output), "Removed 2 hook(s) from "+settingsPath)
+
+		settings = readSettings(t, settingsPath)
+		require.Len(t, settings.Hooks["Stop"], 1)
+		require.Len(t, settings.Hooks["Stop"][0].Hooks, 1)
+		assert.Equal(t, "notify-send done", settings.Hooks["Stop"][0].Hooks[0].Command)
+		assert.NotContains(t, settings.Hooks, "UserPromptSubmit")
+	})
+}
@@ -229,6 +229,14 @@ func TestE2E_CLI_UnknownCommand(t *testing.T) {
 	assert.Contains(t, output, "Unknown command")
 }
 
+func TestE2E_CLI_TUINeedsTerminal(t *testing.T) {
+	env := setupE2E(t)
+
+	output, err := env.runCLI(t, "tui", "--file", "test.md", "--project", env.ProjectDir)
+	require.Error(t, err)
+	assert.Contains(t, output, "tui needs an interactive terminal")
+}
+
 // TestE2E_CLI_NoCommand tests help output when no command is provided
 func TestE2E_CLI_NoCommand(t *testing.T) {
 	env := setupE2E(t)
@@ -419,4 +427,123 @@ func TestE2E_CLI_Install(t *testing.T) {
 			}
 		}
 	})
+
+	runInstall := func(t *testing.T, dir string, args ...string) string {
+		cmd := exec.Command(binaryPath, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"HOME="+homeDir,
+			"GOCOVERDIR=tmp/coverage",
+			// Keep a claude CLI installed on this machine out of the MCP server registration
+			"PATH=/usr/bin:/bin",
+		)
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+		return string(output)
+	}
+
+	t.Run("installed commands carry a version marker", func(t *testing.T) {
+		content, err := os.ReadFile(filepath.Join(homeDir, ".claude", "commands", "cr-review.md"))
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "<!-- claude-review version=dev sha256=")
+	})
+
+	t.Run("modified commands are kept unless forced", func(t *testing.T) {
+		testFile := filepath.Join(homeDir, ".claude", "commands", "cr-review.md")
+		content, err := os.ReadFile(testFile)
+		require.NoError(t, err)
+		modified := strings.Replace(string(content), "---\n\n", "---\n\nMy own instructions.\n\n", 1)
+		require.NoError(t, os.WriteFile(testFile, []byte(modified), 0644))
+
+		output := runInstall(t, tempDir, "install")
+		assert.Contains(t, output, "Successfully installed 1 slash command(s)")
+		assert.Contains(t, output, "kept 1 slash command(s) you modified")
+		assert.Contains(t, output, testFile)
+		content, err = os.ReadFile(testFile)
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "My own instructions.")
+
+		runInstall(t, tempDir, "install", "--force")
+		content, err = os.ReadFile(testFile)
+		require.NoError(t, err)
+		assert.NotContains(t, string(content), "My own instructions.")
+	})
+
+	t.Run("project install and uninstall", func(t *testing.T) {
+		projectDir := filepath.Join(tempDir, "project")
+		require.NoError(t, os.MkdirAll(projectDir, 0755))
+
+		output := runInstall(t, projectDir, "install", "--project")
+		commandsDir := filepath.Join(projectDir, ".claude", "commands")
+		assert.Contains(t, output, "Successfully installed 2 slash command(s) to "+commandsDir)
+		assert.FileExists(t, filepath.Join(commandsDir, "cr-address.md"))
+
+		output = runInstall(t, projectDir, "uninstall", "--project")
+		assert.Contains(t, output, "Removed 2 slash command(s) from "+commandsDir)
+		assert.NoFileExists(t, filepath.Join(commandsDir, "cr-address.md"))
+
+		// The user's commands are untouched
+		assert.FileExists(t, filepath.Join(homeDir, ".claude", "commands", "cr-address.md"))
+	})
+
+	t.Run("uninstall", func(t *testing.T) {
+		commandsDir := filepath.Join(homeDir, ".claude", "commands")
+		runInstall(t, tempDir, "install", "--hooks")
+		runInstall(t, tempDir, "install", "--mcp")
+
+		output := runInstall(t, tempDir, "uninstall")
+		assert.Contains(t, output, "Removed 2 slash command(s) from "+commandsDir)
+		assert.Contains(t, output, "Removed 2 hook(s) from "+filepath.Join(homeDir, ".claude", "settings.json"))
+		assert.Contains(t, output, `Unregistered MCP server "claude-review"`)
+		assert.NoFileExists(t, filepath.Join(commandsDir, "cr-review.md"))
+
+		settings, err := os.ReadFile(filepath.Join(homeDir, ".claude", "settings.json"))
+		require.NoError(t, err)
+		assert.NotContains(t, string(settings), "claude-review")
+	})
+}
+
+func TestE2E_CLI_Doctor(t *testing.T) {
+	env := setupE2E(t)
+
+	homeDir := filepath.Join(env.TempDir, "home")
+	require.NoError(t, os.MkdirAll(homeDir, 0755))
+	t.Setenv("HOME", homeDir)
+
+	t.Run("problems are reported", func(t *testing.T) {
+		t.Setenv("PATH", "/usr/bin:/bin")
+
+		output, err := env.runCLI(t, "doctor")
+		require.Error(t, err)
+		assert.Contains(t, output, "claude-review is not on your PATH")
+		assert.Contains(t, output, "cr-review.md is not installed")
+		assert.Contains(t, output, "server on port "+env.Port+" runs this version")
+		assert.Contains(t, output, "the database is consistent")
+	})
+
+	t.Run("healthy installation", func(t *testing.T) {
+		t.Setenv("PATH", filepath.Dir(env.BinaryPath)+":/usr/bin:/bin")
+		_, err := env.runCLI(t, "install")
+		require.NoError(t, err)
+
+		output, err := env.runCLI(t, "doctor")
+		require.NoError(t, err, output)
+		assert.Contains(t, output, "claude-review on your PATH is this binary")
+		assert.Contains(t, output, "cr-review.md is up to date")
+		assert.Contains(t, output, "No problems found")
+	})
+
+	t.Run("stale commands are reported", func(t *testing.T) {
+		t.Setenv("PATH", filepath.Dir(env.BinaryPath)+":/usr/bin:/bin")
+		commandPath := filepath.Join(homeDir, ".claude", "commands", "cr-review.md")
+		content, err := os.ReadFile(commandPath)
+		require.NoError(t, err)
+		stale := strings.Replace(string(content), "version=dev", "version=v0.1.0", 1)
+		require.NoError(t, os.WriteFile(commandPath, []byte(stale), 0644))
+
+		output, err := env.runCLI(t, "doctor")
+		require.Error(t, err)
+		assert.Contains(t, output, commandPath+" is from version v0.1.0, this is dev")
+		assert.Contains(t, output, "1 problem(s) found")
+	})
 }
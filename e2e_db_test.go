@@ -0,0 +1,191 @@
+package main_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openTestDB opens the test environment's database directly, bypassing the application
+// (foreign keys are off on this connection, which lets tests create inconsistent data)
+func openTestDB(t *testing.T, env *TestEnv) *sql.DB {
+	t.Helper()
+
+	testDB, err := sql.Open("sqlite3", filepath.Join(env.DataDir, "comments.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = testDB.Close() })
+	return testDB
+}
+
+func TestE2E_DB_JournalModeAndForeignKeys(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	// Database is in WAL mode
+	var journalMode string
+	require.NoError(t, openTestDB(t, env).QueryRow("PRAGMA journal_mode").Scan(&journalMode))
+	assert.Equal(t, "wal", journalMode)
+
+	// Create a thread with a reply
+	resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+		"project_directory": env.ProjectDir,
+		"file_path":         "test.md",
+		"line_start":        1,
+		"line_end":          1,
+		"selected_text":     "Test Document",
+		"comment_text":      "Root comment",
+	})
+	var root map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&root))
+	_ = resp.Body.Close()
+	rootID := int(root["id"].(float64))
+
+	_, err = env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", rootID), "--message", "Agent reply")
+	require.NoError(t, err)
+
+	// Replies to a nonexistent root are rejected
+	resp = env.postJSON(t, "/api/comments", map[string]interface{}{
+		"project_directory": env.ProjectDir,
+		"file_path":         "test.md",
+		"comment_text":      "Dangling reply",
+		"root_id":           9999,
+	})
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	// Deleting the root also deletes its replies
+	resp = env.delete(t, fmt.Sprintf("/api/comments/%d", rootID))
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var count int
+	require.NoError(t, openTestDB(t, env).QueryRow("SELECT COUNT(*) FROM comments WHERE deleted_at IS NULL").
+		Scan(&count))
+	assert.Equal(t, 0, count, "Replies should be deleted together with their root comment")
+}
+
+func TestE2E_DB_CheckAndFix(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	t.Run("clean database", func(t *testing.T) {
+		output, err := env.runCLI(t, "db", "check")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Integrity check: ok")
+		assert.Contains(t, output, "No problems found")
+	})
+
+	// Inject inconsistencies directly, as older versions without foreign keys could leave behind
+	testDB := openTestDB(t, env)
+	_, err = testDB.Exec(`INSERT INTO comments (project_directory, file_path, comment_text, root_id, author)
+		VALUES (?, 'test.md', 'Orphaned reply', 4242, 'agent')`, env.ProjectDir)
+	require.NoError(t, err)
+	_, err = testDB.Exec(`INSERT INTO comments (project_directory, file_path, line_start, line_end, selected_text,
+		comment_text, author) VALUES ('/unregistered/project', 'PLAN.md', 1, 1, 'x', 'Unregistered', 'user')`)
+	require.NoError(t, err)
+	goneDir := filepath.Join(env.TempDir, "gone")
+	_, err = testDB.Exec("INSERT INTO projects (directory) VALUES (?)", goneDir)
+	require.NoError(t, err)
+
+	t.Run("problems are reported", func(t *testing.T) {
+		output, err := env.runCLI(t, "db", "check")
+		require.Error(t, err, "Check should fail when problems are found")
+		assert.Contains(t, output, "Orphaned replies: 1")
+		assert.Contains(t, output, "reply to missing #4242")
+		assert.Contains(t, output, "Unregistered projects: 1")
+		assert.Contains(t, output, "/unregistered/project")
+		assert.Contains(t, output, "Projects with missing directories:")
+		assert.Contains(t, output, goneDir)
+		assert.Contains(t, output, "Run with --fix to repair")
+		assert.Contains(t, output, "Run with --prune-missing to delete these project(s) and their 0 comment(s)")
+	})
+
+	t.Run("problems are repaired", func(t *testing.T) {
+		output, err := env.runCLI(t, "db", "check", "--fix")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Deleted 1 orphaned reply(ies)")
+
+		var count int
+		require.NoError(t, testDB.QueryRow("SELECT COUNT(*) FROM comments WHERE root_id = 4242").Scan(&count))
+		assert.Equal(t, 0, count)
+		require.NoError(t, testDB.QueryRow(
+			"SELECT COUNT(*) FROM projects WHERE directory = '/unregistered/project'").Scan(&count))
+		assert.Equal(t, 1, count)
+
+		// A missing directory may only have been moved, so its reviews are kept
+		assert.Contains(t, output, "Kept 1 project(s) with missing directories")
+		require.NoError(t, testDB.QueryRow("SELECT COUNT(*) FROM projects WHERE directory = ?", goneDir).Scan(&count))
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("projects with missing directories are pruned on request", func(t *testing.T) {
+		// The newly registered /unregistered/project doesn't exist on disk either
+		output, err := env.runCLI(t, "db", "check", "--fix")
+		require.NoError(t, err)
+		assert.Contains(t, output, "/unregistered/project (1 comment(s))")
+		assert.Contains(t, output, "Kept 2 project(s) with missing directories")
+
+		output, err = env.runCLI(t, "db", "check", "--prune-missing")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Removed 2 project(s) with missing directories and their 1 comment(s)")
+
+		var count int
+		require.NoError(t, testDB.QueryRow("SELECT COUNT(*) FROM projects WHERE directory = ?", goneDir).Scan(&count))
+		assert.Equal(t, 0, count)
+
+		output, err = env.runCLI(t, "db", "check")
+		require.NoError(t, err)
+		assert.Contains(t, output, "No problems found")
+	})
+}
+
+func TestE2E_DB_PruneProjectWithHistory(t *testing.T) {
+	env := setupE2E(t)
+
+	goneDir := filepath.Join(env.TempDir, "gone")
+	require.NoError(t, os.MkdirAll(goneDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(goneDir, "PLAN.md"), []byte("# Plan\n\nStep one.\n"), 0644))
+	_, err := env.runCLI(t, "register", "--project", goneDir)
+	require.NoError(t, err)
+
+	// A submitted review, a thread the agent reported on and a verdict
+	resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+		"project_directory": goneDir,
+		"file_path":         "PLAN.md",
+		"comment_text":      "Too short",
+		"draft":             true,
+	})
+	var root map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&root))
+	_ = resp.Body.Close()
+	resp = env.postJSON(t, "/api/reviews", map[string]string{"project_directory": goneDir, "file_path": "PLAN.md"})
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = env.runCLI(t, "status-update", "--comment-id", fmt.Sprintf("%d", int(root["id"].(float64))),
+		"--state", "working")
+	require.NoError(t, err)
+	_, err = env.runCLI(t, "verdict", "--file", "PLAN.md", "--project", goneDir, "--approve")
+	require.NoError(t, err)
+
+	require.NoError(t, os.RemoveAll(goneDir))
+	output, err := env.runCLI(t, "db", "check", "--prune-missing")
+	require.NoError(t, err, output)
+	assert.Contains(t, output, "Removed 1 project(s) with missing directories and their 1 comment(s)")
+
+	testDB := openTestDB(t, env)
+	for _, table := range []string{"projects", "comments", "review_rounds", "verdicts", "thread_statuses"} {
+		var count int
+		require.NoError(t, testDB.QueryRow("SELECT COUNT(*) FROM "+table).Scan(&count))
+		assert.Equal(t, 0, count, "rows left in %s", table)
+	}
+}
@@ -0,0 +1,251 @@
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeProjectConfig writes the .claude-review.toml of the test project
+func (env *TestEnv) writeProjectConfig(t *testing.T, config string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(env.ProjectDir, ".claude-review.toml"), []byte(config), 0644))
+}
+
+// allowProjectConfig lets the commands in the test project's .claude-review.toml run and returns the output of allow
+func (env *TestEnv) allowProjectConfig(t *testing.T) string {
+	t.Helper()
+	output, err := env.runCLI(t, "allow", "--project", env.ProjectDir)
+	require.NoError(t, err, output)
+	return output
+}
+
+// waitForHookOutput waits for a hook to write the event it got to a file in the project directory and decodes it
+func (env *TestEnv) waitForHookOutput(t *testing.T, name string) map[string]interface{} {
+	t.Helper()
+
+	path := filepath.Join(env.ProjectDir, name)
+	require.Eventually(t, func() bool {
+		info, err := os.Stat(path)
+		return err == nil && info.Size() > 0
+	}, 5*time.Second, 50*time.Millisecond, "hook did not write %s", name)
+
+	// The hook may still be writing
+	var payload map[string]interface{}
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(path)
+		return err == nil && json.Unmarshal(data, &payload) == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	return payload
+}
+
+func TestE2E_EventHooks(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	env.writeProjectConfig(t, `
+[hooks]
+on_user_comment = "cat > user-comment.json"
+on_thread_resolved = "cat > thread-resolved.json"
+on_verdict = "cat > verdict.json"
+on_file_changed = "cat > file-changed.json"
+`)
+	env.allowProjectConfig(t)
+
+	t.Run("submitting a review runs on_user_comment", func(t *testing.T) {
+		resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"line_start":        1,
+			"line_end":          1,
+			"selected_text":     "Test Document",
+			"comment_text":      "Please expand",
+			"draft":             true,
+		})
+		_ = resp.Body.Close()
+
+		resp = env.postJSON(t, "/api/reviews", map[string]string{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+		})
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		payload := env.waitForHookOutput(t, "user-comment.json")
+		assert.Equal(t, "on_user_comment", payload["hook"])
+		assert.Equal(t, "review_submitted", payload["event"])
+		assert.Equal(t, env.ProjectDir, payload["project_directory"])
+		assert.Equal(t, "test.md", payload["file_path"])
+		data := payload["data"].(map[string]interface{})
+		assert.Equal(t, float64(1), data["review_round"])
+		assert.Equal(t, float64(1), data["count"])
+	})
+
+	t.Run("resolving from the CLI runs on_thread_resolved", func(t *testing.T) {
+		_, err := env.runCLI(t, "resolve", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+
+		payload := env.waitForHookOutput(t, "thread-resolved.json")
+		assert.Equal(t, "on_thread_resolved", payload["hook"])
+		assert.Equal(t, "test.md", payload["file_path"])
+	})
+
+	t.Run("commenting from the terminal runs on_user_comment", func(t *testing.T) {
+		hookOutput := filepath.Join(env.ProjectDir, "user-comment.json")
+		require.NoError(t, os.Remove(hookOutput))
+
+		output, err := env.runCLI(t, "comment", "--file", "test.md", "--project", env.ProjectDir,
+			"--lines", "1", "--message", "Add a summary")
+		require.NoError(t, err)
+		var commentID int
+		_, err = fmt.Sscanf(output[strings.Index(output, "(comment #"):], "(comment #%d)", &commentID)
+		require.NoError(t, err)
+
+		payload := env.waitForHookOutput(t, "user-comment.json")
+		assert.Equal(t, "on_user_comment", payload["hook"])
+		assert.Equal(t, "comment_added", payload["event"])
+		data := payload["data"].(map[string]interface{})
+		assert.Equal(t, float64(commentID), data["comment_id"])
+
+		// The agent's replies don't run it
+		require.NoError(t, os.Remove(hookOutput))
+		_, err = env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", commentID), "--message", "Added")
+		require.NoError(t, err)
+		time.Sleep(500 * time.Millisecond)
+		assert.NoFileExists(t, hookOutput)
+	})
+
+	t.Run("a verdict runs on_verdict", func(t *testing.T) {
+		resp := env.postJSON(t, "/api/verdicts", map[string]string{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"status":            "approved",
+			"author_name":       "Alice",
+		})
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		payload := env.waitForHookOutput(t, "verdict.json")
+		assert.Equal(t, "on_verdict", payload["hook"])
+		data := payload["data"].(map[string]interface{})
+		assert.Equal(t, "approved", data["status"])
+		assert.Equal(t, "Alice", data["author_name"])
+	})
+
+	t.Run("changing a watched file runs on_file_changed", func(t *testing.T) {
+		sseResp, err := http.Get(fmt.Sprintf("%s/api/events?project_directory=%s&file_path=simple.md", env.BaseURL,
+			url.QueryEscape(env.ProjectDir)))
+		require.NoError(t, err)
+		defer func() { _ = sseResp.Body.Close() }()
+
+		// Give the server a moment to start watching the file
+		time.Sleep(200 * time.Millisecond)
+		require.NoError(t, os.WriteFile(filepath.Join(env.ProjectDir, "simple.md"), []byte("# Changed\n"), 0644))
+
+		payload := env.waitForHookOutput(t, "file-changed.json")
+		assert.Equal(t, "on_file_changed", payload["hook"])
+		assert.Equal(t, "simple.md", payload["file_path"])
+	})
+}
+
+func TestE2E_EventHooks_FailuresAreLogged(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	postVerdict := func(t *testing.T) {
+		resp := env.postJSON(t, "/api/verdicts", map[string]string{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"status":            "approved",
+		})
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	waitForLog := func(t *testing.T, text string) {
+		require.Eventually(t, func() bool {
+			logs, err := os.ReadFile(env.LogFile)
+			return err == nil && strings.Contains(string(logs), text)
+		}, 5*time.Second, 50*time.Millisecond, "server log does not contain %q", text)
+	}
+
+	t.Run("commands only run once allowed", func(t *testing.T) {
+		configPath := filepath.Join(env.ProjectDir, ".claude-review.toml")
+		notAllowed := "Not running on_verdict hook: " + configPath + " is not allowed to run commands"
+		countNotAllowed := func() int {
+			logs, err := os.ReadFile(env.LogFile)
+			require.NoError(t, err)
+			return strings.Count(string(logs), notAllowed)
+		}
+
+		env.writeProjectConfig(t, `
+[hooks]
+on_verdict = "cat > allowed.json"
+`)
+		postVerdict(t)
+		waitForLog(t, notAllowed)
+		assert.NoFileExists(t, filepath.Join(env.ProjectDir, "allowed.json"))
+
+		output := env.allowProjectConfig(t)
+		assert.Contains(t, output, "Allowed "+configPath+" to run:\n  hooks.on_verdict: cat > allowed.json\n")
+		postVerdict(t)
+		env.waitForHookOutput(t, "allowed.json")
+
+		// Changing the file takes the permission away
+		env.writeProjectConfig(t, `
+[hooks]
+on_verdict = "cat > changed.json"
+`)
+		postVerdict(t)
+		require.Eventually(t, func() bool { return countNotAllowed() == 2 }, 5*time.Second, 50*time.Millisecond)
+		assert.NoFileExists(t, filepath.Join(env.ProjectDir, "changed.json"))
+
+		env.allowProjectConfig(t)
+		output, err := env.runCLI(t, "allow", "--revoke", "--project", env.ProjectDir)
+		require.NoError(t, err, output)
+		postVerdict(t)
+		require.Eventually(t, func() bool { return countNotAllowed() == 3 }, 5*time.Second, 50*time.Millisecond)
+		assert.NoFileExists(t, filepath.Join(env.ProjectDir, "changed.json"))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		env.writeProjectConfig(t, `
+[hooks]
+on_verdict = "sleep 10"
+timeout_seconds = 1
+`)
+		env.allowProjectConfig(t)
+		postVerdict(t)
+		waitForLog(t, "Hook on_verdict for test.md timed out after 1s")
+	})
+
+	t.Run("failing command", func(t *testing.T) {
+		env.writeProjectConfig(t, `
+[hooks]
+on_verdict = "echo broken; exit 3"
+`)
+		env.allowProjectConfig(t)
+		postVerdict(t)
+		waitForLog(t, "Hook on_verdict for test.md failed")
+		waitForLog(t, "exit status 3: broken")
+	})
+
+	t.Run("unknown hook", func(t *testing.T) {
+		env.writeProjectConfig(t, `
+[hooks]
+on_verdikt = "true"
+`)
+		postVerdict(t)
+		waitForLog(t, "unknown keys in "+filepath.Join(env.ProjectDir, ".claude-review.toml")+": hooks.on_verdikt")
+	})
+}
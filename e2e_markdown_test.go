@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -253,3 +256,88 @@ func TestE2E_Markdown_ThreadedComments(t *testing.T) {
 	assert.Contains(t, viewerStr, "\\u003cstrong\\u003eImportant\\u003c/strong\\u003e")
 	assert.Contains(t, viewerStr, "\\u003cem\\u003eagree\\u003c/em\\u003e")
 }
+
+func TestE2E_Markdown_FrontMatter(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	draft := "---\nstatus: draft\nowner: alice\n---\n\n# Draft Plan\n\nNeeds review.\n"
+	approved := "+++\nstatus = \"approved\"\n+++\n\n# Approved Plan\n"
+	require.NoError(t, os.WriteFile(filepath.Join(env.ProjectDir, "draft.md"), []byte(draft), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(env.ProjectDir, "approved.md"), []byte(approved), 0644))
+
+	t.Run("viewer renders metadata header", func(t *testing.T) {
+		resp, err := http.Get(fmt.Sprintf("%s/projects%s/draft.md", env.BaseURL, env.ProjectDir))
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+
+		body, _ := io.ReadAll(resp.Body)
+		bodyStr := string(body)
+		assert.Contains(t, bodyStr, `class="front-matter"`)
+		assert.Contains(t, bodyStr, "<dt>owner</dt><dd>alice</dd>")
+		assert.Contains(t, bodyStr, `data-line-start="6"`)
+	})
+
+	t.Run("directory listing filters by front matter", func(t *testing.T) {
+		resp, err := http.Get(fmt.Sprintf("%s/projects%s/?fm.status=draft", env.BaseURL, env.ProjectDir))
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+
+		body, _ := io.ReadAll(resp.Body)
+		bodyStr := string(body)
+		assert.Contains(t, bodyStr, "draft.md")
+		assert.Contains(t, bodyStr, "status: draft")
+		assert.NotContains(t, bodyStr, "approved.md")
+		assert.NotContains(t, bodyStr, "test.md")
+	})
+
+	t.Run("directory listing ignores unrelated query parameters", func(t *testing.T) {
+		resp, err := http.Get(fmt.Sprintf("%s/projects%s/?foo=1", env.BaseURL, env.ProjectDir))
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+
+		body, _ := io.ReadAll(resp.Body)
+		bodyStr := string(body)
+		assert.Contains(t, bodyStr, "draft.md")
+		assert.Contains(t, bodyStr, "approved.md")
+		assert.Contains(t, bodyStr, "test.md")
+		assert.NotContains(t, bodyStr, "Filtered by")
+	})
+
+	t.Run("address exposes front matter as JSON", func(t *testing.T) {
+		resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+			"project_directory": env.ProjectDir,
+			"file_path":         "draft.md",
+			"line_start":        8,
+			"line_end":          8,
+			"selected_text":     "Needs review.",
+			"comment_text":      "Reviewed",
+		})
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		output, err := env.runCLI(t, "address", "--file", "draft.md", "--project", env.ProjectDir, "--format", "json")
+		require.NoError(t, err)
+
+		// Logs go to stderr, the JSON document starts at the first brace
+		start := strings.Index(output, "{")
+		require.GreaterOrEqual(t, start, 0, "No JSON in output: %s", output)
+
+		var result struct {
+			FilePath    string                 `json:"file_path"`
+			FrontMatter map[string]interface{} `json:"front_matter"`
+			Threads     []struct {
+				ID       int `json:"id"`
+				Messages []struct {
+					CommentText string `json:"comment_text"`
+				} `json:"messages"`
+			} `json:"threads"`
+		}
+		require.NoError(t, json.NewDecoder(strings.NewReader(output[start:])).Decode(&result))
+		assert.Equal(t, "draft.md", result.FilePath)
+		assert.Equal(t, "draft", result.FrontMatter["status"])
+		require.Len(t, result.Threads, 1)
+		assert.Equal(t, "Reviewed", result.Threads[0].Messages[0].CommentText)
+	})
+}
@@ -0,0 +1,447 @@
+package main_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mcpClient talks to a `claude-review mcp` process over stdio
+type mcpClient struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Scanner
+	nextID int
+}
+
+type mcpResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func startMCP(t *testing.T, env *TestEnv) *mcpClient {
+	t.Helper()
+
+	cmd := exec.Command(env.BinaryPath, "mcp")
+	cmd.Dir = env.ProjectDir
+	cmd.Env = append(os.Environ(),
+		"CR_DATA_DIR="+env.DataDir,
+		"CR_LISTEN_PORT="+env.Port,
+		"CR_AGENT_ID=mcp-session",
+		"GOCOVERDIR=tmp/coverage",
+	)
+	stdin, err := cmd.StdinPipe()
+	require.NoError(t, err)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+
+	t.Cleanup(func() {
+		_ = stdin.Close()
+		_ = cmd.Wait()
+	})
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &mcpClient{cmd: cmd, stdin: stdin, stdout: scanner}
+}
+
+func (c *mcpClient) request(t *testing.T, method string, params interface{}) mcpResponse {
+	t.Helper()
+
+	c.nextID++
+	data, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      c.nextID,
+		"method":  method,
+		"params":  params,
+	})
+	require.NoError(t, err)
+	_, err = fmt.Fprintf(c.stdin, "%s\n", data)
+	require.NoError(t, err)
+
+	require.True(t, c.stdout.Scan(), "MCP server closed stdout")
+	var resp mcpResponse
+	require.NoError(t, json.Unmarshal(c.stdout.Bytes(), &resp), c.stdout.Text())
+	require.Equal(t, c.nextID, resp.ID)
+	return resp
+}
+
+// callTool calls a tool and decodes its JSON output into result, returning whether the call failed
+func (c *mcpClient) callTool(t *testing.T, name string, args map[string]interface{}, result interface{}) bool {
+	t.Helper()
+
+	resp := c.request(t, "tools/call", map[string]interface{}{"name": name, "arguments": args})
+	require.Nil(t, resp.Error)
+
+	var toolResult struct {
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+		IsError bool `json:"isError"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Result, &toolResult))
+	require.Len(t, toolResult.Content, 1)
+	if !toolResult.IsError && result != nil {
+		require.NoError(t, json.Unmarshal([]byte(toolResult.Content[0].Text), result))
+	}
+	return toolResult.IsError
+}
+
+type mcpThread struct {
+	ID       int `json:"id"`
+	Messages []struct {
+		ID          int    `json:"id"`
+		Author      string `json:"author"`
+		AuthorName  string `json:"author_name"`
+		AgentID     string `json:"agent_id"`
+		CommentText string `json:"comment_text"`
+	} `json:"messages"`
+}
+
+func TestE2E_MCP(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	client := startMCP(t, env)
+
+	t.Run("initialize", func(t *testing.T) {
+		resp := client.request(t, "initialize", map[string]interface{}{
+			"protocolVersion": "2024-11-05",
+			"capabilities":    map[string]interface{}{},
+			"clientInfo":      map[string]string{"name": "test", "version": "1"},
+		})
+		require.Nil(t, resp.Error)
+
+		var result struct {
+			ProtocolVersion string `json:"protocolVersion"`
+			ServerInfo      struct {
+				Name string `json:"name"`
+			} `json:"serverInfo"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Result, &result))
+		assert.Equal(t, "2024-11-05", result.ProtocolVersion)
+		assert.Equal(t, "claude-review", result.ServerInfo.Name)
+
+		// Notifications get no response, so the next request's response comes next
+		_, err := fmt.Fprintln(client.stdin, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+		require.NoError(t, err)
+	})
+
+	t.Run("tools are listed with schemas", func(t *testing.T) {
+		resp := client.request(t, "tools/list", map[string]interface{}{})
+		require.Nil(t, resp.Error)
+
+		var result struct {
+			Tools []struct {
+				Name        string                 `json:"name"`
+				InputSchema map[string]interface{} `json:"inputSchema"`
+			} `json:"tools"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Result, &result))
+
+		var names []string
+		for _, tool := range result.Tools {
+			names = append(names, tool.Name)
+			assert.Equal(t, "object", tool.InputSchema["type"])
+		}
+		assert.ElementsMatch(t,
+			[]string{"list_threads", "get_thread", "reply", "resolve", "open_review", "wait_for_feedback"}, names)
+	})
+
+	t.Run("unknown methods and tools are errors", func(t *testing.T) {
+		resp := client.request(t, "resources/list", map[string]interface{}{})
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, -32601, resp.Error.Code)
+
+		resp = client.request(t, "tools/call", map[string]interface{}{"name": "nope"})
+		require.NotNil(t, resp.Error)
+	})
+
+	resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+		"project_directory": env.ProjectDir,
+		"file_path":         "test.md",
+		"line_start":        1,
+		"line_end":          1,
+		"selected_text":     "Test Document",
+		"comment_text":      "Rename this",
+	})
+	var root map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&root))
+	_ = resp.Body.Close()
+	rootID := int(root["id"].(float64))
+
+	t.Run("list threads", func(t *testing.T) {
+		var result struct {
+			FilePath string      `json:"file_path"`
+			Threads  []mcpThread `json:"threads"`
+		}
+		isError := client.callTool(t, "list_threads", map[string]interface{}{"file_path": "@test.md"}, &result)
+		require.False(t, isError)
+		assert.Equal(t, "test.md", result.FilePath)
+		require.Len(t, result.Threads, 1)
+		assert.Equal(t, rootID, result.Threads[0].ID)
+		assert.Equal(t, "Rename this", result.Threads[0].Messages[0].CommentText)
+
+		assert.True(t, client.callTool(t, "list_threads", map[string]interface{}{}, nil), "file_path is required")
+	})
+
+	t.Run("feedback is returned immediately when waiting", func(t *testing.T) {
+		var result struct {
+			Threads  []mcpThread `json:"threads"`
+			TimedOut bool        `json:"timed_out"`
+		}
+		args := map[string]interface{}{"file_path": "test.md"}
+		require.False(t, client.callTool(t, "wait_for_feedback", args, &result))
+		assert.False(t, result.TimedOut)
+		require.Len(t, result.Threads, 1)
+	})
+
+	t.Run("reply and get thread", func(t *testing.T) {
+		require.False(t, client.callTool(t, "reply", map[string]interface{}{
+			"comment_id": rootID,
+			"message":    "Renamed it",
+		}, nil))
+
+		var thread mcpThread
+		require.False(t, client.callTool(t, "get_thread", map[string]interface{}{"comment_id": rootID}, &thread))
+		require.Len(t, thread.Messages, 2)
+		assert.Equal(t, "agent", thread.Messages[1].Author)
+		assert.Equal(t, "mcp-session", thread.Messages[1].AgentID)
+		assert.Empty(t, thread.Messages[1].AuthorName)
+
+		assert.True(t, client.callTool(t, "reply", map[string]interface{}{"comment_id": 9999, "message": "x"}, nil))
+	})
+
+	t.Run("waiting times out when the agent spoke last", func(t *testing.T) {
+		var result struct {
+			Threads  []mcpThread `json:"threads"`
+			TimedOut bool        `json:"timed_out"`
+		}
+		require.False(t, client.callTool(t, "wait_for_feedback", map[string]interface{}{
+			"file_path":       "test.md",
+			"timeout_seconds": 1,
+		}, &result))
+		assert.True(t, result.TimedOut)
+		assert.Empty(t, result.Threads)
+	})
+
+	t.Run("waiting returns when the reviewer replies", func(t *testing.T) {
+		reply, err := json.Marshal(map[string]interface{}{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"comment_text":      "Not quite",
+			"root_id":           rootID,
+		})
+		require.NoError(t, err)
+
+		// Reply while the tool call is waiting (require can't be used outside the test goroutine)
+		go func() {
+			time.Sleep(500 * time.Millisecond)
+			resp, err := http.Post(env.BaseURL+"/api/comments", "application/json", bytes.NewReader(reply))
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+		}()
+
+		var result struct {
+			Threads  []mcpThread `json:"threads"`
+			TimedOut bool        `json:"timed_out"`
+		}
+		require.False(t, client.callTool(t, "wait_for_feedback", map[string]interface{}{
+			"file_path":       "test.md",
+			"timeout_seconds": 10,
+		}, &result))
+		assert.False(t, result.TimedOut)
+		require.Len(t, result.Threads, 1)
+		assert.Equal(t, "Not quite", result.Threads[0].Messages[2].CommentText)
+	})
+
+	t.Run("resolve", func(t *testing.T) {
+		var result struct {
+			ThreadID int `json:"thread_id"`
+			Resolved int `json:"resolved"`
+		}
+		require.False(t, client.callTool(t, "resolve", map[string]interface{}{"comment_id": rootID}, &result))
+		assert.Equal(t, rootID, result.ThreadID)
+		assert.Equal(t, 3, result.Resolved)
+
+		var list struct {
+			Threads []mcpThread `json:"threads"`
+		}
+		require.False(t, client.callTool(t, "list_threads", map[string]interface{}{"file_path": "test.md"}, &list))
+		assert.Empty(t, list.Threads)
+
+		require.False(t, client.callTool(t, "list_threads", map[string]interface{}{
+			"file_path":        "test.md",
+			"include_resolved": true,
+		}, &list))
+		assert.Len(t, list.Threads, 1)
+	})
+}
+
+func TestE2E_MCP_ExitsWhenInputCloses(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	client := startMCP(t, env)
+	data, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params": map[string]interface{}{
+			"name":      "wait_for_feedback",
+			"arguments": map[string]interface{}{"file_path": "test.md", "timeout_seconds": 600},
+		},
+	})
+	require.NoError(t, err)
+	_, err = fmt.Fprintf(client.stdin, "%s\n", data)
+	require.NoError(t, err)
+
+	// Give the call time to start waiting before the client goes away
+	time.Sleep(500 * time.Millisecond)
+	require.NoError(t, client.stdin.Close())
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- client.cmd.Wait()
+	}()
+	select {
+	case err := <-exited:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		_ = client.cmd.Process.Kill()
+		t.Fatal("MCP server kept waiting for feedback after its input closed")
+	}
+	assert.False(t, client.stdout.Scan(), "a cancelled call gets no response")
+}
+
+func TestE2E_MCP_CancelRightAfterRequest(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	client := startMCP(t, env)
+	call, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params": map[string]interface{}{
+			"name":      "wait_for_feedback",
+			"arguments": map[string]interface{}{"file_path": "test.md", "timeout_seconds": 1},
+		},
+	})
+	require.NoError(t, err)
+	cancel, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "notifications/cancelled",
+		"params":  map[string]interface{}{"requestId": 1},
+	})
+	require.NoError(t, err)
+
+	// Both lines arrive together, before the call has started
+	_, err = fmt.Fprintf(client.stdin, "%s\n%s\n", call, cancel)
+	require.NoError(t, err)
+	client.nextID = 1
+
+	// Wait past the call's timeout; the next response must still be for the next request
+	time.Sleep(2 * time.Second)
+	resp := client.request(t, "tools/list", map[string]interface{}{})
+	require.Nil(t, resp.Error)
+}
+
+func TestE2E_CLI_InstallMCP(t *testing.T) {
+	tempDir := t.TempDir()
+	homeDir := filepath.Join(tempDir, "home")
+	require.NoError(t, os.MkdirAll(homeDir, 0755))
+
+	binaryPath := filepath.Join(tempDir, "claude-review")
+	buildCmd := exec.Command("go", "build", "-cover", "-o", binaryPath, ".")
+	require.NoError(t, buildCmd.Run())
+
+	runInstall := func(t *testing.T, path string, args ...string) string {
+		cmd := exec.Command(binaryPath, args...)
+		cmd.Env = append(os.Environ(), "HOME="+homeDir, "GOCOVERDIR=tmp/coverage", "PATH="+path)
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+		return string(output)
+	}
+	configPath := filepath.Join(homeDir, ".claude.json")
+
+	t.Run("without the claude CLI the config is edited", func(t *testing.T) {
+		// Existing settings are kept
+		existing := `{"theme": "dark", "mcpServers": {"other": {"command": "x"}}}`
+		require.NoError(t, os.WriteFile(configPath, []byte(existing), 0600))
+
+		output := runInstall(t, "/usr/bin:/bin", "install", "--mcp")
+		assert.Contains(t, output, `Registered MCP server "claude-review" in `+configPath)
+
+		data, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+		var config struct {
+			Theme      string `json:"theme"`
+			MCPServers map[string]struct {
+				Type    string   `json:"type"`
+				Command string   `json:"command"`
+				Args    []string `json:"args"`
+			} `json:"mcpServers"`
+		}
+		require.NoError(t, json.Unmarshal(data, &config))
+		assert.Equal(t, "dark", config.Theme)
+		assert.Contains(t, config.MCPServers, "other")
+		require.Contains(t, config.MCPServers, "claude-review")
+		assert.Equal(t, "stdio", config.MCPServers["claude-review"].Type)
+		assert.Equal(t, binaryPath, config.MCPServers["claude-review"].Command)
+		assert.Equal(t, []string{"mcp"}, config.MCPServers["claude-review"].Args)
+
+		info, err := os.Stat(configPath)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		entries, err := os.ReadDir(homeDir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1, "no temporary files are left behind")
+	})
+
+	t.Run("the claude CLI registers the server when installed", func(t *testing.T) {
+		binDir := filepath.Join(tempDir, "bin")
+		require.NoError(t, os.MkdirAll(binDir, 0755))
+		callsPath := filepath.Join(tempDir, "claude-calls")
+		script := "#!/bin/sh\necho \"$@\" >> '" + callsPath + "'\n"
+		require.NoError(t, os.WriteFile(filepath.Join(binDir, "claude"), []byte(script), 0755))
+		before, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+
+		output := runInstall(t, binDir+":/usr/bin:/bin", "install", "--mcp")
+		assert.Contains(t, output, `Registered MCP server "claude-review" with claude mcp add`)
+		output = runInstall(t, binDir+":/usr/bin:/bin", "uninstall")
+		assert.Contains(t, output, `Unregistered MCP server "claude-review" with claude mcp remove`)
+
+		calls, err := os.ReadFile(callsPath)
+		require.NoError(t, err)
+		assert.Equal(t, "mcp remove --scope user claude-review\n"+
+			"mcp add --scope user claude-review -- "+binaryPath+" mcp\n"+
+			"mcp remove --scope user claude-review\n", string(calls))
+
+		// The config is left to the claude CLI
+		after, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+		assert.Equal(t, string(before), string(after))
+	})
+}
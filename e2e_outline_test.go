@@ -0,0 +1,129 @@
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type outlineItem struct {
+	ID                string        `json:"id"`
+	Title             string        `json:"title"`
+	Level             int           `json:"level"`
+	LineStart         int           `json:"line_start"`
+	LineEnd           int           `json:"line_end"`
+	UnresolvedThreads int           `json:"unresolved_threads"`
+	Children          []outlineItem `json:"children"`
+}
+
+func TestE2E_Outline(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	// One comment in "Section 2" (lines 5-16), one in "Conclusion" (lines 17-19)
+	for _, c := range []struct {
+		line int
+		text string
+	}{
+		{7, "Another paragraph"},
+		{19, "Final paragraph."},
+	} {
+		resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"line_start":        c.line,
+			"line_end":          c.line,
+			"selected_text":     c.text,
+			"comment_text":      "Comment on " + c.text,
+		})
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	t.Run("outline API returns sections with thread counts", func(t *testing.T) {
+		resp, err := http.Get(fmt.Sprintf("%s/api/outline?project_directory=%s&file_path=test.md",
+			env.BaseURL, url.QueryEscape(env.ProjectDir)))
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var outline []outlineItem
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&outline))
+
+		require.Len(t, outline, 1)
+		root := outline[0]
+		assert.Equal(t, "Test Document", root.Title)
+		assert.Equal(t, "test-document", root.ID)
+		assert.Equal(t, 1, root.LineStart)
+		assert.Equal(t, 19, root.LineEnd)
+		assert.Equal(t, 2, root.UnresolvedThreads)
+
+		require.Len(t, root.Children, 2)
+		section := root.Children[0]
+		assert.Equal(t, "Section 2", section.Title)
+		assert.Equal(t, 5, section.LineStart)
+		assert.Equal(t, 16, section.LineEnd)
+		assert.Equal(t, 1, section.UnresolvedThreads)
+		require.Len(t, section.Children, 1)
+		assert.Equal(t, "Code Example", section.Children[0].Title)
+		assert.Equal(t, 0, section.Children[0].UnresolvedThreads)
+
+		assert.Equal(t, "Conclusion", root.Children[1].Title)
+		assert.Equal(t, 1, root.Children[1].UnresolvedThreads)
+	})
+
+	t.Run("outline API rejects paths outside the project", func(t *testing.T) {
+		resp, err := http.Get(fmt.Sprintf("%s/api/outline?project_directory=%s&file_path=../secret.md",
+			env.BaseURL, url.QueryEscape(env.ProjectDir)))
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("outline API refuses unregistered projects", func(t *testing.T) {
+		otherDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(otherDir, "notes.md"), []byte("# Notes\n"), 0644))
+
+		resp, err := http.Get(fmt.Sprintf("%s/api/outline?project_directory=%s&file_path=notes.md",
+			env.BaseURL, url.QueryEscape(otherDir)))
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("viewer embeds outline and heading IDs", func(t *testing.T) {
+		resp, err := http.Get(fmt.Sprintf("%s/projects%s/test.md", env.BaseURL, env.ProjectDir))
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+
+		body, _ := io.ReadAll(resp.Body)
+		bodyStr := string(body)
+		assert.Contains(t, bodyStr, `id="section-2"`)
+		assert.Contains(t, bodyStr, `"unresolved_threads":1`)
+	})
+
+	t.Run("address scoped to a section", func(t *testing.T) {
+		output, err := env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir,
+			"--section", "conclusion")
+		require.NoError(t, err)
+		assert.Contains(t, output, `Found 1 unresolved comment(s) for test.md (section "Conclusion", lines 17-19)`)
+		assert.Contains(t, output, "Comment on Final paragraph.")
+		assert.NotContains(t, output, "Comment on Another paragraph")
+	})
+
+	t.Run("address with unknown section fails", func(t *testing.T) {
+		output, err := env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir,
+			"--section", "Rollout")
+		require.Error(t, err)
+		assert.Contains(t, output, `section "Rollout" not found`)
+	})
+}
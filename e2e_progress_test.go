@@ -0,0 +1,189 @@
+package main_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type threadProgress struct {
+	ThreadID int `json:"thread_id"`
+	Status   *struct {
+		State   string `json:"state"`
+		Note    string `json:"note"`
+		AgentID string `json:"agent_id"`
+	} `json:"status"`
+	Skipped bool `json:"skipped"`
+}
+
+func (env *TestEnv) getProgress(t *testing.T) map[int]threadProgress {
+	t.Helper()
+
+	resp, err := http.Get(fmt.Sprintf("%s/api/progress?project_directory=%s&file_path=test.md", env.BaseURL,
+		url.QueryEscape(env.ProjectDir)))
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var progress []threadProgress
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&progress))
+	byThread := make(map[int]threadProgress)
+	for _, p := range progress {
+		byThread[p.ThreadID] = p
+	}
+	return byThread
+}
+
+func TestE2E_ThreadProgress(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	createComment := func(t *testing.T, payload map[string]interface{}) int {
+		t.Helper()
+		payload["project_directory"] = env.ProjectDir
+		payload["file_path"] = "test.md"
+		resp := env.postJSON(t, "/api/comments", payload)
+		defer func() { _ = resp.Body.Close() }()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var created map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+		return int(created["id"].(float64))
+	}
+
+	firstID := createComment(t, map[string]interface{}{
+		"line_start": 1, "line_end": 1, "selected_text": "Test Document", "comment_text": "Fix the title",
+	})
+	secondID := createComment(t, map[string]interface{}{
+		"line_start": 3, "line_end": 3, "selected_text": "This is a test paragraph", "comment_text": "Expand this",
+	})
+
+	// Connect to SSE to observe the events
+	sseResp, err := http.Get(fmt.Sprintf("%s/api/events?project_directory=%s&file_path=test.md", env.BaseURL,
+		url.QueryEscape(env.ProjectDir)))
+	require.NoError(t, err)
+	defer func() { _ = sseResp.Body.Close() }()
+	events := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(sseResp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "event: ") {
+				events <- strings.TrimPrefix(line, "event: ")
+			}
+		}
+	}()
+	assert.Equal(t, "connected", waitForEvent(t, events))
+
+	t.Run("invalid updates are rejected", func(t *testing.T) {
+		output, err := env.runCLI(t, "status-update", "--comment-id", fmt.Sprintf("%d", firstID), "--state", "busy")
+		require.Error(t, err)
+		assert.Contains(t, output, "--state must be working, done or blocked")
+
+		output, err = env.runCLI(t, "status-update", "--comment-id", "99999", "--state", "done")
+		require.Error(t, err)
+		assert.Contains(t, output, "comment 99999 not found")
+	})
+
+	t.Run("working", func(t *testing.T) {
+		output, err := env.runCLI(t, "status-update", "--comment-id", fmt.Sprintf("%d", firstID),
+			"--state", "working", "--agent-id", "session-1")
+		require.NoError(t, err)
+		assert.Contains(t, output, fmt.Sprintf("Thread %d marked as working", firstID))
+		assert.Equal(t, "thread_status_changed", waitForEvent(t, events))
+
+		progress := env.getProgress(t)
+		require.NotNil(t, progress[firstID].Status)
+		assert.Equal(t, "working", progress[firstID].Status.State)
+		assert.Equal(t, "session-1", progress[firstID].Status.AgentID)
+		// Other threads aren't skipped while the agent is still working
+		assert.NotContains(t, progress, secondID)
+	})
+
+	t.Run("done threads leave the others skipped", func(t *testing.T) {
+		_, err := env.runCLI(t, "status-update", "--comment-id", fmt.Sprintf("%d", firstID), "--state", "done")
+		require.NoError(t, err)
+		assert.Equal(t, "thread_status_changed", waitForEvent(t, events))
+
+		progress := env.getProgress(t)
+		require.NotNil(t, progress[firstID].Status)
+		assert.Equal(t, "done", progress[firstID].Status.State)
+		assert.True(t, progress[secondID].Skipped)
+	})
+
+	t.Run("blocked with a note", func(t *testing.T) {
+		_, err := env.runCLI(t, "status-update", "--comment-id", fmt.Sprintf("%d", secondID),
+			"--state", "blocked", "--note", "  Need access to the data  ")
+		require.NoError(t, err)
+		assert.Equal(t, "thread_status_changed", waitForEvent(t, events))
+
+		progress := env.getProgress(t)
+		require.NotNil(t, progress[secondID].Status)
+		assert.Equal(t, "blocked", progress[secondID].Status.State)
+		assert.Equal(t, "Need access to the data", progress[secondID].Status.Note)
+		assert.False(t, progress[secondID].Skipped)
+	})
+
+	t.Run("replies in a thread apply to the whole thread", func(t *testing.T) {
+		replyID := createComment(t, map[string]interface{}{"root_id": firstID, "comment_text": "Not quite"})
+
+		// A reviewer message makes the earlier status stale
+		progress := env.getProgress(t)
+		assert.Nil(t, progress[firstID].Status)
+		assert.False(t, progress[firstID].Skipped)
+
+		output, err := env.runCLI(t, "status-update", "--comment-id", fmt.Sprintf("%d", replyID), "--state", "working")
+		require.NoError(t, err)
+		assert.Contains(t, output, fmt.Sprintf("Thread %d marked as working", firstID))
+
+		progress = env.getProgress(t)
+		require.NotNil(t, progress[firstID].Status)
+		assert.Equal(t, "working", progress[firstID].Status.State)
+	})
+
+	t.Run("the viewer starts with the progress", func(t *testing.T) {
+		resp, err := http.Get(fmt.Sprintf("%s/projects%s/test.md", env.BaseURL, env.ProjectDir))
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		var page strings.Builder
+		_, err = bufio.NewReader(resp.Body).WriteTo(&page)
+		require.NoError(t, err)
+		assert.Contains(t, page.String(), fmt.Sprintf(`"thread_id":%d`, firstID))
+		assert.Contains(t, page.String(), `"state":"blocked"`)
+	})
+}
+
+func TestE2E_ThreadProgress_DeletedThreads(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	var ids []int
+	for _, text := range []string{"Fix the title", "Expand this"} {
+		resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"comment_text":      text,
+		})
+		var created map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+		_ = resp.Body.Close()
+		ids = append(ids, int(created["id"].(float64)))
+	}
+
+	_, err = env.runCLI(t, "status-update", "--comment-id", fmt.Sprintf("%d", ids[0]), "--state", "done")
+	require.NoError(t, err)
+	assert.True(t, env.getProgress(t)[ids[1]].Skipped)
+
+	// The status of a deleted thread no longer counts
+	resp := env.delete(t, fmt.Sprintf("/api/comments/%d", ids[0]))
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, env.getProgress(t))
+}
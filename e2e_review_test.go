@@ -0,0 +1,257 @@
+package main_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestE2E_Review_DraftsAndSubmit(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	createComment := func(t *testing.T, payload map[string]interface{}) map[string]interface{} {
+		t.Helper()
+		payload["project_directory"] = env.ProjectDir
+		payload["file_path"] = "test.md"
+		resp := env.postJSON(t, "/api/comments", payload)
+		defer func() { _ = resp.Body.Close() }()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var created map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+		return created
+	}
+	submitReview := func(t *testing.T) *http.Response {
+		t.Helper()
+		return env.postJSON(t, "/api/reviews", map[string]string{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+		})
+	}
+
+	// Connect to SSE to observe which actions notify listeners
+	sseResp, err := http.Get(fmt.Sprintf("%s/api/events?project_directory=%s&file_path=test.md", env.BaseURL,
+		url.QueryEscape(env.ProjectDir)))
+	require.NoError(t, err)
+	defer func() { _ = sseResp.Body.Close() }()
+	events := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(sseResp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+				events <- strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	waitForEvent(t, events) // connected
+
+	draft := createComment(t, map[string]interface{}{
+		"line_start": 1, "line_end": 1, "selected_text": "Test Document",
+		"comment_text": "Draft comment", "draft": true,
+	})
+	draftID := int(draft["id"].(float64))
+	assert.Equal(t, true, draft["draft"])
+
+	// Replies to a draft are drafts too
+	reply := createComment(t, map[string]interface{}{"comment_text": "Draft reply", "root_id": draftID})
+	assert.Equal(t, true, reply["draft"])
+
+	t.Run("drafts are hidden from the agent", func(t *testing.T) {
+		output, err := env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, "Note: 2 draft comment(s) for test.md have not been submitted yet")
+		assert.Contains(t, output, "No unresolved comments for test.md")
+		assert.NotContains(t, output, "Draft comment")
+
+		output, err = env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", draftID), "--message", "Sneaky")
+		require.Error(t, err)
+		assert.Contains(t, output, "not found")
+
+		output, err = env.runCLI(t, "resolve", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, "No unresolved comments found")
+	})
+
+	t.Run("drafts are shown in the viewer", func(t *testing.T) {
+		resp, err := http.Get(env.BaseURL + "/projects" + env.ProjectDir + "/test.md")
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "Draft comment")
+	})
+
+	t.Run("submit publishes a numbered round", func(t *testing.T) {
+		resp := submitReview(t)
+		var result map[string]int
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, map[string]int{"review_round": 1, "count": 2}, result)
+
+		event := waitForEvent(t, events)
+		assert.Contains(t, event, `"review_round":1`)
+
+		output, err := env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.NotContains(t, output, "draft comment(s)")
+		assert.Contains(t, output, fmt.Sprintf("## Comment #%d (lines 1-1, review round 1)", draftID))
+		assert.Contains(t, output, "**Reply from User:**\nDraft reply")
+
+		// Nothing left to submit
+		resp = submitReview(t)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("rounds are numbered per file", func(t *testing.T) {
+		createComment(t, map[string]interface{}{
+			"line_start": 3, "line_end": 3, "selected_text": "test",
+			"comment_text": "Second round", "draft": true,
+		})
+
+		resp := submitReview(t)
+		var result map[string]int
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		_ = resp.Body.Close()
+		assert.Equal(t, 2, result["review_round"])
+
+		assert.Contains(t, waitForEvent(t, events), `"review_round":2`)
+	})
+
+	t.Run("comments without draft are published immediately and don't notify", func(t *testing.T) {
+		createComment(t, map[string]interface{}{
+			"line_start": 5, "line_end": 5, "selected_text": "test",
+			"comment_text": "Immediate",
+		})
+
+		output, err := env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, "Immediate")
+		assert.Empty(t, events)
+	})
+}
+
+func TestE2E_Review_Rounds(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	createDraft := func(t *testing.T, line int, text string) int {
+		t.Helper()
+		resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"line_start":        line,
+			"line_end":          line,
+			"selected_text":     "Test",
+			"comment_text":      text,
+			"draft":             true,
+		})
+		defer func() { _ = resp.Body.Close() }()
+		var created map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+		return int(created["id"].(float64))
+	}
+	submitReview := func(t *testing.T) {
+		t.Helper()
+		resp := env.postJSON(t, "/api/reviews", map[string]string{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"author_name":       "alice",
+		})
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	output, err := env.runCLI(t, "rounds", "--file", "test.md", "--project", env.ProjectDir)
+	require.NoError(t, err)
+	assert.Contains(t, output, "No review rounds for test.md")
+
+	// Round 1: two threads, one answered and resolved
+	first := createDraft(t, 1, "First")
+	second := createDraft(t, 3, "Second")
+	submitReview(t)
+	_, err = env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", first), "--message", "Done")
+	require.NoError(t, err)
+	_, err = env.runCLI(t, "resolve", "--comment-id", fmt.Sprintf("%d", first))
+	require.NoError(t, err)
+
+	// The document changes between rounds
+	require.NoError(t, os.WriteFile(filepath.Join(env.ProjectDir, "test.md"), []byte("# Revised\n"), 0o644))
+
+	// Round 2: a new thread, and the agent answers the old one
+	third := createDraft(t, 1, "Third")
+	submitReview(t)
+	_, err = env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", second), "--message", "Answered late")
+	require.NoError(t, err)
+
+	t.Run("text output", func(t *testing.T) {
+		output, err := env.runCLI(t, "rounds", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, "Review rounds for test.md:")
+		assert.Regexp(t, `Round 1 \(submitted [0-9-]+ [0-9:]+ by alice\)`, output)
+		assert.Contains(t, output, fmt.Sprintf("  Opened:   2 thread(s) (#%d, #%d)\n", first, second))
+		assert.Contains(t, output, fmt.Sprintf("  Answered: 1 thread(s) (#%d)\n", first))
+		assert.Contains(t, output, fmt.Sprintf("  Resolved: 1 thread(s) (#%d)\n", first))
+		assert.Contains(t, output, fmt.Sprintf("  Opened:   1 thread(s) (#%d)\n", third))
+		assert.Contains(t, output, fmt.Sprintf("  Answered: 1 thread(s) (#%d)\n", second))
+		assert.Contains(t, output, "  Resolved: 0 thread(s)\n")
+		assert.Contains(t, output, "2 round(s)")
+	})
+
+	t.Run("json output", func(t *testing.T) {
+		output, err := env.runCLI(t, "rounds", "--file", "test.md", "--project", env.ProjectDir, "--format", "json")
+		require.NoError(t, err)
+		var summaries []struct {
+			Round    int   `json:"round"`
+			Opened   []int `json:"opened"`
+			Answered []int `json:"answered"`
+			Resolved []int `json:"resolved"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(output[strings.Index(output, "["):]), &summaries))
+		require.Len(t, summaries, 2)
+		assert.Equal(t, []int{first, second}, summaries[0].Opened)
+		assert.Equal(t, []int{third}, summaries[1].Opened)
+		assert.Equal(t, []int{}, summaries[1].Resolved)
+	})
+
+	t.Run("snapshots", func(t *testing.T) {
+		params := "?project_directory=" + url.QueryEscape(env.ProjectDir) + "&file_path=test.md"
+		for round, want := range map[int]string{1: "# Test Document", 2: "# Revised"} {
+			resp, err := http.Get(fmt.Sprintf("%s/api/rounds/%d/snapshot%s", env.BaseURL, round, params))
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Contains(t, string(body), want)
+		}
+
+		resp, err := http.Get(fmt.Sprintf("%s/api/rounds/3/snapshot%s", env.BaseURL, params))
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("viewer receives the rounds", func(t *testing.T) {
+		resp, err := http.Get(env.BaseURL + "/projects" + env.ProjectDir + "/test.md")
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		require.NoError(t, err)
+		assert.Contains(t, string(body), `let rounds = [{"round":1,`)
+		assert.Contains(t, string(body), `id="round-select"`)
+	})
+}
@@ -0,0 +1,122 @@
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestE2E_CommentRevisions(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+		"project_directory": env.ProjectDir,
+		"file_path":         "test.md",
+		"line_start":        1,
+		"line_end":          1,
+		"selected_text":     "Test Document",
+		"comment_text":      "Rename this heading",
+	})
+	var created map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	_ = resp.Body.Close()
+	commentID := int(created["id"].(float64))
+	assert.NotContains(t, created, "edited_at")
+
+	getRevisions := func(t *testing.T) []map[string]interface{} {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("%s/api/comments/%d/revisions", env.BaseURL, commentID))
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var revisions []map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&revisions))
+		return revisions
+	}
+
+	t.Run("unedited comment has no history", func(t *testing.T) {
+		assert.Empty(t, getRevisions(t))
+
+		output, err := env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.NotContains(t, output, "(edited)")
+	})
+
+	t.Run("edits keep the previous text", func(t *testing.T) {
+		for _, text := range []string{"Rename this heading to **Overview**", "Remove this heading"} {
+			resp := env.patchJSON(t, fmt.Sprintf("/api/comments/%d", commentID),
+				map[string]string{"comment_text": text})
+			var updated map[string]interface{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&updated))
+			_ = resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, text, updated["comment_text"])
+			assert.NotEmpty(t, updated["edited_at"])
+			assert.NotEmpty(t, updated["rendered_html"])
+		}
+
+		revisions := getRevisions(t)
+		require.Len(t, revisions, 2)
+		assert.Equal(t, "edit", revisions[0]["action"])
+		assert.Equal(t, "Rename this heading", revisions[0]["comment_text"])
+		assert.Equal(t, "Rename this heading to **Overview**", revisions[1]["comment_text"])
+
+		output, err := env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, "**User (edited):**\nRemove this heading")
+
+		output, err = env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir, "--format", "json")
+		require.NoError(t, err)
+		assert.Contains(t, output, `"edited_at"`)
+	})
+
+	t.Run("delete and undo", func(t *testing.T) {
+		_, err := env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", commentID), "--message", "Done")
+		require.NoError(t, err)
+
+		resp := env.delete(t, fmt.Sprintf("/api/comments/%d", commentID))
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		output, err := env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, "No unresolved comments")
+
+		// Deleting twice is not found
+		resp = env.delete(t, fmt.Sprintf("/api/comments/%d", commentID))
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp, err = http.Post(fmt.Sprintf("%s/api/comments/%d/restore", env.BaseURL, commentID), "", nil)
+		require.NoError(t, err)
+		var restored map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&restored))
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "Remove this heading", restored["comment_text"])
+
+		// The reply comes back with its thread
+		output, err = env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, "Remove this heading")
+		assert.Contains(t, output, "**Reply from Agent:**\nDone")
+
+		// Restoring a comment that isn't deleted is not found
+		resp, err = http.Post(fmt.Sprintf("%s/api/comments/%d/restore", env.BaseURL, commentID), "", nil)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		revisions := getRevisions(t)
+		require.Len(t, revisions, 4)
+		assert.Equal(t, "delete", revisions[2]["action"])
+		assert.Equal(t, "restore", revisions[3]["action"])
+	})
+}
@@ -436,6 +436,48 @@ func TestE2E_WebInterface_DirectoryListing(t *testing.T) {
 	assert.Contains(t, bodyStr, "simple.md")
 }
 
+func TestE2E_WebInterface_ProjectAssets(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	// Nested document referencing an image next to it
+	docsDir := filepath.Join(env.ProjectDir, "docs")
+	require.NoError(t, os.MkdirAll(filepath.Join(docsDir, "img"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(docsDir, "img", "arch.png"), []byte("\x89PNG\r\n\x1a\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(docsDir, "PLAN.md"),
+		[]byte("# Plan\n\n![diagram](img/arch.png)\n\n[back](../test.md) [gone](GONE.md)\n"), 0644))
+
+	// Viewer rewrites relative links and images
+	resp, err := http.Get(fmt.Sprintf("%s/projects%s/docs/PLAN.md", env.BaseURL, env.ProjectDir))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	bodyStr := string(body)
+	assetURL := fmt.Sprintf("/projects%s/docs/img/arch.png", env.ProjectDir)
+	assert.Contains(t, bodyStr, `src="`+assetURL+`"`)
+	assert.Contains(t, bodyStr, fmt.Sprintf(`href="/projects%s/test.md"`, env.ProjectDir))
+	assert.Contains(t, bodyStr, `class="broken-link"`)
+
+	// Asset is served with content type and ETag from a nested project path
+	resp, err = http.Get(env.BaseURL + assetURL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// Conditional request is answered with 304
+	req, err := http.NewRequest(http.MethodGet, env.BaseURL+assetURL, nil)
+	require.NoError(t, err)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+}
+
 func TestE2E_PathTraversal_Security(t *testing.T) {
 	env := setupE2E(t)
 	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
@@ -509,17 +551,14 @@ func TestE2E_InvalidInput(t *testing.T) {
 		})
 		defer func() { _ = resp.Body.Close() }()
 
-		// Should succeed (UPDATE affects 0 rows but doesn't error)
-		// This is acceptable behavior
-		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
 	})
 
 	t.Run("delete non-existent comment", func(t *testing.T) {
 		resp := env.delete(t, "/api/comments/99999")
 		defer func() { _ = resp.Body.Close() }()
 
-		// Should succeed (DELETE affects 0 rows but doesn't error)
-		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
 	})
 }
 
@@ -1,11 +1,14 @@
 package main_test
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -305,7 +308,7 @@ func TestE2E_ThreadedComments_ResolveViaAPI(t *testing.T) {
 	assert.Contains(t, output, "No unresolved comments")
 }
 
-func TestE2E_ThreadedComments_CannotEditCommentWithReplies(t *testing.T) {
+func TestE2E_ThreadedComments_EditCommentWithReplies(t *testing.T) {
 	env := setupE2E(t)
 	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
 	require.NoError(t, err)
@@ -326,31 +329,611 @@ func TestE2E_ThreadedComments_CannotEditCommentWithReplies(t *testing.T) {
 	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
 	rootID := int(created["id"].(float64))
 
-	// Should be able to edit before replies exist
-	updatePayload := map[string]string{
+	// Add a reply
+	output, err := env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", rootID), "--message", "Agent reply")
+	require.NoError(t, err)
+	var replyID int
+	_, err = fmt.Sscanf(output[strings.Index(output, "(reply #"):], "(reply #%d)", &replyID)
+	require.NoError(t, err)
+
+	// The root comment can still be edited after replies exist
+	updateResp := env.patchJSON(t, fmt.Sprintf("/api/comments/%d", rootID), map[string]string{
 		"comment_text": "Updated comment",
-	}
-	updateResp := env.patchJSON(t, fmt.Sprintf("/api/comments/%d", rootID), updatePayload)
+	})
 	_ = updateResp.Body.Close()
 	assert.Equal(t, http.StatusOK, updateResp.StatusCode)
 
-	// Add a reply
-	_, err = env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", rootID), "--message", "Agent reply")
+	// The web interface can't edit the agent's reply
+	updateResp = env.patchJSON(t, fmt.Sprintf("/api/comments/%d", replyID), map[string]string{
+		"comment_text": "Not mine to change",
+	})
+	_ = updateResp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, updateResp.StatusCode)
+
+	output, err = env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir)
+	require.NoError(t, err)
+	assert.Contains(t, output, "**User (edited):**\nUpdated comment")
+	assert.Contains(t, output, "**Reply from Agent:**\nAgent reply")
+}
+
+func TestE2E_ThreadedComments_EditAndDeleteInViewer(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+		"project_directory": env.ProjectDir,
+		"file_path":         "test.md",
+		"comment_text":      "Fix the tilte",
+	})
+	var created map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	_ = resp.Body.Close()
+	commentID := int(created["id"].(float64))
+
+	// Another viewer of the file
+	sseResp, err := http.Get(fmt.Sprintf("%s/api/events?project_directory=%s&file_path=test.md", env.BaseURL,
+		url.QueryEscape(env.ProjectDir)))
+	require.NoError(t, err)
+	defer func() { _ = sseResp.Body.Close() }()
+	events := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(sseResp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "event: ") {
+				events <- strings.TrimPrefix(line, "event: ")
+			}
+		}
+	}()
+	assert.Equal(t, "connected", waitForEvent(t, events))
+
+	t.Run("blank edits are rejected", func(t *testing.T) {
+		resp := env.patchJSON(t, fmt.Sprintf("/api/comments/%d", commentID), map[string]string{"comment_text": "  \n "})
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("edits are announced", func(t *testing.T) {
+		resp := env.patchJSON(t, fmt.Sprintf("/api/comments/%d", commentID), map[string]string{
+			"comment_text": "Fix the title",
+		})
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "comment_edited", waitForEvent(t, events))
+	})
+
+	t.Run("deletes are announced", func(t *testing.T) {
+		resp := env.delete(t, fmt.Sprintf("/api/comments/%d", commentID))
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "comment_deleted", waitForEvent(t, events))
+	})
+}
+
+func TestE2E_ThreadedComments_EditAndDeleteAgentReply(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+		"project_directory": env.ProjectDir,
+		"file_path":         "test.md",
+		"line_start":        1,
+		"line_end":          1,
+		"selected_text":     "Test Document",
+		"comment_text":      "Fix the title",
+	})
+	var created map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	_ = resp.Body.Close()
+	rootID := int(created["id"].(float64))
+
+	output, err := env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", rootID), "--message", "Fixed the tilte")
 	require.NoError(t, err)
+	var replyID int
+	_, err = fmt.Sscanf(output[strings.Index(output, "(reply #"):], "(reply #%d)", &replyID)
+	require.NoError(t, err)
+
+	// Connect to SSE to observe the events
+	sseResp, err := http.Get(fmt.Sprintf("%s/api/events?project_directory=%s&file_path=test.md", env.BaseURL,
+		url.QueryEscape(env.ProjectDir)))
+	require.NoError(t, err)
+	defer func() { _ = sseResp.Body.Close() }()
+	events := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(sseResp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "event: ") {
+				events <- strings.TrimPrefix(line, "event: ")
+			}
+		}
+	}()
+	assert.Equal(t, "connected", waitForEvent(t, events))
+
+	t.Run("user messages are rejected", func(t *testing.T) {
+		output, err := env.runCLI(t, "edit", "--comment-id", fmt.Sprintf("%d", rootID), "--message", "Hijacked")
+		require.Error(t, err)
+		assert.Contains(t, output, "only agent messages can be changed")
+
+		output, err = env.runCLI(t, "delete", "--comment-id", fmt.Sprintf("%d", rootID))
+		require.Error(t, err)
+		assert.Contains(t, output, "only agent messages can be changed")
+	})
 
-	// Should NOT be able to edit after replies exist
-	updatePayload2 := map[string]string{
-		"comment_text": "Should not update",
+	t.Run("edit", func(t *testing.T) {
+		output, err := env.runCLI(t, "edit", "--comment-id", fmt.Sprintf("%d", replyID), "--message", "   ")
+		require.Error(t, err)
+		assert.Contains(t, output, "comment_text is required")
+
+		output, err = env.runCLI(t, "edit", "--comment-id", fmt.Sprintf("%d", replyID), "--message", "Fixed the title")
+		require.NoError(t, err)
+		assert.Contains(t, output, fmt.Sprintf("Comment %d edited", replyID))
+		assert.Equal(t, "comment_edited", waitForEvent(t, events))
+
+		output, err = env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, "**Reply from Agent (edited):**\nFixed the title")
+
+		revResp, err := http.Get(fmt.Sprintf("%s/api/comments/%d/revisions", env.BaseURL, replyID))
+		require.NoError(t, err)
+		defer func() { _ = revResp.Body.Close() }()
+		var revisions []map[string]interface{}
+		require.NoError(t, json.NewDecoder(revResp.Body).Decode(&revisions))
+		require.Len(t, revisions, 1)
+		assert.Equal(t, "Fixed the tilte", revisions[0]["comment_text"])
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		output, err := env.runCLI(t, "delete", "--comment-id", fmt.Sprintf("%d", replyID))
+		require.NoError(t, err)
+		assert.Contains(t, output, fmt.Sprintf("Comment %d deleted", replyID))
+		assert.Equal(t, "comment_deleted", waitForEvent(t, events))
+
+		output, err = env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, "Fix the title")
+		assert.NotContains(t, output, "Reply from Agent")
+
+		output, err = env.runCLI(t, "edit", "--comment-id", fmt.Sprintf("%d", replyID), "--message", "Too late")
+		require.Error(t, err)
+		assert.Contains(t, output, "not found")
+	})
+}
+
+func waitForEvent(t *testing.T, events <-chan string) string {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for SSE event")
+		return ""
+	}
+}
+
+func TestE2E_ThreadedComments_NamedReviewers(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	createComment := func(t *testing.T, payload map[string]interface{}) int {
+		t.Helper()
+		payload["project_directory"] = env.ProjectDir
+		payload["file_path"] = "test.md"
+		resp := env.postJSON(t, "/api/comments", payload)
+		defer func() { _ = resp.Body.Close() }()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var created map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+		return int(created["id"].(float64))
+	}
+
+	aliceID := createComment(t, map[string]interface{}{
+		"line_start": 1, "line_end": 1, "selected_text": "Test Document",
+		"comment_text": "Alice's comment", "author_name": "  alice ",
+	})
+	bobID := createComment(t, map[string]interface{}{
+		"line_start": 3, "line_end": 3, "selected_text": "This is a test",
+		"comment_text": "Bob's comment", "author_name": "bob",
+	})
+	createComment(t, map[string]interface{}{
+		"comment_text": "Alice agrees", "author_name": "alice", "root_id": bobID,
+	})
+	createComment(t, map[string]interface{}{
+		"line_start": 3, "line_end": 3, "selected_text": "test",
+		"comment_text": "Anonymous comment",
+	})
+
+	t.Run("names are shown", func(t *testing.T) {
+		output, err := env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, "**alice:**\nAlice's comment")
+		assert.Contains(t, output, "**bob:**\nBob's comment")
+		assert.Contains(t, output, "**Reply from alice:**\nAlice agrees")
+		assert.Contains(t, output, "**User:**\nAnonymous comment")
+	})
+
+	t.Run("filter by reviewer", func(t *testing.T) {
+		output, err := env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir, "--author", "Alice")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Found 2 unresolved comment(s) for test.md from Alice")
+		assert.Contains(t, output, fmt.Sprintf("## Comment #%d", aliceID))
+		assert.Contains(t, output, fmt.Sprintf("## Comment #%d", bobID), "Threads alice replied to are included")
+		assert.NotContains(t, output, "Anonymous comment")
+
+		output, err = env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir, "--author", "user")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Found 1 unresolved comment(s)")
+		assert.Contains(t, output, "Anonymous comment")
+
+		output, err = env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir, "--author", "carol")
+		require.NoError(t, err)
+		assert.Contains(t, output, "No unresolved comments for test.md from carol")
+	})
+
+	t.Run("json output keeps role and name", func(t *testing.T) {
+		output, err := env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir,
+			"--format", "json", "--author", "bob")
+		require.NoError(t, err)
+		var result struct {
+			Threads []struct {
+				Messages []map[string]interface{} `json:"messages"`
+			} `json:"threads"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(output[strings.Index(output, "{"):]), &result))
+		require.Len(t, result.Threads, 1)
+		assert.Equal(t, "user", result.Threads[0].Messages[0]["author"])
+		assert.Equal(t, "bob", result.Threads[0].Messages[0]["author_name"])
+	})
+
+	t.Run("overlong names are rejected", func(t *testing.T) {
+		resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+			"project_directory": env.ProjectDir, "file_path": "test.md",
+			"line_start": 1, "line_end": 1, "selected_text": "Test", "comment_text": "x",
+			"author_name": strings.Repeat("a", 65),
+		})
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestE2E_ThreadedComments_AgentSessions(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	var rootIDs []int
+	for _, line := range []int{1, 3, 5} {
+		resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"line_start":        line,
+			"line_end":          line,
+			"selected_text":     "Test",
+			"comment_text":      fmt.Sprintf("Comment on line %d", line),
+		})
+		var created map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+		_ = resp.Body.Close()
+		rootIDs = append(rootIDs, int(created["id"].(float64)))
 	}
-	updateResp2 := env.patchJSON(t, fmt.Sprintf("/api/comments/%d", rootID), updatePayload2)
-	defer func() { _ = updateResp2.Body.Close() }()
-	assert.Equal(t, http.StatusBadRequest, updateResp2.StatusCode)
-
-	// Verify error message
-	var errorResp map[string]string
-	err = json.NewDecoder(updateResp2.Body).Decode(&errorResp)
-	if err == nil {
-		// If we got JSON, check the error message
-		t.Logf("Error response: %v", errorResp)
+
+	// Session 1 passes its ID explicitly, session 2 through the environment
+	output, err := env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", rootIDs[0]), "--message", "On it",
+		"--agent-id", "session-1")
+	require.NoError(t, err)
+	var replyID int
+	_, err = fmt.Sscanf(output[strings.Index(output, "(reply #"):], "(reply #%d)", &replyID)
+	require.NoError(t, err)
+
+	t.Setenv("CR_AGENT_ID", "session-2")
+	_, err = env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", rootIDs[1]), "--message", "Looking")
+	require.NoError(t, err)
+
+	t.Run("replies show the session", func(t *testing.T) {
+		output, err := env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, "**Reply from Agent (session-1):**\nOn it")
+		assert.Contains(t, output, "**Reply from Agent (session-2):**\nLooking")
+	})
+
+	t.Run("filter by session", func(t *testing.T) {
+		output, err := env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir,
+			"--agent-id", "session-1")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Found 1 unresolved comment(s) for test.md touched by agent session-1")
+		assert.Contains(t, output, "Comment on line 1")
+		assert.NotContains(t, output, "Comment on line 3")
+
+		// Both sessions are agents
+		output, err = env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir, "--author", "agent")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Found 2 unresolved comment(s)")
+	})
+
+	t.Run("filter includes threads the session claimed", func(t *testing.T) {
+		_, err := env.runCLI(t, "status-update", "--comment-id", fmt.Sprintf("%d", rootIDs[2]), "--state", "working",
+			"--agent-id", "session-1")
+		require.NoError(t, err)
+
+		output, err := env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir,
+			"--agent-id", "session-1")
+		require.NoError(t, err)
+		assert.Contains(t, output, "Found 2 unresolved comment(s) for test.md touched by agent session-1")
+		assert.Contains(t, output, "Comment on line 1")
+		assert.Contains(t, output, "Comment on line 5")
+		assert.NotContains(t, output, "Comment on line 3")
+	})
+
+	t.Run("sessions can't change each other's replies", func(t *testing.T) {
+		output, err := env.runCLI(t, "edit", "--comment-id", fmt.Sprintf("%d", replyID), "--message", "Mine now")
+		require.Error(t, err)
+		assert.Contains(t, output, `belongs to agent session "session-1"`)
+
+		output, err = env.runCLI(t, "edit", "--comment-id", fmt.Sprintf("%d", replyID), "--message", "Done",
+			"--agent-id", "session-1")
+		require.NoError(t, err)
+		assert.Contains(t, output, "edited")
+	})
+
+	t.Run("resolving records the session", func(t *testing.T) {
+		_, err := env.runCLI(t, "resolve", "--comment-id", fmt.Sprintf("%d", rootIDs[1]))
+		require.NoError(t, err)
+
+		var resolvedBy, resolvedAgentID string
+		testDB := openTestDB(t, env)
+		require.NoError(t, testDB.QueryRow("SELECT resolved_by, resolved_agent_id FROM comments WHERE id = ?",
+			rootIDs[1]).Scan(&resolvedBy, &resolvedAgentID))
+		assert.Equal(t, "agent", resolvedBy)
+		assert.Equal(t, "session-2", resolvedAgentID)
+	})
+}
+
+func TestE2E_ThreadedComments_DocumentLevel(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	// An anchored comment first, so ordering can't come from creation time
+	resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+		"project_directory": env.ProjectDir,
+		"file_path":         "test.md",
+		"line_start":        1,
+		"line_end":          1,
+		"selected_text":     "Test Document",
+		"comment_text":      "Rename this",
+	})
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = env.postJSON(t, "/api/comments", map[string]interface{}{
+		"project_directory": env.ProjectDir,
+		"file_path":         "test.md",
+		"comment_text":      "This whole doc should be shorter",
+	})
+	var docComment map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&docComment))
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	docID := int(docComment["id"].(float64))
+
+	t.Run("partial anchors are rejected", func(t *testing.T) {
+		resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"line_start":        1,
+			"comment_text":      "Missing the rest",
+		})
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("address prints document comments first", func(t *testing.T) {
+		output, err := env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+
+		docHeader := fmt.Sprintf("## Comment #%d (whole document)", docID)
+		assert.Contains(t, output, docHeader)
+		assert.Contains(t, output, "## Comment #1 (lines 1-1)")
+		assert.Less(t, strings.Index(output, docHeader), strings.Index(output, "## Comment #1 (lines 1-1)"))
+	})
+
+	t.Run("document comments can be replied to and resolved", func(t *testing.T) {
+		_, err := env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", docID), "--message", "Trimmed it")
+		require.NoError(t, err)
+
+		output, err := env.runCLI(t, "resolve", "--comment-id", fmt.Sprintf("%d", docID))
+		require.NoError(t, err)
+		assert.Contains(t, output, "Resolved")
+
+		output, err = env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.NotContains(t, output, "whole document")
+	})
+}
+
+// addressedThread is a thread as listed by address --format json
+type addressedThread struct {
+	ID           int    `json:"id"`
+	LineStart    *int   `json:"line_start"`
+	LineEnd      *int   `json:"line_end"`
+	SelectedText string `json:"selected_text"`
+	Messages     []struct {
+		ID          int    `json:"id"`
+		Author      string `json:"author"`
+		AuthorName  string `json:"author_name"`
+		AgentID     string `json:"agent_id"`
+		CommentText string `json:"comment_text"`
+	} `json:"messages"`
+}
+
+// addressThreads returns the unresolved threads of a file as the agent sees them
+func (env *TestEnv) addressThreads(t *testing.T, filePath string) []addressedThread {
+	t.Helper()
+
+	output, err := env.runCLI(t, "address", "--file", filePath, "--project", env.ProjectDir, "--format", "json")
+	require.NoError(t, err)
+
+	// Logs go to stderr, the JSON document starts at the first brace
+	var result struct {
+		Threads []addressedThread `json:"threads"`
 	}
+	require.NoError(t, json.Unmarshal([]byte(output[strings.Index(output, "{"):]), &result))
+	return result.Threads
+}
+
+func TestE2E_ThreadedComments_AgentQuestions(t *testing.T) {
+	env := setupE2E(t)
+
+	t.Run("selections are checked against the file", func(t *testing.T) {
+		output, err := env.runCLI(t, "ask", "--file", "test.md", "--project", env.ProjectDir,
+			"--lines", "5-7", "--text", "Final paragraph", "--message", "Is this right?")
+		require.Error(t, err)
+		assert.Contains(t, output, `"Final paragraph" is not on lines 5-7 of test.md`)
+
+		output, err = env.runCLI(t, "ask", "--file", "test.md", "--project", env.ProjectDir,
+			"--lines", "18-25", "--message", "Is this right?")
+		require.Error(t, err)
+		assert.Contains(t, output, "outside test.md, which has 19 lines")
+
+		output, err = env.runCLI(t, "ask", "--file", "test.md", "--project", env.ProjectDir,
+			"--lines", "7-5", "--message", "Is this right?")
+		require.Error(t, err)
+		assert.Contains(t, output, "the end is before the start")
+	})
+
+	var questionID int
+	t.Run("questions start agent threads", func(t *testing.T) {
+		output, err := env.runCLI(t, "ask", "--file", "test.md", "--project", env.ProjectDir, "--agent-id", "session-1",
+			"--lines", "5-7", "--text", "Section 2", "--message", "Should this section cover rollback?")
+		require.NoError(t, err)
+		_, err = fmt.Sscanf(output[strings.Index(output, "(comment #"):], "(comment #%d)", &questionID)
+		require.NoError(t, err)
+
+		threads := env.addressThreads(t, "test.md")
+		require.Len(t, threads, 1)
+		assert.Equal(t, questionID, threads[0].ID)
+		assert.Equal(t, "Section 2", threads[0].SelectedText)
+		assert.Equal(t, 5, *threads[0].LineStart)
+		assert.Equal(t, 7, *threads[0].LineEnd)
+		assert.Equal(t, "agent", threads[0].Messages[0].Author)
+		assert.Equal(t, "session-1", threads[0].Messages[0].AgentID)
+		assert.Empty(t, threads[0].Messages[0].AuthorName)
+	})
+
+	t.Run("the selection defaults to the first block on the lines", func(t *testing.T) {
+		_, err := env.runCLI(t, "ask", "--file", "test.md", "--project", env.ProjectDir,
+			"--lines", "2-4", "--message", "Too vague?")
+		require.NoError(t, err)
+
+		threads := env.addressThreads(t, "test.md")
+		require.Len(t, threads, 2)
+		assert.Equal(t, "This is a test paragraph with some content.", threads[1].SelectedText)
+	})
+
+	t.Run("the reviewer answers in the thread", func(t *testing.T) {
+		resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"root_id":           questionID,
+			"comment_text":      "Yes, briefly",
+		})
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		output, err := env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, "**Agent (session-1):**\nShould this section cover rollback?")
+		assert.Contains(t, output, "**Reply from User:**\nYes, briefly")
+	})
+}
+
+func TestE2E_ThreadedComments_TerminalReviewer(t *testing.T) {
+	env := setupE2E(t)
+
+	// Connect to SSE to observe the events
+	sseResp, err := http.Get(fmt.Sprintf("%s/api/events?project_directory=%s&file_path=test.md", env.BaseURL,
+		url.QueryEscape(env.ProjectDir)))
+	require.NoError(t, err)
+	defer func() { _ = sseResp.Body.Close() }()
+	events := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(sseResp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "event: ") {
+				events <- strings.TrimPrefix(line, "event: ")
+			}
+		}
+	}()
+	assert.Equal(t, "connected", waitForEvent(t, events))
+
+	t.Run("comments are validated", func(t *testing.T) {
+		output, err := env.runCLI(t, "comment", "--file", "test.md", "--project", env.ProjectDir, "--lines", "3")
+		require.Error(t, err)
+		assert.Contains(t, output, "--message flag is required")
+
+		output, err = env.runCLI(t, "comment", "--file", "test.md", "--project", env.ProjectDir,
+			"--lines", "3", "--quote", "not in the document", "--message", "Hmm")
+		require.Error(t, err)
+		assert.Contains(t, output, `"not in the document" is not on lines 3-3 of test.md`)
+
+		output, err = env.runCLI(t, "comment", "--file", "test.md", "--project", env.ProjectDir,
+			"--lines", "0-2", "--message", "Hmm")
+		require.Error(t, err)
+		assert.Contains(t, output, `invalid line range "0-2"`)
+
+		output, err = env.runCLI(t, "comment", "--file", "missing.md", "--project", env.ProjectDir, "--message", "Hmm")
+		require.Error(t, err)
+		assert.Contains(t, output, "no such file or directory")
+	})
+
+	var rootID int
+	t.Run("comments are published and shown to viewers", func(t *testing.T) {
+		output, err := env.runCLI(t, "comment", "--file", "test.md", "--project", env.ProjectDir,
+			"--lines", "3", "--message", "Too short")
+		require.NoError(t, err)
+		_, err = fmt.Sscanf(output[strings.Index(output, "(comment #"):], "(comment #%d)", &rootID)
+		require.NoError(t, err)
+		assert.Equal(t, "comment_added", waitForEvent(t, events))
+
+		threads := env.addressThreads(t, "test.md")
+		require.Len(t, threads, 1)
+		assert.Equal(t, "This is a test paragraph with some content.", threads[0].SelectedText)
+		assert.Equal(t, 3, *threads[0].LineStart)
+		assert.Equal(t, "user", threads[0].Messages[0].Author)
+	})
+
+	t.Run("quotes may use the text shown in the viewer", func(t *testing.T) {
+		_, err := env.runCLI(t, "comment", "--file", "test.md", "--project", env.ProjectDir, "--name", "alice",
+			"--lines", "5-7", "--quote", "Section 2", "--message", "Rename this")
+		require.NoError(t, err)
+		assert.Equal(t, "comment_added", waitForEvent(t, events))
+
+		output, err := env.runCLI(t, "address", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, "> Section 2\n")
+		assert.Contains(t, output, "**alice:**\nRename this")
+	})
+
+	t.Run("replies as the user", func(t *testing.T) {
+		_, err := env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", rootID), "--message", "Expanded it")
+		require.NoError(t, err)
+		assert.Equal(t, "comment_added", waitForEvent(t, events))
+
+		output, err := env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", rootID), "--as", "reviewer",
+			"--message", "Thanks")
+		require.Error(t, err)
+		assert.Contains(t, output, "--as must be agent or user")
+
+		_, err = env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", rootID), "--as", "user",
+			"--message", "Still too short")
+		require.NoError(t, err)
+		assert.Equal(t, "comment_added", waitForEvent(t, events))
+
+		threads := env.addressThreads(t, "test.md")
+		require.Len(t, threads[0].Messages, 3)
+		assert.Equal(t, "agent", threads[0].Messages[1].Author)
+		assert.Equal(t, "user", threads[0].Messages[2].Author)
+		assert.Equal(t, "Still too short", threads[0].Messages[2].CommentText)
+	})
 }
@@ -0,0 +1,133 @@
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestE2E_Verdict(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	t.Run("not approved without a verdict", func(t *testing.T) {
+		output, err := env.runCLI(t, "status", "--file", "test.md", "--project", env.ProjectDir)
+		require.Error(t, err)
+		assert.Contains(t, output, "test.md: in progress (no verdict yet)")
+	})
+
+	t.Run("verdict requires exactly one status", func(t *testing.T) {
+		output, err := env.runCLI(t, "verdict", "--file", "test.md", "--project", env.ProjectDir)
+		require.Error(t, err)
+		assert.Contains(t, output, "exactly one of --approve, --request-changes or --in-progress")
+
+		_, err = env.runCLI(t, "verdict", "--file", "test.md", "--project", env.ProjectDir, "--approve",
+			"--request-changes")
+		require.Error(t, err)
+	})
+
+	t.Run("changes requested from the viewer", func(t *testing.T) {
+		resp := env.postJSON(t, "/api/verdicts", map[string]string{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"status":            "changes_requested",
+			"author_name":       "alice",
+			"note":              "Needs a rollout plan",
+		})
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		output, err := env.runCLI(t, "status", "--file", "test.md", "--project", env.ProjectDir)
+		require.Error(t, err)
+		assert.Contains(t, output, "test.md: changes requested by alice: Needs a rollout plan")
+	})
+
+	t.Run("invalid status is rejected", func(t *testing.T) {
+		resp := env.postJSON(t, "/api/verdicts", map[string]string{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"status":            "lgtm",
+		})
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("approved from the CLI", func(t *testing.T) {
+		output, err := env.runCLI(t, "verdict", "--file", "test.md", "--project", env.ProjectDir, "--approve",
+			"--author", "bob")
+		require.NoError(t, err)
+		assert.Contains(t, output, "test.md is now approved")
+
+		output, err = env.runCLI(t, "status", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err, "Status should exit zero once approved")
+		assert.Contains(t, output, "test.md: approved by bob")
+
+		output, err = env.runCLI(t, "status", "--file", "test.md", "--project", env.ProjectDir, "--history")
+		require.NoError(t, err)
+		assert.Contains(t, output, "changes requested by alice: Needs a rollout plan")
+		assert.Contains(t, output, "approved by bob")
+	})
+
+	t.Run("history is available to the viewer", func(t *testing.T) {
+		resp, err := http.Get(fmt.Sprintf("%s/api/verdicts?project_directory=%s&file_path=test.md", env.BaseURL,
+			url.QueryEscape(env.ProjectDir)))
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		var verdicts []map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&verdicts))
+		require.Len(t, verdicts, 2)
+		assert.Equal(t, "changes_requested", verdicts[0]["status"])
+		assert.Equal(t, "approved", verdicts[1]["status"])
+
+		page, err := http.Get(env.BaseURL + "/projects" + env.ProjectDir + "/test.md")
+		require.NoError(t, err)
+		body, err := io.ReadAll(page.Body)
+		_ = page.Body.Close()
+		require.NoError(t, err)
+		assert.Contains(t, string(body), `let verdicts = [{"id":1,`)
+	})
+
+	t.Run("reopening the review", func(t *testing.T) {
+		_, err := env.runCLI(t, "verdict", "--file", "@test.md", "--project", env.ProjectDir, "--in-progress")
+		require.NoError(t, err)
+
+		output, err := env.runCLI(t, "status", "--file", "test.md", "--project", env.ProjectDir)
+		require.Error(t, err)
+		assert.Contains(t, output, "test.md: in progress")
+	})
+}
+
+func TestE2E_Verdict_UnregisteredProject(t *testing.T) {
+	env := setupE2E(t)
+
+	t.Run("from the viewer", func(t *testing.T) {
+		resp := env.postJSON(t, "/api/verdicts", map[string]string{
+			"project_directory": env.ProjectDir,
+			"file_path":         "other.md",
+			"status":            "approved",
+		})
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		output, err := env.runCLI(t, "status", "--file", "other.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, "other.md: approved")
+	})
+
+	t.Run("from the CLI", func(t *testing.T) {
+		output, err := env.runCLI(t, "verdict", "--file", "test.md", "--project", env.ProjectDir, "--approve")
+		require.NoError(t, err)
+		assert.Contains(t, output, "test.md is now approved")
+
+		output, err = env.runCLI(t, "status", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+		assert.Contains(t, output, "test.md: approved")
+	})
+}
@@ -379,6 +379,52 @@ func TestE2E_FileWatcher_SameFileMultipleClients(t *testing.T) {
 	}
 }
 
+func TestE2E_FileWatcher_ClientLeaves(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	sseURL := fmt.Sprintf("%s/api/events?project_directory=%s&file_path=test.md",
+		env.BaseURL, url.QueryEscape(env.ProjectDir))
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	leaving, err := client.Get(sseURL)
+	require.NoError(t, err)
+	staying, err := client.Get(sseURL)
+	require.NoError(t, err)
+	defer func() { _ = staying.Body.Close() }()
+
+	// One viewer (e.g. the terminal UI) disconnecting must not stop the updates of the others
+	_ = leaving.Body.Close()
+	time.Sleep(300 * time.Millisecond)
+
+	testFile := filepath.Join(env.ProjectDir, "test.md")
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		content, _ := os.ReadFile(testFile)
+		_ = os.WriteFile(testFile, append(content, []byte("\n\n## Still Watched\n")...), 0644)
+	}()
+
+	received := make(chan bool, 1)
+	go func() {
+		scanner := bufio.NewScanner(staying.Body)
+		for scanner.Scan() {
+			if strings.Contains(scanner.Text(), "event: file_updated") {
+				received <- true
+				return
+			}
+		}
+		received <- false
+	}()
+
+	select {
+	case ok := <-received:
+		assert.True(t, ok, "the remaining client should receive file_updated")
+	case <-time.After(3 * time.Second):
+		t.Fatal("the remaining client did not receive file_updated")
+	}
+}
+
 func TestE2E_FileWatcher_DirectoryDeletion(t *testing.T) {
 	env := setupE2E(t)
 	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
@@ -0,0 +1,336 @@
+package main_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookRequest is a request received by a webhookReceiver
+type webhookRequest struct {
+	Event     string
+	Delivery  string
+	Signature string
+	Body      []byte
+}
+
+// webhookReceiver stands in for a webhook endpoint. It fails the first failures requests.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	requests []webhookRequest
+	failures int
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, webhookRequest{
+		Event:     req.Header.Get("X-Claude-Review-Event"),
+		Delivery:  req.Header.Get("X-Claude-Review-Delivery"),
+		Signature: req.Header.Get("X-Claude-Review-Signature"),
+		Body:      body,
+	})
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+// waitForRequests waits until the receiver got n requests and returns them
+func (r *webhookReceiver) waitForRequests(t *testing.T, n int, timeout time.Duration) []webhookRequest {
+	t.Helper()
+
+	var requests []webhookRequest
+	require.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		requests = append([]webhookRequest(nil), r.requests...)
+		return len(requests) >= n
+	}, timeout, 50*time.Millisecond, "expected %d webhook request(s)", n)
+	return requests
+}
+
+func (r *webhookReceiver) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = nil
+}
+
+func TestE2E_Webhooks(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	env.writeProjectConfig(t, fmt.Sprintf(`
+[[webhooks]]
+url = %q
+secret = "s3cret"
+`, server.URL))
+	env.allowProjectConfig(t)
+
+	var rootID int
+	t.Run("submitted comments are sent signed", func(t *testing.T) {
+		resp := env.postJSON(t, "/api/comments", map[string]interface{}{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"line_start":        1,
+			"line_end":          1,
+			"selected_text":     "Test Document",
+			"comment_text":      "Please expand",
+			"author_name":       "Alice",
+			"draft":             true,
+		})
+		var root map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&root))
+		_ = resp.Body.Close()
+		rootID = int(root["id"].(float64))
+
+		resp = env.postJSON(t, "/api/reviews", map[string]string{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+		})
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		requests := receiver.waitForRequests(t, 1, 5*time.Second)
+		request := requests[0]
+		assert.Equal(t, "comment_created", request.Event)
+		assert.NotEmpty(t, request.Delivery)
+
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(request.Body)
+		assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), request.Signature)
+
+		var payload struct {
+			Event            string `json:"event"`
+			ProjectDirectory string `json:"project_directory"`
+			FilePath         string `json:"file_path"`
+			Comment          struct {
+				ID          int    `json:"id"`
+				CommentText string `json:"comment_text"`
+				AuthorName  string `json:"author_name"`
+			} `json:"comment"`
+		}
+		require.NoError(t, json.Unmarshal(request.Body, &payload))
+		assert.Equal(t, "comment_created", payload.Event)
+		assert.Equal(t, env.ProjectDir, payload.ProjectDirectory)
+		assert.Equal(t, "test.md", payload.FilePath)
+		assert.Equal(t, rootID, payload.Comment.ID)
+		assert.Equal(t, "Please expand", payload.Comment.CommentText)
+		assert.Equal(t, "Alice", payload.Comment.AuthorName)
+	})
+
+	t.Run("agent replies, resolutions and verdicts are sent", func(t *testing.T) {
+		receiver.reset()
+
+		_, err := env.runCLI(t, "reply", "--comment-id", fmt.Sprintf("%d", rootID), "--message", "Expanded")
+		require.NoError(t, err)
+		receiver.waitForRequests(t, 1, 5*time.Second)
+
+		_, err = env.runCLI(t, "resolve", "--comment-id", fmt.Sprintf("%d", rootID))
+		require.NoError(t, err)
+		receiver.waitForRequests(t, 2, 5*time.Second)
+
+		resp := env.postJSON(t, "/api/verdicts", map[string]string{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"status":            "approved",
+		})
+		_ = resp.Body.Close()
+		requests := receiver.waitForRequests(t, 3, 5*time.Second)
+
+		var events []string
+		for _, request := range requests {
+			events = append(events, request.Event)
+		}
+		assert.Equal(t, []string{"comment_replied", "thread_resolved", "verdict_recorded"}, events)
+
+		var resolved struct {
+			Comment struct {
+				ID int `json:"id"`
+			} `json:"comment"`
+		}
+		require.NoError(t, json.Unmarshal(requests[1].Body, &resolved))
+		assert.Equal(t, rootID, resolved.Comment.ID)
+
+		var verdict struct {
+			Verdict struct {
+				Status string `json:"status"`
+			} `json:"verdict"`
+		}
+		require.NoError(t, json.Unmarshal(requests[2].Body, &verdict))
+		assert.Equal(t, "approved", verdict.Verdict.Status)
+	})
+
+	t.Run("failed requests are retried", func(t *testing.T) {
+		receiver.reset()
+		receiver.mu.Lock()
+		receiver.failures = 1
+		receiver.mu.Unlock()
+
+		resp := env.postJSON(t, "/api/verdicts", map[string]string{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"status":            "changes_requested",
+		})
+		_ = resp.Body.Close()
+
+		requests := receiver.waitForRequests(t, 2, 10*time.Second)
+		assert.Equal(t, requests[0].Delivery, requests[1].Delivery)
+		assert.Equal(t, requests[0].Body, requests[1].Body)
+	})
+
+	t.Run("events can be filtered", func(t *testing.T) {
+		receiver.reset()
+		env.writeProjectConfig(t, fmt.Sprintf(`
+[[webhooks]]
+url = %q
+events = ["thread_resolved"]
+`, server.URL))
+		env.allowProjectConfig(t)
+
+		resp := env.postJSON(t, "/api/verdicts", map[string]string{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"status":            "approved",
+		})
+		_ = resp.Body.Close()
+
+		resp = env.postJSON(t, "/api/comments", map[string]interface{}{
+			"project_directory": env.ProjectDir,
+			"file_path":         "test.md",
+			"comment_text":      "One more thing",
+		})
+		_ = resp.Body.Close()
+		_, err := env.runCLI(t, "resolve", "--file", "test.md", "--project", env.ProjectDir)
+		require.NoError(t, err)
+
+		requests := receiver.waitForRequests(t, 1, 5*time.Second)
+		assert.Equal(t, "thread_resolved", requests[0].Event)
+		assert.Empty(t, requests[0].Signature)
+	})
+}
+
+func TestE2E_Webhooks_NotAllowed(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	env.writeProjectConfig(t, fmt.Sprintf(`
+[[webhooks]]
+url = %q
+`, server.URL))
+
+	resp := env.postJSON(t, "/api/verdicts", map[string]string{
+		"project_directory": env.ProjectDir,
+		"file_path":         "test.md",
+		"status":            "approved",
+	})
+	_ = resp.Body.Close()
+
+	require.Eventually(t, func() bool {
+		logs, err := os.ReadFile(env.LogFile)
+		return err == nil && strings.Contains(string(logs), "Not sending webhooks: ") &&
+			strings.Contains(string(logs), "is not allowed to run commands")
+	}, 5*time.Second, 50*time.Millisecond)
+	time.Sleep(500 * time.Millisecond)
+	receiver.mu.Lock()
+	assert.Empty(t, receiver.requests)
+	receiver.mu.Unlock()
+
+	// Allowing the file shows where it sends review activity
+	output := env.allowProjectConfig(t)
+	assert.Contains(t, output, "webhooks.url: "+server.URL)
+
+	resp = env.postJSON(t, "/api/verdicts", map[string]string{
+		"project_directory": env.ProjectDir,
+		"file_path":         "test.md",
+		"status":            "approved",
+	})
+	_ = resp.Body.Close()
+	requests := receiver.waitForRequests(t, 1, 5*time.Second)
+	assert.Equal(t, "verdict_recorded", requests[0].Event)
+}
+
+func TestE2E_Webhooks_QueueSurvivesRestart(t *testing.T) {
+	env := setupE2E(t)
+	_, err := env.runCLI(t, "register", "--project", env.ProjectDir)
+	require.NoError(t, err)
+
+	// Reserve an address for the receiver, which isn't listening yet
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	receiverURL := "http://" + listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	env.writeProjectConfig(t, fmt.Sprintf(`
+[[webhooks]]
+url = %q
+`, receiverURL))
+	env.allowProjectConfig(t)
+
+	resp := env.postJSON(t, "/api/verdicts", map[string]string{
+		"project_directory": env.ProjectDir,
+		"file_path":         "test.md",
+		"status":            "approved",
+	})
+	_ = resp.Body.Close()
+
+	// Wait for the first attempt to fail, then stop the server
+	failed := regexp.MustCompile(`Webhook \d+ \(verdict_recorded\) to .* failed`)
+	require.Eventually(t, func() bool {
+		logs, err := os.ReadFile(env.LogFile)
+		return err == nil && failed.Match(logs)
+	}, 5*time.Second, 50*time.Millisecond)
+	require.NoError(t, env.ServerCmd.Process.Signal(os.Interrupt))
+	_ = env.ServerCmd.Wait()
+
+	receiver := &webhookReceiver{}
+	listener, err = net.Listen("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	server := &httptest.Server{Listener: listener, Config: &http.Server{Handler: receiver}}
+	server.Start()
+	defer server.Close()
+
+	// A new server picks up the queued request
+	serverCmd := exec.Command(env.BinaryPath, "server")
+	serverCmd.Env = append(os.Environ(),
+		"CR_DATA_DIR="+env.DataDir,
+		"CR_LISTEN_PORT="+env.Port,
+		"GOCOVERDIR=tmp/coverage",
+	)
+	require.NoError(t, serverCmd.Start())
+	defer func() {
+		_ = serverCmd.Process.Signal(os.Interrupt)
+		_ = serverCmd.Wait()
+	}()
+
+	requests := receiver.waitForRequests(t, 1, 10*time.Second)
+	assert.Equal(t, "verdict_recorded", requests[0].Event)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// defaultHookTimeout is how long a hook command may run when the project doesn't set timeout_seconds
+const defaultHookTimeout = 30 * time.Second
+
+// EventHooks are the [hooks] section of a project's configuration: shell commands run on review activity
+type EventHooks struct {
+	OnUserComment    string `toml:"on_user_comment"`    // The reviewer submitted a review or commented
+	OnThreadResolved string `toml:"on_thread_resolved"` // A thread was resolved
+	OnVerdict        string `toml:"on_verdict"`         // The reviewer recorded a verdict
+	OnFileChanged    string `toml:"on_file_changed"`    // A document open in a viewer changed on disk
+	TimeoutSeconds   int    `toml:"timeout_seconds"`
+}
+
+// command returns the command configured for a hook, or "" if there is none
+func (h EventHooks) command(hook string) string {
+	switch hook {
+	case "on_user_comment":
+		return h.OnUserComment
+	case "on_thread_resolved":
+		return h.OnThreadResolved
+	case "on_verdict":
+		return h.OnVerdict
+	case "on_file_changed":
+		return h.OnFileChanged
+	}
+	return ""
+}
+
+func (h EventHooks) timeout() time.Duration {
+	if h.TimeoutSeconds > 0 {
+		return time.Duration(h.TimeoutSeconds) * time.Second
+	}
+	return defaultHookTimeout
+}
+
+// hookEvents maps the SSE events that trigger hooks to the hook they trigger. comment_added only triggers it for the
+// reviewer's comments (see isUserCommentAdded).
+var hookEvents = map[string]string{
+	"review_submitted":  "on_user_comment",
+	"comment_added":     "on_user_comment",
+	"comments_resolved": "on_thread_resolved",
+	"verdict_changed":   "on_verdict",
+	"file_updated":      "on_file_changed",
+}
+
+// hookPayload is the JSON a hook command gets on stdin. Data is the data of the SSE event.
+type hookPayload struct {
+	Hook             string      `json:"hook"`
+	Event            string      `json:"event"`
+	ProjectDirectory string      `json:"project_directory"`
+	FilePath         string      `json:"file_path"`
+	Data             interface{} `json:"data"`
+}
+
+// publishEvent broadcasts an event to the viewers of a file and passes it on to the project's hooks, webhooks and
+// autopilot
+func publishEvent(projectDir, filePath, event string, data interface{}) {
+	sseHub.broadcast(projectDir, filePath, event, data)
+	dispatchEvent(projectDir, filePath, event, data)
+}
+
+// dispatchEvent passes an event on to the project's hooks, webhooks and autopilot without broadcasting it, for changes
+// that the viewer that made them shows by itself
+func dispatchEvent(projectDir, filePath, event string, data interface{}) {
+	runEventHook(projectDir, filePath, event, data)
+	enqueueWebhooks(projectDir, filePath, event, data)
+	scheduleAutopilot(projectDir, filePath, event, data)
+}
+
+// runEventHook runs the project's hook for an event in the background, if one is configured. Hooks run in the
+// project directory with the event on stdin, and their outcome is logged.
+func runEventHook(projectDir, filePath, event string, data interface{}) {
+	hook, ok := hookEvents[event]
+	if !ok {
+		return
+	}
+
+	go func() {
+		if event == "comment_added" {
+			userComment, err := isUserCommentAdded(data)
+			if err != nil {
+				log.Printf("Not running %s hook: %v", hook, err)
+				return
+			}
+			if !userComment {
+				return
+			}
+		}
+
+		config, err := loadProjectConfig(projectDir)
+		if err != nil {
+			log.Printf("Not running %s hook: %v", hook, err)
+			return
+		}
+		command := config.Hooks.command(hook)
+		if command == "" {
+			return
+		}
+		if err := config.checkCommandsAllowed(); err != nil {
+			log.Printf("Not running %s hook: %v", hook, err)
+			return
+		}
+
+		payload, err := json.Marshal(hookPayload{
+			Hook:             hook,
+			Event:            event,
+			ProjectDirectory: projectDir,
+			FilePath:         filePath,
+			Data:             data,
+		})
+		if err != nil {
+			log.Printf("Failed to marshal %s hook payload: %v", hook, err)
+			return
+		}
+
+		timeout := config.Hooks.timeout()
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Dir = projectDir
+		cmd.Stdin = bytes.NewReader(payload)
+		// Don't wait for background processes of the hook that keep its output open
+		cmd.WaitDelay = time.Second
+
+		start := time.Now()
+		output, err := cmd.CombinedOutput()
+		elapsed := time.Since(start).Round(time.Millisecond)
+		outputText := strings.TrimSpace(string(output))
+
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			log.Printf("Hook %s for %s timed out after %s: %s", hook, filePath, timeout, outputText)
+		case err != nil:
+			log.Printf("Hook %s for %s failed after %s: %v: %s", hook, filePath, elapsed, err, outputText)
+		default:
+			log.Printf("Hook %s for %s finished in %s: %s", hook, filePath, elapsed, outputText)
+		}
+	}()
+}
+
+// isUserCommentAdded reports whether the data of a comment_added event is about a submitted comment of the reviewer,
+// such as one made from the terminal, rather than an agent's reply
+func isUserCommentAdded(data interface{}) (bool, error) {
+	fields, _ := data.(map[string]interface{})
+	commentID, _ := fields["comment_id"].(int)
+	comment, err := getCommentByID(commentID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get comment %d: %w", commentID, err)
+	}
+	return comment != nil && comment.Author == "user" && !comment.Draft, nil
+}
@@ -7,6 +7,7 @@
     let commentButton = null;
     let commentPopup = null;
     let commentPanel = null;
+    let selectedRound = null;
 
     // Initialize when DOM is ready
     if (document.readyState === 'loading') {
@@ -20,10 +21,91 @@
         createCommentButton();
         createCommentPopup();
         createCommentPanel();
+        initReviewerIdentity();
+        initRoundSelector();
+        initVerdictBar();
+        renderAutopilotStatus();
         loadExistingComments();
+        renderOutline();
         setupSSE();
     }
 
+    /**
+     * Render the heading outline with per-section unresolved thread counts
+     */
+    function renderOutline() {
+        const panel = document.getElementById('outline-panel');
+        if (!panel) return;
+
+        panel.innerHTML = '';
+        if (!outline || outline.length === 0) {
+            panel.style.display = 'none';
+            return;
+        }
+        panel.style.display = '';
+
+        const title = document.createElement('div');
+        title.className = 'outline-title';
+        title.textContent = 'Contents';
+        panel.appendChild(title);
+        panel.appendChild(createOutlineList(outline));
+    }
+
+    function createOutlineList(items) {
+        const list = document.createElement('ul');
+        list.className = 'outline-list';
+
+        items.forEach((item) => {
+            const li = document.createElement('li');
+
+            const link = document.createElement('a');
+            link.className = 'outline-link';
+            link.href = `#${item.id}`;
+            link.title = `Lines ${item.line_start}-${item.line_end}`;
+
+            const label = document.createElement('span');
+            label.textContent = item.title;
+            link.appendChild(label);
+
+            if (item.unresolved_threads > 0) {
+                const count = document.createElement('span');
+                count.className = 'outline-thread-count';
+                count.textContent = item.unresolved_threads;
+                count.title = `${item.unresolved_threads} unresolved thread(s)`;
+                link.appendChild(count);
+            }
+
+            li.appendChild(link);
+            if (item.children && item.children.length > 0) {
+                li.appendChild(createOutlineList(item.children));
+            }
+            list.appendChild(li);
+        });
+
+        return list;
+    }
+
+    /**
+     * Reload the outline from the server after comments change
+     */
+    async function refreshOutline() {
+        const params = new URLSearchParams({
+            project_directory: projectDir,
+            file_path: filePath,
+        });
+
+        try {
+            const response = await fetch(`/api/outline?${params}`);
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+            outline = await response.json();
+            renderOutline();
+        } catch (error) {
+            console.error('Failed to refresh outline:', error);
+        }
+    }
+
     function initTextSelection() {
         const container = document.getElementById('markdown-content');
         if (!container) {
@@ -151,6 +233,16 @@
         const savedState = localStorage.getItem('claude-review-panel-state') || 'expanded';
         commentPanel.className = savedState + ' ready';
 
+        commentPanel.querySelector('.submit-review-btn').addEventListener('click', (e) => {
+            e.stopPropagation();
+            handleSubmitReview();
+        });
+
+        commentPanel.querySelector('.document-comment-btn').addEventListener('click', (e) => {
+            e.stopPropagation();
+            showDocumentCommentPopup();
+        });
+
         // Click on resize button to cycle through widths
         commentPanel.querySelector('.panel-resize-btn').addEventListener('click', (e) => {
             e.stopPropagation();
@@ -170,17 +262,241 @@
         localStorage.setItem('claude-review-panel-state', state);
     }
 
+    /**
+     * Reviewer name sent with new comments, so that several people can review the same document
+     */
+    function getReviewerName() {
+        return (localStorage.getItem('claude-review-reviewer-name') || '').trim();
+    }
+
+    function initReviewerIdentity() {
+        const input = document.getElementById('reviewer-name');
+        if (!input) return;
+
+        input.value = getReviewerName();
+        input.addEventListener('change', () => {
+            localStorage.setItem('claude-review-reviewer-name', input.value.trim());
+            updateCommentPanel();
+        });
+    }
+
+    /**
+     * Populate the review round selector. Selecting a round narrows the panel to the threads opened or answered in it.
+     */
+    function initRoundSelector() {
+        if (typeof rounds === 'undefined' || !rounds || rounds.length === 0) return;
+
+        const container = commentPanel.querySelector('.round-selector');
+        const select = document.getElementById('round-select');
+
+        rounds.forEach((round) => {
+            const option = document.createElement('option');
+            option.value = round.round;
+            const submitted = new Date(round.submitted_at).toLocaleString();
+            option.textContent = `Round ${round.round} (${submitted})`;
+            select.appendChild(option);
+        });
+
+        select.addEventListener('change', () => {
+            selectedRound = rounds.find((round) => String(round.round) === select.value) || null;
+            updateRoundSummary();
+            updateCommentPanel();
+        });
+
+        container.style.display = '';
+    }
+
+    function updateRoundSummary() {
+        const summary = commentPanel.querySelector('.round-summary');
+        const snapshot = commentPanel.querySelector('.round-snapshot');
+
+        if (!selectedRound) {
+            summary.textContent = '';
+            snapshot.style.display = 'none';
+            return;
+        }
+
+        summary.textContent =
+            `${selectedRound.opened.length} opened · ${selectedRound.answered.length} answered · ` +
+            `${selectedRound.resolved.length} resolved`;
+
+        const params = new URLSearchParams({
+            project_directory: projectDir,
+            file_path: filePath,
+        });
+        snapshot.href = `/api/rounds/${selectedRound.round}/snapshot?${params}`;
+        snapshot.style.display = '';
+    }
+
+    /**
+     * Whether a thread belongs to the selected review round (all threads do when no round is selected)
+     */
+    function isThreadInSelectedRound(threadId) {
+        if (!selectedRound) return true;
+        return selectedRound.opened.includes(threadId) || selectedRound.answered.includes(threadId);
+    }
+
+    const statusLabels = {
+        in_progress: 'In progress',
+        changes_requested: 'Changes requested',
+        approved: 'Approved',
+    };
+
+    /**
+     * Show the document's review status (its latest verdict) with buttons to approve or request changes
+     */
+    function initVerdictBar() {
+        commentPanel.querySelectorAll('.verdict-btn').forEach((button) => {
+            button.addEventListener('click', (e) => {
+                e.stopPropagation();
+                handleVerdict(button.dataset.status);
+            });
+        });
+        renderVerdictBar();
+    }
+
+    function renderVerdictBar() {
+        const statusElement = commentPanel.querySelector('.verdict-status');
+        const history = typeof verdicts !== 'undefined' && verdicts ? verdicts : [];
+        const current = history.length > 0 ? history[history.length - 1] : null;
+        const status = current ? current.status : 'in_progress';
+
+        const by = current && current.author_name ? ` by ${current.author_name}` : '';
+        statusElement.textContent = statusLabels[status] + by;
+        statusElement.className = `verdict-status verdict-${status}`;
+
+        // The full history is available on hover
+        statusElement.title = history.length
+            ? history
+                  .map((v) => {
+                      const who = v.author_name ? ` by ${v.author_name}` : '';
+                      const note = v.note ? `: ${v.note}` : '';
+                      return `${new Date(v.created_at).toLocaleString()} - ${statusLabels[v.status]}${who}${note}`;
+                  })
+                  .join('\n')
+            : 'No verdict yet';
+
+        commentPanel.querySelectorAll('.verdict-btn').forEach((button) => {
+            button.disabled = button.dataset.status === status;
+        });
+    }
+
+    async function handleVerdict(status) {
+        let note = '';
+        if (status === 'changes_requested') {
+            note = prompt('What needs to change? (optional)');
+            if (note === null) return;
+        }
+
+        try {
+            const response = await fetch('/api/verdicts', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify({
+                    project_directory: projectDir,
+                    file_path: filePath,
+                    status: status,
+                    author_name: getReviewerName(),
+                    note: note.trim(),
+                }),
+            });
+
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+
+            verdicts = (verdicts || []).concat([await response.json()]);
+            renderVerdictBar();
+        } catch (error) {
+            console.error('Failed to record verdict:', error);
+            alert('Failed to record verdict. Please try again.');
+        }
+    }
+
+    async function refreshVerdicts() {
+        try {
+            const params = new URLSearchParams({
+                project_directory: projectDir,
+                file_path: filePath,
+            });
+            const response = await fetch(`/api/verdicts?${params}`);
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+            verdicts = await response.json();
+            renderVerdictBar();
+        } catch (error) {
+            console.error('Failed to refresh verdicts:', error);
+        }
+    }
+
+    /**
+     * Show when the project's autopilot is addressing the feedback on this file, or failed to
+     */
+    function renderAutopilotStatus() {
+        const statusElement = commentPanel.querySelector('.autopilot-status');
+        const job = typeof autopilotJob !== 'undefined' ? autopilotJob : null;
+
+        if (job && job.status === 'running') {
+            statusElement.textContent = 'Agent is addressing feedback\u2026';
+            statusElement.className = 'autopilot-status autopilot-running';
+            statusElement.title = job.command;
+        } else if (job && job.status === 'failed') {
+            statusElement.textContent = 'Agent failed to address feedback';
+            statusElement.className = 'autopilot-status autopilot-failed';
+            statusElement.title = `Run claude-review autopilot --job ${job.id} to see its output`;
+        } else {
+            statusElement.textContent = '';
+            statusElement.className = 'autopilot-status';
+            statusElement.title = '';
+        }
+        statusElement.style.display = statusElement.textContent ? '' : 'none';
+    }
+
+    function authorDisplayName(comment) {
+        // Agent messages carry the session ID that wrote them
+        if (comment.author === 'agent' && comment.agent_id) {
+            return `${capitalizeFirst(comment.author)} (${comment.agent_id})`;
+        }
+        if (!comment.author_name) {
+            return capitalizeFirst(comment.author);
+        }
+        return comment.author_name;
+    }
+
+    /**
+     * Whether the current reviewer wrote a comment. Unnamed comments belong to whoever is reviewing.
+     */
+    function isOwnComment(comment) {
+        if (comment.author !== 'user') return false;
+        return !comment.author_name || comment.author_name === getReviewerName();
+    }
+
     function updateCommentPanel() {
         if (!commentPanel) return;
 
         const listContainer = commentPanel.querySelector('.comment-panel-list');
         const countElement = commentPanel.querySelector('.comment-count');
 
-        // Group comments by thread
-        const threads = groupCommentsByThread();
+        // Group comments by thread, narrowed to the selected review round
+        const threads = groupCommentsByThread().filter((thread) => isThreadInSelectedRound(thread.root.id));
+
+        // Dim the highlights of threads outside the selected round
+        document.querySelectorAll('.comment-highlight').forEach((highlight) => {
+            const inRound = isThreadInSelectedRound(parseInt(highlight.dataset.commentId, 10));
+            highlight.classList.toggle('round-dimmed', !inRound);
+        });
 
         countElement.textContent = threads.length;
 
+        // Drafts are invisible to the agent until the review is submitted
+        const draftCount = (comments || []).filter((c) => c.draft).length;
+        const submitBtn = commentPanel.querySelector('.submit-review-btn');
+        submitBtn.style.display = draftCount > 0 ? '' : 'none';
+        submitBtn.textContent = `Submit review (${draftCount})`;
+
         // Clear existing list
         listContainer.innerHTML = '';
 
@@ -189,8 +505,9 @@
             const rootComment = thread.root;
             const replies = thread.replies;
 
-            // Check if thread is awaiting user response (last reply is from agent)
-            const isAwaitingResponse = replies.length > 0 && replies[replies.length - 1].author === 'agent';
+            // Check if thread is awaiting user response (last message is from agent, e.g. an agent's question)
+            const lastMessage = replies.length > 0 ? replies[replies.length - 1] : rootComment;
+            const isAwaitingResponse = lastMessage.author === 'agent';
 
             const threadItem = document.createElement('div');
             threadItem.className = 'thread-container';
@@ -201,6 +518,11 @@
 
             threadItem.appendChild(rootItem);
 
+            const progressItem = createThreadProgressItem(rootComment.id);
+            if (progressItem) {
+                threadItem.appendChild(progressItem);
+            }
+
             // Add replies container (initially hidden if collapsed)
             if (replies.length > 0) {
                 const repliesContainer = document.createElement('div');
@@ -221,9 +543,59 @@
         commentPanel.classList.add('ready');
     }
 
+    const progressLabels = {
+        working: 'Agent is working on this',
+        done: 'Agent is done with this',
+        blocked: 'Agent is blocked',
+    };
+
+    /**
+     * Show what the agent reported about a thread, or that it skipped the thread
+     */
+    function createThreadProgressItem(threadId) {
+        const entry = (progress || []).find((p) => p.thread_id === threadId);
+        if (!entry) return null;
+
+        const item = document.createElement('div');
+        if (entry.status) {
+            item.className = `thread-progress thread-progress-${entry.status.state}`;
+            item.textContent = progressLabels[entry.status.state];
+            if (entry.status.note) {
+                item.textContent += `: ${entry.status.note}`;
+            }
+            const who = entry.status.agent_id ? ` by ${entry.status.agent_id}` : '';
+            item.title = `Reported ${formatRelativeTime(entry.status.updated_at)}${who}`;
+        } else {
+            item.className = 'thread-progress thread-progress-skipped';
+            item.textContent = 'Skipped by the agent';
+            item.title = 'The agent worked on other threads since your last message, but not on this one';
+        }
+        return item;
+    }
+
+    async function refreshProgress() {
+        try {
+            const params = new URLSearchParams({
+                project_directory: projectDir,
+                file_path: filePath,
+            });
+            const response = await fetch(`/api/progress?${params}`);
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+            progress = await response.json();
+            updateCommentPanel();
+        } catch (error) {
+            console.error('Failed to refresh thread progress:', error);
+        }
+    }
+
     function createCommentPanelItem(comment, isRoot, replyCount, isAwaitingResponse) {
         const item = document.createElement('div');
         item.className = isRoot ? 'thread-item comment-root' : 'thread-item comment-reply';
+        if (isRoot && comment.author === 'agent') {
+            item.classList.add('agent-question');
+        }
 
         const contentDiv = document.createElement('div');
         contentDiv.className = 'thread-item-content';
@@ -240,7 +612,7 @@
         authorInfoDiv.className = 'comment-author-info';
 
         const authorSpan = document.createElement('span');
-        authorSpan.textContent = capitalizeFirst(comment.author);
+        authorSpan.textContent = authorDisplayName(comment);
         authorInfoDiv.appendChild(authorSpan);
 
         if (comment.created_at) {
@@ -250,6 +622,27 @@
             authorInfoDiv.appendChild(timeSpan);
         }
 
+        // Edited comments can show their previous versions
+        if (comment.edited_at) {
+            const editedBtn = document.createElement('button');
+            editedBtn.className = 'comment-edited-btn';
+            editedBtn.textContent = '(edited)';
+            editedBtn.title = `Edited ${formatRelativeTime(comment.edited_at)} - click to show history`;
+            editedBtn.addEventListener('click', (e) => {
+                e.stopPropagation();
+                toggleCommentHistory(comment, item);
+            });
+            authorInfoDiv.appendChild(editedBtn);
+        }
+
+        if (comment.draft) {
+            const draftBadge = document.createElement('span');
+            draftBadge.className = 'comment-draft-badge';
+            draftBadge.textContent = 'Draft';
+            draftBadge.title = 'Not visible to the agent until you submit the review';
+            authorInfoDiv.appendChild(draftBadge);
+        }
+
         authorDiv.appendChild(authorInfoDiv);
 
         // Add badges to author row for root comments
@@ -285,6 +678,33 @@
             });
             badgesDiv.appendChild(resolveBtn);
 
+            // Comments on the whole document have no highlight to edit them through
+            if (!comment.line_start && isOwnComment(comment)) {
+                const editBtn = document.createElement('button');
+                editBtn.className = 'comment-badge-btn comment-badge-edit';
+                editBtn.textContent = 'Edit';
+                editBtn.addEventListener('click', (e) => {
+                    e.stopPropagation();
+                    showEditCommentPopup(comment, null, e.pageX, e.pageY);
+                });
+                badgesDiv.appendChild(editBtn);
+            }
+
+            authorDiv.appendChild(badgesDiv);
+        } else if (isOwnComment(comment)) {
+            // Reviewers can edit their own replies; the root comment is edited through its highlight
+            const badgesDiv = document.createElement('div');
+            badgesDiv.className = 'comment-badges';
+
+            const editBtn = document.createElement('button');
+            editBtn.className = 'comment-badge-btn comment-badge-edit';
+            editBtn.textContent = 'Edit';
+            editBtn.addEventListener('click', (e) => {
+                e.stopPropagation();
+                showEditCommentPopup(comment, null, e.pageX, e.pageY);
+            });
+            badgesDiv.appendChild(editBtn);
+
             authorDiv.appendChild(badgesDiv);
         }
 
@@ -296,6 +716,11 @@
             textDiv.className = 'thread-item-text';
             textDiv.textContent = `"${comment.selected_text}"`;
             contentDiv.appendChild(textDiv);
+        } else if (isRoot && !comment.line_start) {
+            const textDiv = document.createElement('div');
+            textDiv.className = 'thread-item-text document-level';
+            textDiv.textContent = 'Whole document';
+            contentDiv.appendChild(textDiv);
         }
 
         const commentDiv = document.createElement('div');
@@ -322,7 +747,7 @@
                     highlight.scrollIntoView({ behavior: 'smooth', block: 'center' });
                     highlight.style.backgroundColor = '#ffeb99';
                     setTimeout(() => {
-                        highlight.style.backgroundColor = '#fff8c5';
+                        highlight.style.backgroundColor = '';
                     }, 1000);
                 }
             });
@@ -331,6 +756,52 @@
         return item;
     }
 
+    /**
+     * Show or hide the previous versions of a comment below it in the panel
+     */
+    async function toggleCommentHistory(comment, item) {
+        const existing = item.querySelector('.comment-history');
+        if (existing) {
+            existing.remove();
+            return;
+        }
+
+        try {
+            const response = await fetch(`/api/comments/${comment.id}/revisions`);
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+            const revisions = await response.json();
+
+            const historyDiv = document.createElement('div');
+            historyDiv.className = 'comment-history';
+
+            revisions
+                .filter((revision) => revision.action === 'edit')
+                .reverse()
+                .forEach((revision) => {
+                    const entry = document.createElement('div');
+                    entry.className = 'comment-history-entry';
+
+                    const time = document.createElement('div');
+                    time.className = 'comment-timestamp';
+                    time.textContent = `Replaced ${formatRelativeTime(revision.created_at)}`;
+                    entry.appendChild(time);
+
+                    const text = document.createElement('div');
+                    text.className = 'comment-history-text';
+                    text.textContent = revision.comment_text;
+                    entry.appendChild(text);
+
+                    historyDiv.appendChild(entry);
+                });
+
+            item.querySelector('.thread-item-content').appendChild(historyDiv);
+        } catch (error) {
+            console.error('Failed to load comment history:', error);
+        }
+    }
+
     function groupCommentsByThread() {
         if (typeof comments === 'undefined' || comments === null || comments.length === 0) {
             return [];
@@ -358,7 +829,8 @@
             }
         });
 
-        // Convert to array and sort by root comment line number
+        // Convert to array and sort by root comment line number (comments on the whole document have none and
+        // come first)
         return Array.from(threadMap.values()).sort((a, b) => {
             const lineA = a.root.line_start || 0;
             const lineB = b.root.line_start || 0;
@@ -530,6 +1002,79 @@
         textarea.focus({ preventScroll: true });
     }
 
+    function showDocumentCommentPopup() {
+        const saveBtn = document.getElementById('comment-save');
+        const deleteBtn = document.getElementById('comment-delete');
+        const cancelBtn = document.getElementById('comment-cancel');
+
+        saveBtn.textContent = 'Add';
+        deleteBtn.style.display = 'none';
+
+        // Remove old listeners
+        saveBtn.replaceWith(saveBtn.cloneNode(true));
+        cancelBtn.replaceWith(cancelBtn.cloneNode(true));
+
+        // Add new listeners
+        document.getElementById('comment-save').addEventListener('click', handleAddDocumentComment);
+        document.getElementById('comment-cancel').addEventListener('click', hideCommentPopup);
+
+        commentPopup.style.display = 'block';
+        // Position near the center of the screen
+        commentPopup.style.left = '50%';
+        commentPopup.style.top = '30%';
+        commentPopup.style.transform = 'translateX(-50%)';
+
+        const textarea = document.getElementById('comment-text');
+        textarea.value = '';
+        textarea.focus({ preventScroll: true });
+    }
+
+    /**
+     * Handle adding a comment on the whole document, which isn't anchored to a selection
+     */
+    async function handleAddDocumentComment() {
+        const commentText = document.getElementById('comment-text').value.trim();
+        if (!commentText) {
+            alert('Please enter a comment');
+            return;
+        }
+
+        const payload = {
+            project_directory: projectDir,
+            file_path: filePath,
+            comment_text: commentText,
+            author_name: getReviewerName(),
+            draft: true,
+        };
+
+        try {
+            const response = await fetch('/api/comments', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify(payload),
+            });
+
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+
+            const savedComment = await response.json();
+
+            if (typeof comments === 'undefined' || comments === null) {
+                comments = [];
+            }
+            comments.push(savedComment);
+
+            updateCommentPanel();
+            hideCommentPopup();
+        } catch (error) {
+            console.error('Failed to save comment:', error);
+            alert('Failed to save comment. Please try again.');
+        }
+    }
+
     async function handleAddReply(rootComment) {
         const replyText = document.getElementById('comment-text').value.trim();
         if (!replyText) {
@@ -543,6 +1088,8 @@
             comment_text: replyText,
             root_id: rootComment.id,
             author: 'user',
+            author_name: getReviewerName(),
+            draft: true,
         };
 
         try {
@@ -616,8 +1163,9 @@
                 parent.removeChild(highlight);
             }
 
-            // Update comment panel
+            // Update comment panel and outline counts
             updateCommentPanel();
+            refreshOutline();
         } catch (error) {
             console.error('Failed to resolve thread:', error);
             alert('Failed to resolve thread. Please try again.');
@@ -676,6 +1224,8 @@
             line_end: currentSelection.lineEnd,
             selected_text: currentSelection.text,
             comment_text: commentText,
+            author_name: getReviewerName(),
+            draft: true,
         };
 
         try {
@@ -702,8 +1252,9 @@
             // Find and highlight the text in the document
             highlightCommentByText(savedComment);
 
-            // Update comment panel
+            // Update comment panel and outline counts
             updateCommentPanel();
+            refreshOutline();
 
             // Hide popup and clear selection
             hideCommentPopup(true);
@@ -744,13 +1295,15 @@
             if (typeof comments !== 'undefined' && comments !== null) {
                 const index = comments.findIndex((c) => c.id === comment.id);
                 if (index !== -1) {
-                    comments[index].comment_text = commentText;
+                    Object.assign(comments[index], updatedComment);
                 }
             }
 
-            // Update the highlight element
-            highlightElement.dataset.commentText = commentText;
-            highlightElement.title = commentText;
+            // Update the highlight element (replies have none)
+            if (highlightElement) {
+                highlightElement.dataset.commentText = commentText;
+                highlightElement.title = commentText;
+            }
 
             // Update comment panel
             updateCommentPanel();
@@ -767,7 +1320,10 @@
      * Handle deleting a comment
      */
     async function handleDeleteComment(comment, highlightElement) {
-        if (!confirm('Are you sure you want to delete this comment?')) {
+        const message = commentHasReplies(comment.id)
+            ? 'Are you sure you want to delete this comment and its replies?'
+            : 'Are you sure you want to delete this comment?';
+        if (!confirm(message)) {
             return;
         }
 
@@ -780,32 +1336,122 @@
                 throw new Error(`HTTP error! status: ${response.status}`);
             }
 
-            // Remove the highlight from the DOM
-            const parent = highlightElement.parentNode;
-            while (highlightElement.firstChild) {
-                parent.insertBefore(highlightElement.firstChild, highlightElement);
+            // Remove the highlight from the DOM (replies have none)
+            if (highlightElement) {
+                const parent = highlightElement.parentNode;
+                while (highlightElement.firstChild) {
+                    parent.insertBefore(highlightElement.firstChild, highlightElement);
+                }
+                parent.removeChild(highlightElement);
             }
-            parent.removeChild(highlightElement);
 
-            // Remove comment from comments array
+            // Remove comment and its replies from comments array
+            let deletedReplies = [];
             if (typeof comments !== 'undefined' && comments !== null) {
-                const index = comments.findIndex((c) => c.id === comment.id);
-                if (index !== -1) {
-                    comments.splice(index, 1);
-                }
+                deletedReplies = comments.filter((c) => c.root_id === comment.id);
+                comments = comments.filter((c) => c.id !== comment.id && c.root_id !== comment.id);
             }
 
-            // Update comment panel
+            // Update comment panel and outline counts
             updateCommentPanel();
+            refreshOutline();
 
             // Hide popup
             hideCommentPopup();
+
+            showUndoDelete(comment, deletedReplies);
         } catch (error) {
             console.error('Failed to delete comment:', error);
             alert('Failed to delete comment. Please try again.');
         }
     }
 
+    /**
+     * Publish all draft comments on this file as a new review round
+     */
+    async function handleSubmitReview() {
+        try {
+            const response = await fetch('/api/reviews', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify({
+                    project_directory: projectDir,
+                    file_path: filePath,
+                    author_name: getReviewerName(),
+                }),
+            });
+
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+
+            // Reload to show the comments with their review round
+            triggerReload();
+        } catch (error) {
+            console.error('Failed to submit review:', error);
+            alert('Failed to submit review. Please try again.');
+        }
+    }
+
+    /**
+     * Offer to restore a just-deleted comment for a few seconds
+     */
+    function showUndoDelete(comment, deletedReplies) {
+        document.querySelectorAll('.undo-toast').forEach((toast) => toast.remove());
+
+        const toast = document.createElement('div');
+        toast.className = 'undo-toast';
+
+        const message = document.createElement('span');
+        message.textContent = 'Comment deleted';
+        toast.appendChild(message);
+
+        const undoBtn = document.createElement('button');
+        undoBtn.className = 'comment-btn';
+        undoBtn.textContent = 'Undo';
+        undoBtn.addEventListener('click', async () => {
+            toast.remove();
+            await handleRestoreComment(comment, deletedReplies);
+        });
+        toast.appendChild(undoBtn);
+
+        document.body.appendChild(toast);
+        setTimeout(() => toast.remove(), 10000);
+    }
+
+    /**
+     * Restore a deleted comment (with the replies deleted along with it) and highlight it again
+     */
+    async function handleRestoreComment(comment, deletedReplies) {
+        try {
+            const response = await fetch(`/api/comments/${comment.id}/restore`, {
+                method: 'POST',
+            });
+
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+
+            const restoredComment = await response.json();
+
+            if (typeof comments === 'undefined' || comments === null) {
+                comments = [];
+            }
+            comments.push(restoredComment, ...deletedReplies);
+
+            if (!restoredComment.root_id && restoredComment.line_start) {
+                highlightExistingComment(restoredComment);
+            }
+            updateCommentPanel();
+            refreshOutline();
+        } catch (error) {
+            console.error('Failed to restore comment:', error);
+            alert('Failed to restore comment. Please try again.');
+        }
+    }
+
     /**
      * Check if a comment has replies
      */
@@ -830,17 +1476,26 @@
         highlight.dataset.lineEnd = comment.line_end;
         highlight.title = comment.comment_text;
 
+        if (comment.draft) {
+            highlight.classList.add('comment-draft');
+        }
+
+        // Questions the agent asked stand out from the reviewer's own comments
+        if (comment.author === 'agent') {
+            highlight.classList.add('agent-question');
+            highlight.title = `Question from ${authorDisplayName(comment)}: ${comment.comment_text}`;
+        }
+
         // Check if this comment has replies and add class accordingly
         const hasReply = commentHasReplies(comment.id);
         if (hasReply) {
             highlight.classList.add('has-replies');
         }
 
-        // Click handler to edit comment (only if it has no replies)
+        // Click handler to edit the root comment
         highlight.addEventListener('click', (e) => {
             e.stopPropagation();
-            // Only allow editing root comments without replies
-            if (!comment.root_id && !hasReply) {
+            if (!comment.root_id && isOwnComment(comment)) {
                 showEditCommentPopup(comment, highlight, e.pageX, e.pageY);
             }
         });
@@ -1015,6 +1670,48 @@
             triggerReload();
         });
 
+        eventSource.addEventListener('review_submitted', (event) => {
+            console.log('Review submitted event received:', event.data);
+            triggerReload();
+        });
+
+        eventSource.addEventListener('verdict_changed', (event) => {
+            console.log('Verdict changed event received:', event.data);
+            refreshVerdicts();
+        });
+
+        eventSource.addEventListener('autopilot_started', (event) => {
+            console.log('Autopilot started event received:', event.data);
+            autopilotJob = JSON.parse(event.data);
+            renderAutopilotStatus();
+        });
+
+        eventSource.addEventListener('autopilot_finished', (event) => {
+            console.log('Autopilot finished event received:', event.data);
+            autopilotJob = JSON.parse(event.data);
+            renderAutopilotStatus();
+        });
+
+        eventSource.addEventListener('thread_status_changed', (event) => {
+            console.log('Thread status changed event received:', event.data);
+            refreshProgress();
+        });
+
+        eventSource.addEventListener('comment_added', (event) => {
+            console.log('Comment added event received:', event.data);
+            triggerReload();
+        });
+
+        eventSource.addEventListener('comment_edited', (event) => {
+            console.log('Comment edited event received:', event.data);
+            triggerReload();
+        });
+
+        eventSource.addEventListener('comment_deleted', (event) => {
+            console.log('Comment deleted event received:', event.data);
+            triggerReload();
+        });
+
         eventSource.addEventListener('reload', (event) => {
             console.log('Reload event received:', event.data);
             triggerReload();
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runGit runs a git command in dir and returns its trimmed output
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// stagedFiles returns the absolute paths of the files staged for commit in the repository containing dir.
+// Deleted files are left out.
+func stagedFiles(dir string) ([]string, error) {
+	root, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	// NUL-separated, so that git doesn't quote unusual file names
+	output, err := runGit(dir, "diff", "--cached", "--name-only", "-z", "--diff-filter=ACMR")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, name := range strings.Split(output, "\x00") {
+		if name != "" {
+			files = append(files, filepath.Join(root, filepath.FromSlash(name)))
+		}
+	}
+	return files, nil
+}
+
+// projectOf finds the registered project containing an absolute path and returns it with the path relative to it.
+// Nested projects take precedence over the projects containing them.
+func projectOf(projects []Project, path string) (string, string, bool) {
+	var project, relative string
+	for _, p := range projects {
+		// git reports paths with symlinks resolved, the project may have been registered through one
+		for _, dir := range []string{p.Directory, resolveSymlinks(p.Directory)} {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			if len(p.Directory) > len(project) {
+				project, relative = p.Directory, filepath.ToSlash(rel)
+			}
+		}
+	}
+	return project, relative, project != ""
+}
+
+// resolveSymlinks returns a path with symlinks resolved, or the path itself if that fails
+func resolveSymlinks(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+// gitHooksDir returns the hooks directory of the repository containing dir, honoring core.hooksPath
+func gitHooksDir(dir string) (string, error) {
+	hooksDir, err := runGit(dir, "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(hooksDir) {
+		hooksDir = filepath.Join(dir, hooksDir)
+	}
+	return hooksDir, nil
+}
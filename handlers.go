@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io/fs"
@@ -9,6 +10,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
@@ -108,8 +110,12 @@ func handleProjectFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Build absolute path
+	// Build absolute path, refusing anything that escapes the project
 	absPath := filepath.Join(project, childPath)
+	if absPath != project && !strings.HasPrefix(absPath, project+string(filepath.Separator)) {
+		http.NotFound(w, r)
+		return
+	}
 
 	// Check if path exists
 	info, err := os.Stat(absPath)
@@ -136,9 +142,22 @@ func handleProjectFiles(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Otherwise serve raw file
-	prefix := "/projects/" + url.PathEscape(project)
-	fs := http.FileServer(http.Dir(project))
-	http.StripPrefix(prefix, fs).ServeHTTP(w, r)
+	serveProjectAsset(w, r, absPath, info)
+}
+
+// serveProjectAsset serves a non-Markdown project file (images, attachments) with a content type
+// derived from its extension and an ETag derived from its size and modification time
+func serveProjectAsset(w http.ResponseWriter, r *http.Request, absPath string, info os.FileInfo) {
+	f, err := os.Open(absPath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
 }
 
 func renderViewer(w http.ResponseWriter, r *http.Request, projectDir, filePath string) {
@@ -151,15 +170,15 @@ func renderViewer(w http.ResponseWriter, r *http.Request, projectDir, filePath s
 		return
 	}
 
-	// Render markdown to HTML
-	html, err := RenderMarkdownWithLineNumbers(content)
+	// Render markdown to HTML, resolving relative links against the file's location
+	html, err := RenderMarkdownWithLineNumbers(content, WithDocumentPath(projectDir, filePath))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Get comments for this file
-	comments, err := getComments(projectDir, filePath, false)
+	comments, err := getComments(projectDir, filePath, false, true)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -171,11 +190,52 @@ func renderViewer(w http.ResponseWriter, r *http.Request, projectDir, filePath s
 		return
 	}
 
+	// Build the heading outline annotated with unresolved thread counts
+	outline := BuildOutline(content)
+	countOutlineThreads(outline, comments)
+
+	// Review rounds let the reviewer look at one pass at a time
+	rounds, err := getRoundSummaries(projectDir, filePath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	verdicts, err := getVerdicts(projectDir, filePath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// What the agent reported while working through the threads
+	progress, err := getThreadProgress(projectDir, filePath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Show when the autopilot is working on the file
+	jobs, err := getAutopilotJobs(projectDir, filePath, 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var autopilotJob *AutopilotJob
+	if len(jobs) > 0 {
+		autopilotJob = &jobs[0]
+		autopilotJob.Output = ""
+	}
+
 	data := map[string]interface{}{
-		"ProjectDir":  projectDir,
-		"FilePath":    filePath,
-		"HTMLContent": template.HTML(html),
-		"Comments":    comments,
+		"ProjectDir":   projectDir,
+		"FilePath":     filePath,
+		"HTMLContent":  template.HTML(html),
+		"Comments":     comments,
+		"Outline":      outline,
+		"Rounds":       rounds,
+		"Verdicts":     verdicts,
+		"AutopilotJob": autopilotJob,
+		"Progress":     progress,
 	}
 
 	if err := templates.ExecuteTemplate(w, "viewer.html", data); err != nil {
@@ -183,6 +243,32 @@ func renderViewer(w http.ResponseWriter, r *http.Request, projectDir, filePath s
 	}
 }
 
+// countOutlineThreads sets the number of unresolved threads whose root comment starts inside each section
+func countOutlineThreads(items []*OutlineItem, comments []Comment) {
+	for _, item := range items {
+		item.UnresolvedThreads = 0
+		for _, c := range comments {
+			if c.RootID != nil || c.LineStart == nil || c.ResolvedAt != nil {
+				continue
+			}
+			if *c.LineStart >= item.LineStart && *c.LineStart <= item.LineEnd {
+				item.UnresolvedThreads++
+			}
+		}
+		countOutlineThreads(item.Children, comments)
+	}
+}
+
+// projectFilePath joins a project directory and a file path, rejecting paths that escape the project
+func projectFilePath(projectDir, filePath string) (string, error) {
+	projectDir = filepath.Clean(projectDir)
+	absPath := filepath.Join(projectDir, filePath)
+	if !strings.HasPrefix(absPath, projectDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("file path %q is outside of project %q", filePath, projectDir)
+	}
+	return absPath, nil
+}
+
 var skipDirs = map[string]bool{
 	".git":          true,
 	"node_modules":  true,
@@ -229,6 +315,9 @@ func hasMarkdownFiles(dirPath string) bool {
 	return found
 }
 
+// frontMatterFilterPrefix marks the query parameters of a directory listing that filter by front matter
+const frontMatterFilterPrefix = "fm."
+
 func renderDirectoryListing(w http.ResponseWriter, r *http.Request, projectDir, childPath string) {
 	absPath := filepath.Join(projectDir, childPath)
 
@@ -239,11 +328,24 @@ func renderDirectoryListing(w http.ResponseWriter, r *http.Request, projectDir,
 		return
 	}
 
+	// Front matter fields requested as filters, e.g. ?fm.status=draft
+	filters := make(map[string]string)
+	for param, values := range r.URL.Query() {
+		if key, ok := strings.CutPrefix(param, frontMatterFilterPrefix); ok && key != "" && len(values) > 0 {
+			filters[key] = values[0]
+		}
+	}
+
 	// Filter for directories and markdown files
+	type MetaField struct {
+		Key   string
+		Value string
+	}
 	type Entry struct {
 		Name  string
 		IsDir bool
 		Path  string
+		Meta  []MetaField
 	}
 
 	var filteredEntries []Entry
@@ -263,19 +365,48 @@ func renderDirectoryListing(w http.ResponseWriter, r *http.Request, projectDir,
 				})
 			}
 		} else if strings.HasSuffix(strings.ToLower(entry.Name()), ".md") {
-			// Include only markdown files
+			// Include only markdown files, matching the front matter filters if any
+			fm := readFrontMatter(filepath.Join(absPath, entry.Name()))
+
+			matches := true
+			for key, value := range filters {
+				if !strings.EqualFold(fm.Get(key), value) {
+					matches = false
+					break
+				}
+			}
+			if !matches {
+				continue
+			}
+
+			var meta []MetaField
+			if fm != nil {
+				for _, key := range fm.keys {
+					meta = append(meta, MetaField{Key: key, Value: fm.Get(key)})
+				}
+			}
+
 			filteredEntries = append(filteredEntries, Entry{
 				Name:  entry.Name(),
 				IsDir: false,
 				Path:  filepath.Join(childPath, entry.Name()),
+				Meta:  meta,
 			})
 		}
 	}
 
+	// Describe active filters for the page
+	var activeFilters []string
+	for key, value := range filters {
+		activeFilters = append(activeFilters, key+": "+value)
+	}
+	sort.Strings(activeFilters)
+
 	data := map[string]interface{}{
 		"ProjectDir": projectDir,
 		"ChildPath":  childPath,
 		"Entries":    filteredEntries,
+		"Filters":    activeFilters,
 	}
 
 	if err := templates.ExecuteTemplate(w, "directory.html", data); err != nil {
@@ -285,48 +416,96 @@ func renderDirectoryListing(w http.ResponseWriter, r *http.Request, projectDir,
 
 // API Handlers
 
-func handleCreateComment(w http.ResponseWriter, r *http.Request) {
-	var comment Comment
+// handleGetVersion reports the version of the running server, so that the CLI can detect an outdated daemon
+func handleGetVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{"version": Version}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
 
-	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
+func handleGetOutline(w http.ResponseWriter, r *http.Request) {
+	projectDir := r.URL.Query().Get("project_directory")
+	filePath := r.URL.Query().Get("file_path")
+
+	if projectDir == "" || filePath == "" {
+		http.Error(w, "Missing project_directory or file_path", http.StatusBadRequest)
+		return
+	}
+
+	// Like the viewer, only serve files of registered projects
+	project, err := getProject(projectDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if project == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	absPath, err := projectFilePath(projectDir, filePath)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Validate required fields
-	if comment.ProjectDirectory == "" {
-		http.Error(w, "project_directory is required", http.StatusBadRequest)
+	content, err := os.ReadFile(absPath)
+	if err != nil {
+		http.NotFound(w, r)
 		return
 	}
-	if comment.FilePath == "" {
-		http.Error(w, "file_path is required", http.StatusBadRequest)
+
+	comments, err := getComments(projectDir, filePath, false, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// For root comments, line numbers and selected text are required
-	// For replies (root_id is set), they are optional
-	if comment.RootID == nil {
+	outline := BuildOutline(content)
+	countOutlineThreads(outline, comments)
+	if outline == nil {
+		outline = []*OutlineItem{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(outline); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// maxAuthorNameLength limits reviewer names, which are shown inline in the panel and in address output
+const maxAuthorNameLength = 64
+
+// validateComment checks a new comment before it's created, defaulting the author to the user and trimming the
+// author's name. Comments from the browser and from the command line go through the same checks.
+func validateComment(comment *Comment) error {
+	if comment.ProjectDirectory == "" {
+		return errors.New("project_directory is required")
+	}
+	if comment.FilePath == "" {
+		return errors.New("file_path is required")
+	}
+
+	// For root comments, line numbers and selected text are required, unless all of them are left out for a
+	// comment on the whole document. For replies (root_id is set), they are optional.
+	if comment.RootID == nil && !comment.IsDocumentLevel() {
 		if comment.LineStart == nil || *comment.LineStart <= 0 {
-			http.Error(w, "line_start must be positive", http.StatusBadRequest)
-			return
+			return errors.New("line_start must be positive")
 		}
 		if comment.LineEnd == nil || *comment.LineEnd <= 0 {
-			http.Error(w, "line_end must be positive", http.StatusBadRequest)
-			return
+			return errors.New("line_end must be positive")
 		}
 		if *comment.LineEnd < *comment.LineStart {
-			http.Error(w, "line_end must be >= line_start", http.StatusBadRequest)
-			return
+			return errors.New("line_end must be >= line_start")
 		}
 		if comment.SelectedText == "" {
-			http.Error(w, "selected_text is required for root comments", http.StatusBadRequest)
-			return
+			return errors.New("selected_text is required for root comments")
 		}
 	}
 
-	if comment.CommentText == "" {
-		http.Error(w, "comment_text is required", http.StatusBadRequest)
-		return
+	if strings.TrimSpace(comment.CommentText) == "" {
+		return errors.New("comment_text is required")
 	}
 
 	// Default author to 'user' if not provided (for API calls from web UI)
@@ -334,6 +513,44 @@ func handleCreateComment(w http.ResponseWriter, r *http.Request) {
 		comment.Author = "user"
 	}
 
+	comment.AuthorName = strings.TrimSpace(comment.AuthorName)
+	if len(comment.AuthorName) > maxAuthorNameLength {
+		return fmt.Errorf("author_name must be at most %d characters", maxAuthorNameLength)
+	}
+	if comment.AgentID != "" && comment.Author != "agent" {
+		return errors.New("agent_id is only allowed on agent comments")
+	}
+	if len(comment.AgentID) > maxAuthorNameLength {
+		return fmt.Errorf("agent_id must be at most %d characters", maxAuthorNameLength)
+	}
+	return nil
+}
+
+func handleCreateComment(w http.ResponseWriter, r *http.Request) {
+	var comment Comment
+
+	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateComment(&comment); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Replies to a draft stay drafts until the review is submitted
+	if comment.RootID != nil && !comment.Draft {
+		root, err := getCommentByID(*comment.RootID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if root != nil && root.Draft {
+			comment.Draft = true
+		}
+	}
+
 	if err := createComment(&comment); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -349,6 +566,12 @@ func handleCreateComment(w http.ResponseWriter, r *http.Request) {
 
 	// Don't broadcast reload for comment creation - the frontend handles it locally
 	// Only broadcast for external changes (CLI resolve, file updates)
+	if !comment.Draft {
+		dispatchEvent(comment.ProjectDirectory, comment.FilePath, "comment_added", map[string]interface{}{
+			"file_path":  comment.FilePath,
+			"comment_id": comment.ID,
+		})
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(comment); err != nil {
@@ -367,14 +590,18 @@ func handleUpdateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if comment has replies
-	hasReply, err := hasReplies(commentID)
+	// The web interface acts on behalf of the user, who can only edit their own messages
+	comment, err := getCommentByID(commentID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if hasReply {
-		http.Error(w, "Cannot edit comment with replies", http.StatusBadRequest)
+	if comment == nil {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+	if comment.Author != "user" {
+		http.Error(w, "Cannot edit another author's comment", http.StatusForbidden)
 		return
 	}
 
@@ -386,33 +613,354 @@ func handleUpdateComment(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	if err := updateComment(commentIDStr, req.CommentText); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	comment.CommentText = req.CommentText
+	if err := validateComment(comment); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]string{"status": "updated"}); err != nil {
+	if err := updateComment(commentID, req.CommentText); err != nil {
+		if errors.Is(err, errCommentNotFound) {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+
+	// Other viewers of the file, and the terminal UI, show the new text
+	publishEvent(comment.ProjectDirectory, comment.FilePath, "comment_edited", map[string]interface{}{
+		"file_path":  comment.FilePath,
+		"comment_id": commentID,
+	})
+
+	writeCommentJSON(w, commentID)
 }
 
 func handleDeleteComment(w http.ResponseWriter, r *http.Request) {
 	// Extract comment ID from URL path
-	commentID := chi.URLParam(r, "id")
+	commentIDStr := chi.URLParam(r, "id")
+
+	// Parse comment ID
+	var commentID int
+	if _, err := fmt.Sscanf(commentIDStr, "%d", &commentID); err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return
+	}
+
+	comment, err := getCommentByID(commentID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if comment == nil {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
 
 	if err := deleteComment(commentID); err != nil {
+		if errors.Is(err, errCommentNotFound) {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	publishEvent(comment.ProjectDirectory, comment.FilePath, "comment_deleted", map[string]interface{}{
+		"file_path":  comment.FilePath,
+		"comment_id": commentID,
+	})
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]string{"status": "deleted"}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
+// handleSubmitReview publishes the draft comments of a file as a new review round
+func handleSubmitReview(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ProjectDirectory string `json:"project_directory"`
+		FilePath         string `json:"file_path"`
+		AuthorName       string `json:"author_name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ProjectDirectory == "" || req.FilePath == "" {
+		http.Error(w, "project_directory and file_path are required", http.StatusBadRequest)
+		return
+	}
+
+	absPath, err := projectFilePath(req.ProjectDirectory, req.FilePath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Snapshot the document as the reviewer saw it; a missing file doesn't prevent submitting
+	var snapshot *string
+	if content, err := os.ReadFile(absPath); err == nil {
+		text := string(content)
+		snapshot = &text
+	}
+
+	round, count, err := submitReview(req.ProjectDirectory, req.FilePath, strings.TrimSpace(req.AuthorName), snapshot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if count == 0 {
+		http.Error(w, "No draft comments to submit", http.StatusBadRequest)
+		return
+	}
+
+	// Unlike individual comments, a submitted review is news for everyone watching the file
+	publishEvent(req.ProjectDirectory, req.FilePath, "review_submitted", map[string]interface{}{
+		"file_path":    req.FilePath,
+		"review_round": round.Round,
+		"count":        count,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]int{"review_round": round.Round, "count": count}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleGetRounds returns the review rounds of a file with the threads opened, answered and resolved in each
+func handleGetRounds(w http.ResponseWriter, r *http.Request) {
+	projectDir := r.URL.Query().Get("project_directory")
+	filePath := r.URL.Query().Get("file_path")
+	if projectDir == "" || filePath == "" {
+		http.Error(w, "project_directory and file_path are required", http.StatusBadRequest)
+		return
+	}
+
+	summaries, err := getRoundSummaries(projectDir, filePath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(summaries); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleGetRoundSnapshot returns the file as it was when a review round was submitted
+func handleGetRoundSnapshot(w http.ResponseWriter, r *http.Request) {
+	projectDir := r.URL.Query().Get("project_directory")
+	filePath := r.URL.Query().Get("file_path")
+	if projectDir == "" || filePath == "" {
+		http.Error(w, "project_directory and file_path are required", http.StatusBadRequest)
+		return
+	}
+
+	var round int
+	if _, err := fmt.Sscanf(chi.URLParam(r, "round"), "%d", &round); err != nil {
+		http.Error(w, "Invalid round", http.StatusBadRequest)
+		return
+	}
+
+	snapshot, err := getReviewRoundSnapshot(projectDir, filePath, round)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if snapshot == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(*snapshot))
+}
+
+// handleCreateVerdict records a reviewer's verdict on a document, which becomes its review status
+func handleCreateVerdict(w http.ResponseWriter, r *http.Request) {
+	var verdict Verdict
+
+	if err := json.NewDecoder(r.Body).Decode(&verdict); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if verdict.ProjectDirectory == "" || verdict.FilePath == "" {
+		http.Error(w, "project_directory and file_path are required", http.StatusBadRequest)
+		return
+	}
+	switch verdict.Status {
+	case statusInProgress, statusChangesRequested, statusApproved:
+	default:
+		http.Error(w, fmt.Sprintf("invalid status %q", verdict.Status), http.StatusBadRequest)
+		return
+	}
+
+	verdict.AuthorName = strings.TrimSpace(verdict.AuthorName)
+	if len(verdict.AuthorName) > maxAuthorNameLength {
+		http.Error(w, fmt.Sprintf("author_name must be at most %d characters", maxAuthorNameLength),
+			http.StatusBadRequest)
+		return
+	}
+
+	if _, err := createProject(verdict.ProjectDirectory); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := createVerdict(&verdict); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	publishEvent(verdict.ProjectDirectory, verdict.FilePath, "verdict_changed", verdict)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(verdict); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleGetVerdicts returns the verdict history of a document, oldest first
+func handleGetVerdicts(w http.ResponseWriter, r *http.Request) {
+	projectDir := r.URL.Query().Get("project_directory")
+	filePath := r.URL.Query().Get("file_path")
+	if projectDir == "" || filePath == "" {
+		http.Error(w, "project_directory and file_path are required", http.StatusBadRequest)
+		return
+	}
+
+	verdicts, err := getVerdicts(projectDir, filePath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(verdicts); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleGetThreadProgress returns the agent's progress on the open threads of a document
+func handleGetThreadProgress(w http.ResponseWriter, r *http.Request) {
+	projectDir := r.URL.Query().Get("project_directory")
+	filePath := r.URL.Query().Get("file_path")
+	if projectDir == "" || filePath == "" {
+		http.Error(w, "project_directory and file_path are required", http.StatusBadRequest)
+		return
+	}
+
+	progress, err := getThreadProgress(projectDir, filePath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(progress); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleGetAutopilotJobs returns the latest autopilot jobs of a document, newest first
+func handleGetAutopilotJobs(w http.ResponseWriter, r *http.Request) {
+	projectDir := r.URL.Query().Get("project_directory")
+	filePath := r.URL.Query().Get("file_path")
+	if projectDir == "" || filePath == "" {
+		http.Error(w, "project_directory and file_path are required", http.StatusBadRequest)
+		return
+	}
+
+	jobs, err := getAutopilotJobs(projectDir, filePath, 20)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(jobs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleRestoreComment undoes a deletion
+func handleRestoreComment(w http.ResponseWriter, r *http.Request) {
+	// Extract comment ID from URL path
+	commentIDStr := chi.URLParam(r, "id")
+
+	// Parse comment ID
+	var commentID int
+	if _, err := fmt.Sscanf(commentIDStr, "%d", &commentID); err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return
+	}
+
+	comment, err := restoreComment(commentID)
+	if errors.Is(err, errCommentNotFound) {
+		http.Error(w, "Comment not found or not deleted", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeCommentJSON(w, comment.ID)
+}
+
+// handleGetCommentRevisions returns the edit history of a comment
+func handleGetCommentRevisions(w http.ResponseWriter, r *http.Request) {
+	// Extract comment ID from URL path
+	commentIDStr := chi.URLParam(r, "id")
+
+	// Parse comment ID
+	var commentID int
+	if _, err := fmt.Sscanf(commentIDStr, "%d", &commentID); err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return
+	}
+
+	revisions, err := getCommentRevisions(commentID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(revisions); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// writeCommentJSON responds with the current state of a comment, including its rendered markdown
+func writeCommentJSON(w http.ResponseWriter, commentID int) {
+	comment, err := getCommentByID(commentID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if comment == nil {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+
+	rendered, err := RenderMarkdown([]byte(comment.CommentText))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to render markdown: %v", err), http.StatusInternalServerError)
+		return
+	}
+	comment.RenderedHTML = strings.TrimSpace(string(rendered))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(comment); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func handleResolveThread(w http.ResponseWriter, r *http.Request) {
 	// Extract comment ID from URL path
 	commentIDStr := chi.URLParam(r, "id")
@@ -436,7 +984,7 @@ func handleResolveThread(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Resolve the thread (marked as resolved by 'user' since it's from web UI)
-	count, err := resolveThread(commentID, "user")
+	count, err := resolveThread(commentID, "user", "")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -444,6 +992,12 @@ func handleResolveThread(w http.ResponseWriter, r *http.Request) {
 
 	// Don't broadcast reload for web UI resolution - the frontend handles it locally
 	// Only broadcast for CLI resolution (via notify endpoint)
+	if count > 0 {
+		dispatchEvent(comment.ProjectDirectory, comment.FilePath, "comments_resolved", map[string]interface{}{
+			"file_path":  comment.FilePath,
+			"comment_id": commentID,
+		})
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]interface{}{
@@ -1,29 +1,39 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 )
 
-func installSlashCommands() error {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
-	}
+// commandMarkerPrefix starts the comment appended to installed slash commands. It records the version that installed
+// a command and a hash of its content, so that upgrades can tell stale copies from ones the user modified.
+const commandMarkerPrefix = "<!-- claude-review "
 
-	commandsDir := filepath.Join(homeDir, ".claude", "commands")
+// slashCommand is a slash command embedded in the binary
+type slashCommand struct {
+	Filename string
+	Content  []byte
+}
 
-	// Create commands directory if it doesn't exist
-	if err := os.MkdirAll(commandsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create commands directory: %w", err)
-	}
+// installedCommand is a slash command file found in a commands directory
+type installedCommand struct {
+	Path     string
+	Body     []byte // Content without the marker
+	Version  string // Version that installed it, empty if it has no marker (installed before markers existed)
+	Modified bool   // Changed since it was installed
+}
 
-	// Install all slash commands from embedded FS
-	var installed []string
-	err = fs.WalkDir(slashCommandsFS, "slash-commands", func(path string, d fs.DirEntry, err error) error {
+// embeddedSlashCommands returns the slash commands embedded in the binary
+func embeddedSlashCommands() ([]slashCommand, error) {
+	var commands []slashCommand
+	err := fs.WalkDir(slashCommandsFS, "slash-commands", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -33,31 +43,338 @@ func installSlashCommands() error {
 		}
 
 		// Read embedded slash command
-		commandContent, err := slashCommandsFS.ReadFile(path)
+		content, err := slashCommandsFS.ReadFile(path)
 		if err != nil {
 			return fmt.Errorf("failed to read %s: %w", path, err)
 		}
 
-		// Write to ~/.claude/commands/
-		filename := filepath.Base(path)
-		commandPath := filepath.Join(commandsDir, filename)
-		if err := os.WriteFile(commandPath, commandContent, 0644); err != nil {
-			return fmt.Errorf("failed to write %s: %w", filename, err)
-		}
-
-		installed = append(installed, filename)
+		commands = append(commands, slashCommand{Filename: filepath.Base(path), Content: content})
 		return nil
 	})
+	return commands, err
+}
 
+// withCommandMarker appends the version marker to the content of a slash command
+func withCommandMarker(content []byte) []byte {
+	marker := fmt.Sprintf("\n%sversion=%s sha256=%x -->\n", commandMarkerPrefix, Version, sha256.Sum256(content))
+	return append(append([]byte{}, content...), marker...)
+}
+
+// readInstalledCommand reads a slash command file and its marker. Returns nil if the file doesn't exist.
+func readInstalledCommand(path string) (*installedCommand, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	command := &installedCommand{Path: path, Body: data}
+	index := bytes.LastIndex(data, []byte(commandMarkerPrefix))
+	if index < 0 {
+		return command, nil
+	}
+
+	command.Body = bytes.TrimSuffix(data[:index], []byte("\n"))
+	var hash string
+	for _, field := range strings.Fields(string(data[index+len(commandMarkerPrefix):])) {
+		if value, ok := strings.CutPrefix(field, "version="); ok {
+			command.Version = value
+		} else if value, ok := strings.CutPrefix(field, "sha256="); ok {
+			hash = value
+		}
+	}
+	command.Modified = fmt.Sprintf("%x", sha256.Sum256(command.Body)) != hash
+	return command, nil
+}
+
+// slashCommandsDir returns the slash commands directory of the current project, or the user's
+func slashCommandsDir(project bool) (string, error) {
+	settingsPath, err := claudeSettingsPath(project)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(settingsPath), "commands"), nil
+}
+
+// installSlashCommands writes the embedded slash commands to commandsDir. Copies the user modified since they were
+// installed are left alone unless force is set.
+func installSlashCommands(commandsDir string, force bool) error {
+	commands, err := embeddedSlashCommands()
 	if err != nil {
 		return err
 	}
 
+	// Create commands directory if it doesn't exist
+	if err := os.MkdirAll(commandsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create commands directory: %w", err)
+	}
+
+	var installed, skipped []string
+	for _, command := range commands {
+		commandPath := filepath.Join(commandsDir, command.Filename)
+
+		existing, err := readInstalledCommand(commandPath)
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.Modified && !force && !bytes.Equal(existing.Body, command.Content) {
+			skipped = append(skipped, commandPath)
+			continue
+		}
+
+		if err := os.WriteFile(commandPath, withCommandMarker(command.Content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", command.Filename, err)
+		}
+		installed = append(installed, command.Filename)
+	}
+
 	fmt.Printf("Successfully installed %d slash command(s) to %s:\n", len(installed), commandsDir)
 	for _, name := range installed {
 		cmdName := strings.TrimSuffix(name, ".md")
 		fmt.Printf("  /%s\n", cmdName)
 	}
 
+	if len(skipped) > 0 {
+		fmt.Printf("\nWarning: kept %d slash command(s) you modified (run with --force to overwrite them):\n",
+			len(skipped))
+		for _, path := range skipped {
+			fmt.Printf("  %s\n", path)
+		}
+	}
+
+	return nil
+}
+
+// uninstallSlashCommands removes the claude-review slash commands from commandsDir, except for copies the user
+// modified unless force is set
+func uninstallSlashCommands(commandsDir string, force bool) error {
+	commands, err := embeddedSlashCommands()
+	if err != nil {
+		return err
+	}
+
+	var removed, kept []string
+	for _, command := range commands {
+		commandPath := filepath.Join(commandsDir, command.Filename)
+
+		existing, err := readInstalledCommand(commandPath)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			continue
+		}
+		if existing.Modified && !force {
+			kept = append(kept, commandPath)
+			continue
+		}
+
+		if err := os.Remove(commandPath); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", commandPath, err)
+		}
+		removed = append(removed, command.Filename)
+	}
+
+	fmt.Printf("Removed %d slash command(s) from %s\n", len(removed), commandsDir)
+	if len(kept) > 0 {
+		fmt.Printf("Warning: kept %d slash command(s) you modified (run with --force to remove them):\n", len(kept))
+		for _, path := range kept {
+			fmt.Printf("  %s\n", path)
+		}
+	}
+	return nil
+}
+
+// shellQuote quotes a string as a single word for POSIX shells, which don't understand Go's %q escapes
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// gitHookMarker identifies pre-commit hooks written by installGitHook, which may be overwritten
+const gitHookMarker = "# Installed by claude-review"
+
+// installGitHook installs a pre-commit hook in the repository containing projectDir that runs `check --staged`.
+// An existing pre-commit hook is only replaced if claude-review installed it.
+func installGitHook(projectDir string) error {
+	hooksDir, err := gitHooksDir(projectDir)
+	if err != nil {
+		return fmt.Errorf("not a git repository: %w", err)
+	}
+
+	hookPath := filepath.Join(hooksDir, "pre-commit")
+	if existing, err := os.ReadFile(hookPath); err == nil {
+		if !strings.Contains(string(existing), gitHookMarker) {
+			return fmt.Errorf("%s already exists; add `claude-review check --staged` to it manually", hookPath)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", hookPath, err)
+	}
+
+	// Use the absolute path of this binary, since git hooks don't necessarily run with the user's PATH
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate claude-review executable: %w", err)
+	}
+
+	hook := fmt.Sprintf(
+		"#!/bin/sh\n%s: blocks commits of Markdown files with open review feedback\nexec %s check --staged\n",
+		gitHookMarker, shellQuote(executable))
+
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return fmt.Errorf("failed to create hooks directory: %w", err)
+	}
+	if err := os.WriteFile(hookPath, []byte(hook), 0755); err != nil {
+		return fmt.Errorf("failed to write %s: %w", hookPath, err)
+	}
+
+	fmt.Printf("Installed pre-commit hook to %s\n", hookPath)
+	return nil
+}
+
+// mcpServerName is the name the MCP server is registered under in Claude Code
+const mcpServerName = "claude-review"
+
+// installMCPServer registers `claude-review mcp` as a user-scoped MCP server in Claude Code. The claude CLI
+// does this itself when it is installed; otherwise the server is added to its config (~/.claude.json) directly.
+func installMCPServer() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate claude-review executable: %w", err)
+	}
+
+	if claude, err := exec.LookPath("claude"); err == nil {
+		// `claude mcp add` refuses to replace an existing server, so a previous registration is removed first
+		_ = exec.Command(claude, "mcp", "remove", "--scope", "user", mcpServerName).Run()
+		output, err := exec.Command(claude, "mcp", "add", "--scope", "user", mcpServerName, "--", executable, "mcp").
+			CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("claude mcp add failed: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+		fmt.Printf("Registered MCP server %q with claude mcp add\n", mcpServerName)
+		return nil
+	}
+
+	configPath, err := claudeConfigPath()
+	if err != nil {
+		return err
+	}
+
+	config, err := readJSONConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	servers, ok := config["mcpServers"].(map[string]interface{})
+	if !ok {
+		servers = make(map[string]interface{})
+	}
+	servers[mcpServerName] = map[string]interface{}{
+		"type":    "stdio",
+		"command": executable,
+		"args":    []string{"mcp"},
+	}
+	config["mcpServers"] = servers
+
+	if err := writeJSONConfig(configPath, config, 0600); err != nil {
+		return err
+	}
+
+	fmt.Printf("Registered MCP server %q in %s\n", mcpServerName, configPath)
+	return nil
+}
+
+// uninstallMCPServer removes the MCP server registered by installMCPServer, if any
+func uninstallMCPServer() error {
+	configPath, err := claudeConfigPath()
+	if err != nil {
+		return err
+	}
+
+	config, err := readJSONConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	servers, _ := config["mcpServers"].(map[string]interface{})
+	if _, ok := servers[mcpServerName]; !ok {
+		return nil
+	}
+
+	if claude, err := exec.LookPath("claude"); err == nil {
+		output, err := exec.Command(claude, "mcp", "remove", "--scope", "user", mcpServerName).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("claude mcp remove failed: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+		fmt.Printf("Unregistered MCP server %q with claude mcp remove\n", mcpServerName)
+		return nil
+	}
+
+	delete(servers, mcpServerName)
+	if err := writeJSONConfig(configPath, config, 0600); err != nil {
+		return err
+	}
+
+	fmt.Printf("Unregistered MCP server %q from %s\n", mcpServerName, configPath)
+	return nil
+}
+
+// claudeConfigPath returns the path of Claude Code's user config, where MCP servers are registered
+func claudeConfigPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".claude.json"), nil
+}
+
+// readJSONConfig reads a Claude Code JSON config or settings file. A missing file reads as empty.
+func readJSONConfig(path string) (map[string]interface{}, error) {
+	config := make(map[string]interface{})
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// writeJSONConfig writes a Claude Code JSON config or settings file, creating its directory if needed. The file
+// is replaced in one step, so Claude Code never reads it half-written.
+func writeJSONConfig(path string, config map[string]interface{}, perm os.FileMode) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
 	return nil
 }
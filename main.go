@@ -1,12 +1,17 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
@@ -22,11 +27,31 @@ func main() {
 		fmt.Println("  server --stop            Stop the running daemon")
 		fmt.Println("  server --status          Check if the daemon is running")
 		fmt.Println("  register                 Register the current project directory")
+		fmt.Println("  allow [--revoke]         Let the commands in the project's .claude-review.toml run")
 		fmt.Println("  review                   Start server, register project, and show file URL")
 		fmt.Println("  address                  Show unresolved comments for a file")
+		fmt.Println("  comment                  Comment on a file from the terminal, as the reviewer")
+		fmt.Println("  tui                      Review a file in a full-screen terminal interface")
 		fmt.Println("  reply                    Reply to a comment thread")
+		fmt.Println("  ask                      Start a thread with a question about a passage")
+		fmt.Println("  edit                     Edit one of the agent's messages")
+		fmt.Println("  delete                   Delete one of the agent's messages")
 		fmt.Println("  resolve                  Mark comments as resolved")
-		fmt.Println("  install                  Install slash commands")
+		fmt.Println("  status-update            Report progress on a thread (working, done or blocked)")
+		fmt.Println("  rounds                   Summarize the review rounds of a file")
+		fmt.Println("  verdict                  Approve a file or request changes")
+		fmt.Println("  status                   Show the review status of a file (exits 1 unless approved)")
+		fmt.Println("  check [--staged]         List Markdown files with open review feedback (exits 1 if any)")
+		fmt.Println("  autopilot                Show the autopilot jobs of a file, or the output of one")
+		fmt.Println("  mcp                      Serve the review tools to agents over MCP (stdio)")
+		fmt.Println("  install [--project]      Install slash commands (for the user, or the current project)")
+		fmt.Println("  install --git-hook       Install a pre-commit hook that runs check --staged")
+		fmt.Println("  install --mcp            Register the MCP server in Claude Code's config")
+		fmt.Println("  install --hooks          Install Claude Code hooks that announce new review comments")
+		fmt.Println("  uninstall [--project]    Remove slash commands, hooks and the MCP server registration")
+		fmt.Println("  doctor                   Diagnose installation problems")
+		fmt.Println("  db check [--fix]         Check the database for inconsistencies and optionally repair them")
+		fmt.Println("  db check --prune-missing Delete the reviews of projects whose directory is gone")
 		fmt.Println("  version                  Show version information")
 		os.Exit(1)
 	}
@@ -38,16 +63,50 @@ func main() {
 		runServer()
 	case "register":
 		runRegister()
+	case "allow":
+		runAllow()
 	case "review":
 		runReview()
 	case "address":
 		runAddress()
+	case "comment":
+		runComment()
+	case "tui":
+		runTUI()
 	case "reply":
 		runReply()
+	case "ask":
+		runAsk()
+	case "edit":
+		runEdit()
+	case "delete":
+		runDelete()
 	case "resolve":
 		runResolve()
+	case "status-update":
+		runStatusUpdate()
+	case "rounds":
+		runRounds()
+	case "verdict":
+		runVerdict()
+	case "status":
+		runStatus()
+	case "check":
+		runCheck()
+	case "autopilot":
+		runAutopilot()
+	case "mcp":
+		runMCP()
 	case "install":
 		runInstall()
+	case "uninstall":
+		runUninstall()
+	case "doctor":
+		runDoctor()
+	case "hook":
+		runHook()
+	case "db":
+		runDB()
 	case "version":
 		runVersion()
 	default:
@@ -86,7 +145,7 @@ func runServer() {
 
 	// Handle --daemon flag (parent process)
 	if *daemon {
-		if err := daemonize(); err != nil {
+		if err := daemonize(os.Stdout); err != nil {
 			log.Fatalf("Failed to daemonize: %v", err)
 		}
 		return
@@ -121,6 +180,14 @@ func runServer() {
 		_ = fileWatcher.close()
 	}()
 
+	// Send queued webhook requests, including those left over from before a restart
+	go runWebhookDeliveries()
+
+	// Autopilot jobs don't survive a restart
+	if err := failInterruptedAutopilotJobs(); err != nil {
+		log.Printf("Failed to update interrupted autopilot jobs: %v", err)
+	}
+
 	// Setup router
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
@@ -135,6 +202,17 @@ func runServer() {
 	r.Patch("/api/comments/{id}", handleUpdateComment)
 	r.Patch("/api/comments/{id}/resolve", handleResolveThread)
 	r.Delete("/api/comments/{id}", handleDeleteComment)
+	r.Post("/api/comments/{id}/restore", handleRestoreComment)
+	r.Get("/api/comments/{id}/revisions", handleGetCommentRevisions)
+	r.Post("/api/reviews", handleSubmitReview)
+	r.Get("/api/rounds", handleGetRounds)
+	r.Post("/api/verdicts", handleCreateVerdict)
+	r.Get("/api/verdicts", handleGetVerdicts)
+	r.Get("/api/autopilot", handleGetAutopilotJobs)
+	r.Get("/api/progress", handleGetThreadProgress)
+	r.Get("/api/rounds/{round}/snapshot", handleGetRoundSnapshot)
+	r.Get("/api/outline", handleGetOutline)
+	r.Get("/api/version", handleGetVersion)
 	r.Get("/api/events", handleSSE)
 	r.Post("/api/events", handleBroadcast)
 
@@ -191,6 +269,64 @@ func runRegister() {
 	log.Printf("Registered project: %s", *projectDir)
 }
 
+// runAllow lets the commands in a project's .claude-review.toml run, until the file changes. Like direnv's allow,
+// it shows what is being allowed, since the file comes with the repository.
+func runAllow() {
+	allowCmd := flag.NewFlagSet("allow", flag.ExitOnError)
+	projectDir := allowCmd.String("project", "", "Project directory (defaults to current directory)")
+	revoke := allowCmd.Bool("revoke", false, "Stop running the commands of the project's configuration")
+
+	if err := allowCmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	// Resolve project directory (default to current directory)
+	if *projectDir == "" || *projectDir == "." {
+		cwd, err := os.Getwd()
+		if err != nil {
+			log.Fatalf("Failed to get current directory: %v", err)
+		}
+		*projectDir = cwd
+	}
+
+	// Initialize database
+	if err := initDB(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	if *revoke {
+		if err := allowProjectConfig(*projectDir, ""); err != nil {
+			log.Fatalf("Failed to revoke: %v", err)
+		}
+		fmt.Printf("Commands in %s will no longer run\n", filepath.Join(*projectDir, projectConfigFile))
+		return
+	}
+
+	config, err := loadProjectConfig(*projectDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if config.hash == "" {
+		fmt.Printf("Error: %s does not exist\n", config.path)
+		os.Exit(1)
+	}
+	if err := allowProjectConfig(*projectDir, config.hash); err != nil {
+		log.Fatalf("Failed to allow: %v", err)
+	}
+
+	commands := config.commands()
+	if len(commands) == 0 {
+		fmt.Printf("Allowed %s, which runs no commands\n", config.path)
+		return
+	}
+	fmt.Printf("Allowed %s to run:\n", config.path)
+	for _, command := range commands {
+		fmt.Printf("  %s: %s\n", command[0], command[1])
+	}
+	fmt.Println("Changes to the file need to be allowed again.")
+}
+
 func runReview() {
 	// Parse flags
 	reviewCmd := flag.NewFlagSet("review", flag.ExitOnError)
@@ -218,36 +354,44 @@ func runReview() {
 	// Remove @ prefix if present
 	*filePath = strings.TrimPrefix(*filePath, "@")
 
+	reviewURL, err := openReview(*projectDir, *filePath, os.Stdout)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	fmt.Printf("Open this URL in your browser to start reviewing %s:\n\n%s\n", *filePath, reviewURL)
+}
+
+// openReview starts the server if it isn't running (reporting that to out), registers the project and returns the URL
+// to review the file at
+func openReview(projectDir, filePath string, out io.Writer) (string, error) {
 	// Step 1: Start daemon if not running
 	if !isServerRunning() {
-		if err := daemonize(); err != nil {
-			log.Fatalf("Failed to start server: %v", err)
+		if err := daemonize(out); err != nil {
+			return "", fmt.Errorf("failed to start server: %w", err)
 		}
 	}
 
 	// Step 2: Initialize database and register project
 	if err := initDB(); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		return "", fmt.Errorf("failed to initialize database: %w", err)
 	}
 
-	_, err := createProject(*projectDir)
-	if err != nil {
-		log.Fatalf("Failed to register project: %v", err)
+	if _, err := createProject(projectDir); err != nil {
+		return "", fmt.Errorf("failed to register project: %w", err)
 	}
 
-	// Step 3: Output URL
+	// Step 3: Build URL
 	port := os.Getenv("CR_LISTEN_PORT")
 	if port == "" {
 		port = "4779"
 	}
 
-	reviewURL := fmt.Sprintf(
+	return fmt.Sprintf(
 		"http://localhost:%s/projects%s/%s",
 		port,
-		escapePathComponents(*projectDir),
-		escapePathComponents(*filePath),
-	)
-	fmt.Printf("Open this URL in your browser to start reviewing %s:\n\n%s\n", *filePath, reviewURL)
+		escapePathComponents(projectDir),
+		escapePathComponents(filePath),
+	), nil
 }
 
 func runAddress() {
@@ -255,6 +399,11 @@ func runAddress() {
 	reviewCmd := flag.NewFlagSet("address", flag.ExitOnError)
 	projectDir := reviewCmd.String("project", "", "Project directory")
 	filePath := reviewCmd.String("file", "", "File path relative to project directory")
+	section := reviewCmd.String("section", "", "Only show threads within the section with this heading")
+	format := reviewCmd.String("format", "text", "Output format: text or json")
+	author := reviewCmd.String("author", "",
+		"Only show threads with messages from this reviewer (or role: user, agent)")
+	agentID := reviewCmd.String("agent-id", "", "Only show threads this agent session has replied to or claimed")
 
 	if err := reviewCmd.Parse(os.Args[2:]); err != nil {
 		log.Fatalf("Failed to parse flags: %v", err)
@@ -272,6 +421,10 @@ func runAddress() {
 		fmt.Println("Error: --file flag is required")
 		os.Exit(1)
 	}
+	if *format != "text" && *format != "json" {
+		fmt.Printf("Error: unknown format %q (expected text or json)\n", *format)
+		os.Exit(1)
+	}
 
 	// Remove @ prefix if present
 	*filePath = strings.TrimPrefix(*filePath, "@")
@@ -285,32 +438,108 @@ func runAddress() {
 	log.Printf("Searching for comments: project_directory=%q, file_path=%q", *projectDir, *filePath)
 
 	// Get unresolved comments
-	comments, err := getComments(*projectDir, *filePath, false)
+	comments, err := getComments(*projectDir, *filePath, false, false)
 	if err != nil {
 		log.Fatalf("Failed to get comments: %v", err)
 	}
 	log.Printf("Found %d unresolved comments", len(comments))
 
-	// Format and output comments
-	if len(comments) == 0 {
-		fmt.Printf("No unresolved comments for %s\n", *filePath)
+	// Drafts are hidden, but the agent should know that a review is in progress
+	drafts, err := countDrafts(*projectDir, *filePath)
+	if err != nil {
+		log.Fatalf("Failed to count draft comments: %v", err)
+	}
+
+	// Group comments by thread (root comments and their replies), with feedback on the whole document first
+	threads := documentLevelFirst(groupCommentsByThread(comments))
+
+	// The document itself is only needed for sections and front matter
+	content, readErr := os.ReadFile(filepath.Join(*projectDir, *filePath))
+
+	// Narrow down to the requested section
+	target := *filePath
+	var sectionItem *OutlineItem
+	if *section != "" {
+		if readErr != nil {
+			log.Fatalf("Failed to read file: %v", readErr)
+		}
+
+		outline := BuildOutline(content)
+		item := findOutlineSection(outline, *section)
+		if item == nil {
+			fmt.Printf("Error: section %q not found in %s\n", *section, *filePath)
+			os.Exit(1)
+		}
+
+		threads = filterThreadsByLines(threads, item.LineStart, item.LineEnd)
+		target = fmt.Sprintf("%s (section %q, lines %d-%d)", *filePath, item.Title, item.LineStart, item.LineEnd)
+		sectionItem = item
+	}
+
+	if *author != "" {
+		threads = filterThreadsByAuthor(threads, *author)
+		target = fmt.Sprintf("%s from %s", target, *author)
+	}
+
+	if *agentID != "" {
+		statuses, err := getThreadStatuses(*projectDir, *filePath)
+		if err != nil {
+			log.Fatalf("Failed to get thread statuses: %v", err)
+		}
+		threads = filterThreadsByAgent(threads, *agentID, statuses)
+		target = fmt.Sprintf("%s touched by agent %s", target, *agentID)
+	}
+
+	if *format == "json" {
+		output := addressOutput{
+			ProjectDirectory: *projectDir,
+			FilePath:         *filePath,
+			Section:          sectionItem,
+			Drafts:           drafts,
+			Threads:          toAddressThreads(threads),
+		}
+		if readErr == nil {
+			if fm, _ := ParseFrontMatter(content); fm != nil {
+				output.FrontMatter = fm.Fields
+			}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(output); err != nil {
+			log.Fatalf("Failed to encode comments: %v", err)
+		}
 		return
 	}
 
-	// Group comments by thread (root comments and their replies)
-	threads := groupCommentsByThread(comments)
+	// Format and output comments
+	if drafts > 0 {
+		fmt.Printf("Note: %d draft comment(s) for %s have not been submitted yet\n\n", drafts, *filePath)
+	}
+	if len(threads) == 0 {
+		fmt.Printf("No unresolved comments for %s\n", target)
+		return
+	}
 
-	fmt.Printf("Found %d unresolved comment(s) for %s:\n\n", len(threads), *filePath)
+	fmt.Printf("Found %d unresolved comment(s) for %s:\n\n", len(threads), target)
 
 	for threadIndex, thread := range threads {
 		rootComment := thread[0]
 
 		// Show root comment with line numbers
-		lineRange := ""
-		if rootComment.LineStart != nil && rootComment.LineEnd != nil {
-			lineRange = fmt.Sprintf(" (lines %d-%d)", *rootComment.LineStart, *rootComment.LineEnd)
+		var details []string
+		if rootComment.IsDocumentLevel() {
+			details = append(details, "whole document")
+		} else if rootComment.LineStart != nil && rootComment.LineEnd != nil {
+			details = append(details, fmt.Sprintf("lines %d-%d", *rootComment.LineStart, *rootComment.LineEnd))
 		}
-		fmt.Printf("## Comment #%d%s\n", rootComment.ID, lineRange)
+		if round := latestReviewRound(thread); round != 0 {
+			details = append(details, fmt.Sprintf("review round %d", round))
+		}
+		header := fmt.Sprintf("## Comment #%d", rootComment.ID)
+		if len(details) > 0 {
+			header += " (" + strings.Join(details, ", ") + ")"
+		}
+		fmt.Println(header)
 
 		// Show selected text for root comment
 		if rootComment.SelectedText != "" {
@@ -322,14 +551,14 @@ func runAddress() {
 		}
 
 		// Show root comment text
-		fmt.Printf("**%s:**\n", capitalizeFirst(rootComment.Author))
+		fmt.Printf("**%s%s:**\n", authorDisplayName(rootComment), editedMarker(rootComment))
 		fmt.Printf("%s\n", rootComment.CommentText)
 
 		// Show replies
 		if len(thread) > 1 {
 			fmt.Println()
 			for _, reply := range thread[1:] {
-				fmt.Printf("\n**Reply from %s:**\n", capitalizeFirst(reply.Author))
+				fmt.Printf("\n**Reply from %s%s:**\n", authorDisplayName(reply), editedMarker(reply))
 				fmt.Printf("%s\n", reply.CommentText)
 			}
 		}
@@ -340,6 +569,25 @@ func runAddress() {
 	}
 }
 
+// latestReviewRound returns the most recent review round that added to a thread, or 0 if none did
+func latestReviewRound(thread []Comment) int {
+	latest := 0
+	for _, c := range thread {
+		if c.ReviewRound != nil && *c.ReviewRound > latest {
+			latest = *c.ReviewRound
+		}
+	}
+	return latest
+}
+
+// editedMarker tells the agent that a comment changed after it was first written
+func editedMarker(c Comment) string {
+	if c.EditedAt != nil {
+		return " (edited)"
+	}
+	return ""
+}
+
 func groupCommentsByThread(comments []Comment) [][]Comment {
 	threads := make([][]Comment, 0)
 	threadMap := make(map[int][]Comment)
@@ -374,16 +622,137 @@ func groupCommentsByThread(comments []Comment) [][]Comment {
 	return threads
 }
 
+// documentLevelFirst moves the threads about the whole document ahead of those anchored to a selection, keeping
+// the order within each group
+func documentLevelFirst(threads [][]Comment) [][]Comment {
+	sort.SliceStable(threads, func(i, j int) bool {
+		return threads[i][0].IsDocumentLevel() && !threads[j][0].IsDocumentLevel()
+	})
+	return threads
+}
+
+// addressOutput is the JSON form of the address command output
+type addressOutput struct {
+	ProjectDirectory string                 `json:"project_directory"`
+	FilePath         string                 `json:"file_path"`
+	FrontMatter      map[string]interface{} `json:"front_matter,omitempty"`
+	Section          *OutlineItem           `json:"section,omitempty"`
+	Drafts           int                    `json:"drafts"` // Comments in a review that hasn't been submitted yet
+	Threads          []addressThread        `json:"threads"`
+}
+
+// addressThread is an unresolved thread: the root comment's anchor followed by all of its messages
+type addressThread struct {
+	ID           int       `json:"id"`
+	LineStart    *int      `json:"line_start,omitempty"`
+	LineEnd      *int      `json:"line_end,omitempty"`
+	SelectedText string    `json:"selected_text"`
+	Messages     []Comment `json:"messages"`
+}
+
+// toAddressThreads converts threads grouped by groupCommentsByThread to their JSON form
+func toAddressThreads(threads [][]Comment) []addressThread {
+	result := make([]addressThread, 0, len(threads))
+	for _, thread := range threads {
+		root := thread[0]
+		result = append(result, addressThread{
+			ID:           root.ID,
+			LineStart:    root.LineStart,
+			LineEnd:      root.LineEnd,
+			SelectedText: root.SelectedText,
+			Messages:     thread,
+		})
+	}
+	return result
+}
+
+// filterThreadsByLines keeps the threads whose root comment starts within the given line range
+func filterThreadsByLines(threads [][]Comment, lineStart, lineEnd int) [][]Comment {
+	filtered := make([][]Comment, 0, len(threads))
+	for _, thread := range threads {
+		root := thread[0]
+		if root.LineStart != nil && *root.LineStart >= lineStart && *root.LineStart <= lineEnd {
+			filtered = append(filtered, thread)
+		}
+	}
+	return filtered
+}
+
+// filterThreadsByAuthor keeps the threads that have at least one message from the given reviewer or agent session.
+// Messages without a reviewer name, and all agent messages, also match their role, so "user" finds comments from
+// unnamed reviewers and "agent" finds replies from any agent session.
+func filterThreadsByAuthor(threads [][]Comment, author string) [][]Comment {
+	filtered := make([][]Comment, 0, len(threads))
+	for _, thread := range threads {
+		for _, c := range thread {
+			matches := strings.EqualFold(c.AuthorName, author) ||
+				(c.AgentID != "" && strings.EqualFold(c.AgentID, author))
+			if c.AuthorName == "" || c.Author == "agent" {
+				matches = matches || strings.EqualFold(c.Author, author)
+			}
+			if matches {
+				filtered = append(filtered, thread)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// filterThreadsByAgent keeps the threads that the given agent session has replied to or reported progress on
+func filterThreadsByAgent(threads [][]Comment, agentID string, statuses map[int]ThreadStatus) [][]Comment {
+	filtered := make([][]Comment, 0, len(threads))
+	for _, thread := range threads {
+		if status, ok := statuses[thread[0].ID]; ok && status.AgentID == agentID {
+			filtered = append(filtered, thread)
+			continue
+		}
+		for _, c := range thread {
+			if c.Author == "agent" && c.AgentID == agentID {
+				filtered = append(filtered, thread)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// authorDisplayName is the reviewer's name, or the capitalized role for unnamed reviewers and the agent.
+// Agent messages keep the role so that they're never mistaken for a reviewer: "Agent (session-1)".
+func authorDisplayName(c Comment) string {
+	if c.Author == "agent" && c.AgentID != "" {
+		return fmt.Sprintf("%s (%s)", capitalizeFirst(c.Author), c.AgentID)
+	}
+	if c.AuthorName == "" {
+		return capitalizeFirst(c.Author)
+	}
+	return c.AuthorName
+}
+
 func runReply() {
 	// Parse flags
 	replyCmd := flag.NewFlagSet("reply", flag.ExitOnError)
 	commentID := replyCmd.Int("comment-id", 0, "ID of the comment to reply to")
 	message := replyCmd.String("message", "", "Reply message")
+	as := replyCmd.String("as", "agent", "Reply as the agent, or as the user when reviewing from the terminal")
+	agentIDFlag := replyCmd.String("agent-id", "", "Agent session ID (default $"+agentIDEnvVar+")")
+	name := replyCmd.String("name", "", "Reviewer name shown with a reply --as user")
 
 	if err := replyCmd.Parse(os.Args[2:]); err != nil {
 		log.Fatalf("Failed to parse flags: %v", err)
 	}
 
+	var authorName, agentID string
+	switch *as {
+	case "agent":
+		agentID = resolveAgentID(*agentIDFlag)
+	case "user":
+		authorName = resolveReviewerName(*name)
+	default:
+		fmt.Println("Error: --as must be agent or user")
+		os.Exit(1)
+	}
+
 	if *commentID == 0 {
 		fmt.Println("Error: --comment-id flag is required")
 		os.Exit(1)
@@ -399,140 +768,1002 @@ func runReply() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	reply, err := addReply(*commentID, *message, *as, authorName, agentID)
+	if errors.Is(err, errCommentNotFound) {
+		fmt.Printf("Error: comment %d not found\n", *commentID)
+		os.Exit(1)
+	}
+	if errors.Is(err, errNotRootComment) {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatalf("Failed to create reply: %v", err)
+	}
+
+	fmt.Printf("Reply added to comment %d (reply #%d)\n", *commentID, reply.ID)
+}
+
+// errNotRootComment is returned when replying to a reply rather than to the root comment of its thread
+var errNotRootComment = errors.New("can only reply to root comments, not to replies")
+
+// addReply adds a reply by the agent or the user to a published thread and notifies the viewers of the file.
+// authorName is the reviewer's name for user replies and agentID the agent session for agent replies.
+func addReply(commentID int, message, author, authorName, agentID string) (*Comment, error) {
 	// Get the comment to reply to
-	parentComment, err := getCommentByID(*commentID)
+	parentComment, err := getCommentByID(commentID)
 	if err != nil {
-		log.Fatalf("Failed to get comment: %v", err)
+		return nil, err
 	}
-	if parentComment == nil {
-		fmt.Printf("Error: comment %d not found\n", *commentID)
-		os.Exit(1)
+	if parentComment == nil || parentComment.Draft {
+		return nil, errCommentNotFound
 	}
 
 	// Ensure we're replying to a root comment (not a reply)
 	if parentComment.RootID != nil {
-		fmt.Println("Error: can only reply to root comments, not to replies")
-		os.Exit(1)
+		return nil, errNotRootComment
 	}
 
 	// Create the reply
 	reply := &Comment{
 		ProjectDirectory: parentComment.ProjectDirectory,
 		FilePath:         parentComment.FilePath,
-		CommentText:      *message,
-		Author:           "agent",
+		CommentText:      message,
+		Author:           author,
+		AuthorName:       authorName,
+		AgentID:          agentID,
 		RootID:           &parentComment.ID,
 	}
 
+	if err := validateComment(reply); err != nil {
+		return nil, err
+	}
 	if err := createComment(reply); err != nil {
-		log.Fatalf("Failed to create reply: %v", err)
+		return nil, err
 	}
 
-	fmt.Printf("Reply added to comment %d\n", *commentID)
-
 	// Notify server about the new reply (if server is running)
-	notifyServerCommentsChanged(parentComment.ProjectDirectory, parentComment.FilePath)
+	notifyServer(parentComment.ProjectDirectory, parentComment.FilePath, "comment_added", reply.ID)
+	return reply, nil
 }
 
-func runResolve() {
+func runAsk() {
 	// Parse flags
-	resolveCmd := flag.NewFlagSet("resolve", flag.ExitOnError)
-	projectDir := resolveCmd.String("project", "", "Project directory")
-	filePath := resolveCmd.String("file", "", "File path relative to project directory")
-	commentID := resolveCmd.Int("comment-id", 0, "ID of specific comment to resolve")
-
-	if err := resolveCmd.Parse(os.Args[2:]); err != nil {
+	askCmd := flag.NewFlagSet("ask", flag.ExitOnError)
+	projectDir := askCmd.String("project", "", "Project directory")
+	filePath := askCmd.String("file", "", "File path relative to project directory")
+	lines := askCmd.String("lines", "", "Lines the question is about, e.g. 40-45 (default: the whole document)")
+	text := askCmd.String("text", "", "Passage on those lines to highlight (default: the text of the first block)")
+	message := askCmd.String("message", "", "Question for the reviewer")
+	agentIDFlag := askCmd.String("agent-id", "", "Agent session ID (default $"+agentIDEnvVar+")")
+
+	if err := askCmd.Parse(os.Args[2:]); err != nil {
 		log.Fatalf("Failed to parse flags: %v", err)
 	}
+	agentID := resolveAgentID(*agentIDFlag)
+	*projectDir, *filePath = resolveFileFlags(*projectDir, *filePath)
+
+	if *message == "" {
+		fmt.Println("Error: --message flag is required")
+		os.Exit(1)
+	}
+	if *lines == "" && *text != "" {
+		fmt.Println("Error: --text needs --lines")
+		os.Exit(1)
+	}
+
+	question := &Comment{
+		ProjectDirectory: *projectDir,
+		FilePath:         *filePath,
+		CommentText:      *message,
+		Author:           "agent",
+		AgentID:          agentID,
+	}
+	if err := anchorComment(question, *lines, *text); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := validateComment(question); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Initialize database
 	if err := initDB(); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
-	// Handle comment-id mode
-	if *commentID != 0 {
-		comment, err := getCommentByID(*commentID)
-		if err != nil {
-			log.Fatalf("Failed to get comment: %v", err)
-		}
-		if comment == nil {
-			fmt.Printf("Error: comment %d not found\n", *commentID)
-			os.Exit(1)
-		}
-
-		// Get the root comment ID
-		rootID := *commentID
-		if comment.RootID != nil {
-			rootID = *comment.RootID
-		}
-
-		// Resolve the thread
-		count, err := resolveThread(rootID, "user")
-		if err != nil {
-			log.Fatalf("Failed to resolve thread: %v", err)
-		}
+	// Questions can open the first thread of a project
+	if _, err := createProject(*projectDir); err != nil {
+		log.Fatalf("Failed to register project: %v", err)
+	}
+	if err := createComment(question); err != nil {
+		log.Fatalf("Failed to create question: %v", err)
+	}
 
-		if count == 0 {
-			fmt.Printf("Thread %d was already resolved\n", rootID)
-		} else {
-			fmt.Printf("Resolved thread %d (%d comment(s))\n", rootID, count)
+	notifyServer(*projectDir, *filePath, "comment_added", question.ID)
+	fmt.Printf("Question added to %s (comment #%d)\n", *filePath, question.ID)
+}
 
-			// Notify server
-			notifyServerCommentsChanged(comment.ProjectDirectory, comment.FilePath)
-		}
-		return
+func runComment() {
+	// Parse flags
+	commentCmd := flag.NewFlagSet("comment", flag.ExitOnError)
+	projectDir := commentCmd.String("project", "", "Project directory")
+	filePath := commentCmd.String("file", "", "File path relative to project directory")
+	lines := commentCmd.String("lines", "", "Lines to comment on, e.g. 10-12 (default: the whole document)")
+	quote := commentCmd.String("quote", "", "Passage on those lines to highlight (default: the first block)")
+	message := commentCmd.String("message", "", "Comment text")
+	name := commentCmd.String("name", "", "Reviewer name shown with the comment")
+
+	if err := commentCmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
 	}
+	*projectDir, *filePath = resolveFileFlags(*projectDir, *filePath)
 
-	// Handle file mode (original behavior)
-	// Resolve project directory (default to current directory)
-	if *projectDir == "" || *projectDir == "." {
-		cwd, err := os.Getwd()
-		if err != nil {
-			log.Fatalf("Failed to get current directory: %v", err)
-		}
-		*projectDir = cwd
+	if *message == "" {
+		fmt.Println("Error: --message flag is required")
+		os.Exit(1)
 	}
-	if *filePath == "" {
-		fmt.Println("Error: --file flag is required (or use --comment-id)")
+	if *lines == "" && *quote != "" {
+		fmt.Println("Error: --quote needs --lines")
 		os.Exit(1)
 	}
 
-	// Remove @ prefix if present
-	*filePath = strings.TrimPrefix(*filePath, "@")
+	authorName := resolveReviewerName(*name)
 
-	// Debug: show what we're searching for
-	log.Printf("Searching for comments: project_directory=%q, file_path=%q", *projectDir, *filePath)
+	// Initialize database
+	if err := initDB(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
 
-	// First check if there are any unresolved comments
-	comments, err := getComments(*projectDir, *filePath, false)
+	comment, err := createUserComment(*projectDir, *filePath, *lines, *quote, *message, authorName)
 	if err != nil {
-		log.Fatalf("Failed to get comments: %v", err)
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
-	log.Printf("Found %d unresolved comments", len(comments))
+	fmt.Printf("Comment added to %s (comment #%d)\n", *filePath, comment.ID)
+}
 
-	// Resolve comments
-	count, err := resolveComments(*projectDir, *filePath)
-	if err != nil {
-		log.Fatalf("Failed to resolve comments: %v", err)
+// createUserComment publishes a comment the reviewer wrote in the terminal, with the comment command or the TUI.
+// lines and quote anchor it like the command's flags do; without lines, it is about the whole document. There is no
+// review to submit from the terminal, so the comment is published and announced to the file's viewers right away.
+func createUserComment(projectDir, filePath, lines, quote, message, authorName string) (*Comment, error) {
+	comment := &Comment{
+		ProjectDirectory: projectDir,
+		FilePath:         filePath,
+		CommentText:      message,
+		Author:           "user",
+		AuthorName:       authorName,
+	}
+	if err := anchorComment(comment, lines, quote); err != nil {
+		return nil, err
+	}
+	if err := validateComment(comment); err != nil {
+		return nil, err
 	}
 
-	if count == 0 {
-		fmt.Printf("No unresolved comments found for %s\n", *filePath)
-	} else {
-		fmt.Printf("Resolved %d comment(s) for %s\n", count, *filePath)
+	if _, err := createProject(projectDir); err != nil {
+		return nil, fmt.Errorf("failed to register project: %w", err)
+	}
+	if err := createComment(comment); err != nil {
+		return nil, fmt.Errorf("failed to create comment: %w", err)
+	}
 
-		// Notify server about resolved comments (if server is running)
-		notifyServerCommentsChanged(*projectDir, *filePath)
+	notifyServer(projectDir, filePath, "comment_added", comment.ID)
+	return comment, nil
+}
+
+func runEdit() {
+	// Parse flags
+	editCmd := flag.NewFlagSet("edit", flag.ExitOnError)
+	commentID := editCmd.Int("comment-id", 0, "ID of the agent message to edit")
+	message := editCmd.String("message", "", "New message text")
+	agentIDFlag := editCmd.String("agent-id", "", "Agent session ID (default $"+agentIDEnvVar+")")
+
+	if err := editCmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	if *commentID == 0 {
+		fmt.Println("Error: --comment-id flag is required")
+		os.Exit(1)
+	}
+
+	if *message == "" {
+		fmt.Println("Error: --message flag is required")
+		os.Exit(1)
+	}
+
+	// Initialize database
+	if err := initDB(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
 	}
+
+	comment := getAgentComment(*commentID, resolveAgentID(*agentIDFlag))
+	comment.CommentText = *message
+	if err := validateComment(comment); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := updateComment(comment.ID, *message); err != nil {
+		log.Fatalf("Failed to edit comment: %v", err)
+	}
+
+	fmt.Printf("Comment %d edited\n", comment.ID)
+
+	// Notify server about the edit (if server is running)
+	notifyServer(comment.ProjectDirectory, comment.FilePath, "comment_edited", comment.ID)
 }
 
-func runInstall() {
-	if err := installSlashCommands(); err != nil {
+func runDelete() {
+	// Parse flags
+	deleteCmd := flag.NewFlagSet("delete", flag.ExitOnError)
+	commentID := deleteCmd.Int("comment-id", 0, "ID of the agent message to delete")
+	agentIDFlag := deleteCmd.String("agent-id", "", "Agent session ID (default $"+agentIDEnvVar+")")
+
+	if err := deleteCmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	if *commentID == 0 {
+		fmt.Println("Error: --comment-id flag is required")
+		os.Exit(1)
+	}
+
+	// Initialize database
+	if err := initDB(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	comment := getAgentComment(*commentID, resolveAgentID(*agentIDFlag))
+
+	if err := deleteComment(comment.ID); err != nil {
+		log.Fatalf("Failed to delete comment: %v", err)
+	}
+
+	fmt.Printf("Comment %d deleted\n", comment.ID)
+
+	// Notify server about the deletion (if server is running)
+	notifyServer(comment.ProjectDirectory, comment.FilePath, "comment_deleted", comment.ID)
+}
+
+// getAgentComment loads a comment for the edit and delete commands, which may only change the agent's own messages.
+// When both are known, the message must also belong to the given agent session.
+func getAgentComment(commentID int, agentID string) *Comment {
+	comment, err := getCommentByID(commentID)
+	if err != nil {
+		log.Fatalf("Failed to get comment: %v", err)
+	}
+	if comment == nil || comment.Draft {
+		fmt.Printf("Error: comment %d not found\n", commentID)
+		os.Exit(1)
+	}
+	if comment.Author != "agent" {
+		fmt.Printf("Error: comment %d was written by the %s; only agent messages can be changed\n", commentID,
+			comment.Author)
+		os.Exit(1)
+	}
+	if agentID != "" && comment.AgentID != "" && comment.AgentID != agentID {
+		fmt.Printf("Error: comment %d belongs to agent session %q\n", commentID, comment.AgentID)
+		os.Exit(1)
+	}
+	return comment
+}
+
+// agentIDEnvVar lets each agent session identify itself without passing --agent-id to every command
+const agentIDEnvVar = "CR_AGENT_ID"
+
+// resolveAgentID returns the agent session ID from the --agent-id flag, falling back to the environment
+func resolveAgentID(flagValue string) string {
+	agentID := strings.TrimSpace(flagValue)
+	if agentID == "" {
+		agentID = strings.TrimSpace(os.Getenv(agentIDEnvVar))
+	}
+	if len(agentID) > maxAuthorNameLength {
+		fmt.Printf("Error: agent ID must be at most %d characters\n", maxAuthorNameLength)
+		os.Exit(1)
+	}
+	return agentID
+}
+
+// resolveReviewerName returns the reviewer name from a --name flag
+func resolveReviewerName(flagValue string) string {
+	name := strings.TrimSpace(flagValue)
+	if len(name) > maxAuthorNameLength {
+		fmt.Printf("Error: name must be at most %d characters\n", maxAuthorNameLength)
+		os.Exit(1)
+	}
+	return name
+}
+
+func runResolve() {
+	// Parse flags
+	resolveCmd := flag.NewFlagSet("resolve", flag.ExitOnError)
+	projectDir := resolveCmd.String("project", "", "Project directory")
+	filePath := resolveCmd.String("file", "", "File path relative to project directory")
+	commentID := resolveCmd.Int("comment-id", 0, "ID of specific comment to resolve")
+	agentIDFlag := resolveCmd.String("agent-id", "", "Agent session ID (default $"+agentIDEnvVar+")")
+
+	if err := resolveCmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+	agentID := resolveAgentID(*agentIDFlag)
+
+	// Initialize database
+	if err := initDB(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	// Handle comment-id mode
+	if *commentID != 0 {
+		rootID, count, err := resolveThreadOf(*commentID, "agent", agentID)
+		if errors.Is(err, errCommentNotFound) {
+			fmt.Printf("Error: comment %d not found\n", *commentID)
+			os.Exit(1)
+		}
+		if err != nil {
+			log.Fatalf("Failed to resolve thread: %v", err)
+		}
+
+		if count == 0 {
+			fmt.Printf("Thread %d was already resolved\n", rootID)
+		} else {
+			fmt.Printf("Resolved thread %d (%d comment(s))\n", rootID, count)
+		}
+		return
+	}
+
+	// Handle file mode (original behavior)
+	// Resolve project directory (default to current directory)
+	if *projectDir == "" || *projectDir == "." {
+		cwd, err := os.Getwd()
+		if err != nil {
+			log.Fatalf("Failed to get current directory: %v", err)
+		}
+		*projectDir = cwd
+	}
+	if *filePath == "" {
+		fmt.Println("Error: --file flag is required (or use --comment-id)")
+		os.Exit(1)
+	}
+
+	// Remove @ prefix if present
+	*filePath = strings.TrimPrefix(*filePath, "@")
+
+	// Debug: show what we're searching for
+	log.Printf("Searching for comments: project_directory=%q, file_path=%q", *projectDir, *filePath)
+
+	// First check if there are any unresolved comments
+	comments, err := getComments(*projectDir, *filePath, false, false)
+	if err != nil {
+		log.Fatalf("Failed to get comments: %v", err)
+	}
+	log.Printf("Found %d unresolved comments", len(comments))
+
+	// Resolve comments
+	count, err := resolveComments(*projectDir, *filePath, agentID)
+	if err != nil {
+		log.Fatalf("Failed to resolve comments: %v", err)
+	}
+
+	if count == 0 {
+		fmt.Printf("No unresolved comments found for %s\n", *filePath)
+	} else {
+		fmt.Printf("Resolved %d comment(s) for %s\n", count, *filePath)
+
+		// Notify server about resolved comments (if server is running)
+		notifyServerCommentsChanged(*projectDir, *filePath)
+	}
+}
+
+// resolveThreadOf resolves the thread a published comment belongs to on behalf of resolvedBy ("user" or "agent") and
+// notifies the viewers of the file. Returns the thread's root comment ID and the number of comments resolved.
+func resolveThreadOf(commentID int, resolvedBy, agentID string) (int, int, error) {
+	comment, err := getCommentByID(commentID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if comment == nil || comment.Draft {
+		return 0, 0, errCommentNotFound
+	}
+
+	// Get the root comment ID
+	rootID := commentID
+	if comment.RootID != nil {
+		rootID = *comment.RootID
+	}
+
+	// Resolve the thread
+	count, err := resolveThread(rootID, resolvedBy, agentID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if count > 0 {
+		notifyServer(comment.ProjectDirectory, comment.FilePath, "comments_resolved", rootID)
+	}
+	return rootID, count, nil
+}
+
+func runStatusUpdate() {
+	// Parse flags
+	statusCmd := flag.NewFlagSet("status-update", flag.ExitOnError)
+	commentID := statusCmd.Int("comment-id", 0, "ID of a comment in the thread")
+	state := statusCmd.String("state", "", "Progress on the thread: working, done or blocked")
+	note := statusCmd.String("note", "", "What you're doing, or what you're blocked on")
+	agentIDFlag := statusCmd.String("agent-id", "", "Agent session ID (default $"+agentIDEnvVar+")")
+
+	if err := statusCmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+	agentID := resolveAgentID(*agentIDFlag)
+
+	if *commentID == 0 {
+		fmt.Println("Error: --comment-id flag is required")
+		os.Exit(1)
+	}
+	switch *state {
+	case threadWorking, threadDone, threadBlocked:
+	default:
+		fmt.Println("Error: --state must be working, done or blocked")
+		os.Exit(1)
+	}
+
+	// Initialize database
+	if err := initDB(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	status, err := setThreadStatusOf(*commentID, *state, strings.TrimSpace(*note), agentID)
+	if errors.Is(err, errCommentNotFound) {
+		fmt.Printf("Error: comment %d not found\n", *commentID)
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatalf("Failed to update thread status: %v", err)
+	}
+
+	fmt.Printf("Thread %d marked as %s\n", status.ThreadID, status.State)
+}
+
+// setThreadStatusOf records the agent's progress on the thread a published comment belongs to and notifies the
+// viewers of the file
+func setThreadStatusOf(commentID int, state, note, agentID string) (*ThreadStatus, error) {
+	comment, err := getCommentByID(commentID)
+	if err != nil {
+		return nil, err
+	}
+	if comment == nil || comment.Draft {
+		return nil, errCommentNotFound
+	}
+
+	status := &ThreadStatus{ThreadID: commentID, State: state, Note: note, AgentID: agentID}
+	if comment.RootID != nil {
+		status.ThreadID = *comment.RootID
+	}
+	if err := setThreadStatus(status); err != nil {
+		return nil, err
+	}
+
+	notifyServer(comment.ProjectDirectory, comment.FilePath, "thread_status_changed", status.ThreadID)
+	return status, nil
+}
+
+func runInstall() {
+	// Parse flags
+	installCmd := flag.NewFlagSet("install", flag.ExitOnError)
+	gitHook := installCmd.Bool("git-hook", false, "Install a pre-commit hook in the current git repository instead")
+	mcp := installCmd.Bool("mcp", false, "Register the MCP server in Claude Code's config instead")
+	hooks := installCmd.Bool("hooks", false, "Install Claude Code hooks that announce new review comments instead")
+	project := installCmd.Bool("project", false, "Install into the current project's .claude directory")
+	force := installCmd.Bool("force", false, "Overwrite slash commands even if you modified them")
+
+	if err := installCmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	if *gitHook {
+		cwd, err := os.Getwd()
+		if err != nil {
+			log.Fatalf("Failed to get current directory: %v", err)
+		}
+		if err := installGitHook(cwd); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *mcp {
+		if err := installMCPServer(); err != nil {
+			log.Fatalf("Failed to register MCP server: %v", err)
+		}
+		return
+	}
+
+	if *hooks {
+		settingsPath, err := claudeSettingsPath(*project)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err := installClaudeCodeHooks(settingsPath); err != nil {
+			log.Fatalf("Failed to install hooks: %v", err)
+		}
+		return
+	}
+
+	commandsDir, err := slashCommandsDir(*project)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := installSlashCommands(commandsDir, *force); err != nil {
 		log.Fatalf("Failed to install slash commands: %v", err)
 	}
 }
 
+func runUninstall() {
+	// Parse flags
+	uninstallCmd := flag.NewFlagSet("uninstall", flag.ExitOnError)
+	project := uninstallCmd.Bool("project", false, "Uninstall from the current project's .claude directory")
+	force := uninstallCmd.Bool("force", false, "Remove slash commands even if you modified them")
+
+	if err := uninstallCmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	commandsDir, err := slashCommandsDir(*project)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := uninstallSlashCommands(commandsDir, *force); err != nil {
+		log.Fatalf("Failed to uninstall slash commands: %v", err)
+	}
+
+	settingsPath, err := claudeSettingsPath(*project)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := uninstallClaudeCodeHooks(settingsPath); err != nil {
+		log.Fatalf("Failed to uninstall hooks: %v", err)
+	}
+
+	// MCP servers are only registered for the user
+	if !*project {
+		if err := uninstallMCPServer(); err != nil {
+			log.Fatalf("Failed to unregister MCP server: %v", err)
+		}
+	}
+}
+
+// claudeSettingsPath returns the Claude Code settings file of the current project, or the user's
+func claudeSettingsPath(project bool) (string, error) {
+	if project {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("failed to get current directory: %w", err)
+		}
+		return filepath.Join(cwd, ".claude", "settings.json"), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".claude", "settings.json"), nil
+}
+
+func runDB() {
+	if len(os.Args) < 3 || os.Args[2] != "check" {
+		fmt.Println("Usage: claude-review db check [--fix] [--prune-missing]")
+		os.Exit(1)
+	}
+
+	// Parse flags
+	checkCmd := flag.NewFlagSet("db check", flag.ExitOnError)
+	fix := checkCmd.Bool("fix", false, "Repair orphaned replies and unregistered projects")
+	pruneMissing := checkCmd.Bool("prune-missing", false,
+		"Delete projects whose directory is gone, together with all their comments")
+
+	if err := checkCmd.Parse(os.Args[3:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	// Initialize database
+	if err := initDB(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	report, err := checkDB()
+	if err != nil {
+		log.Fatalf("Failed to check database: %v", err)
+	}
+
+	if len(report.IntegrityErrors) == 0 {
+		fmt.Println("Integrity check: ok")
+	} else {
+		fmt.Printf("Integrity check: %d error(s)\n", len(report.IntegrityErrors))
+		for _, e := range report.IntegrityErrors {
+			fmt.Printf("  %s\n", e)
+		}
+	}
+
+	fmt.Printf("Orphaned replies: %d\n", len(report.OrphanedReplies))
+	for _, c := range report.OrphanedReplies {
+		fmt.Printf("  #%d (reply to missing #%d) in %s\n", c.ID, *c.RootID,
+			filepath.Join(c.ProjectDirectory, c.FilePath))
+	}
+
+	fmt.Printf("Unregistered projects: %d\n", len(report.UnregisteredProjects))
+	for _, directory := range report.UnregisteredProjects {
+		fmt.Printf("  %s\n", directory)
+	}
+
+	missing := make([]string, 0, len(report.MissingProjects))
+	missingComments := 0
+	for directory, count := range report.MissingProjects {
+		missing = append(missing, directory)
+		missingComments += count
+	}
+	sort.Strings(missing)
+	fmt.Printf("Projects with missing directories: %d\n", len(missing))
+	for _, directory := range missing {
+		fmt.Printf("  %s (%d comment(s))\n", directory, report.MissingProjects[directory])
+	}
+
+	if !report.HasProblems() {
+		fmt.Println("\nNo problems found")
+		return
+	}
+
+	repairable := len(report.OrphanedReplies) > 0 || len(report.UnregisteredProjects) > 0
+	if !*fix && !*pruneMissing {
+		fmt.Println()
+		if repairable {
+			fmt.Println("Run with --fix to repair")
+		}
+		if len(missing) > 0 {
+			fmt.Printf("Run with --prune-missing to delete these project(s) and their %d comment(s)\n", missingComments)
+		}
+		os.Exit(1)
+	}
+
+	if *fix && repairable {
+		if err := repairDB(report); err != nil {
+			log.Fatalf("Failed to repair database: %v", err)
+		}
+		fmt.Printf("\nDeleted %d orphaned reply(ies), registered %d project(s)\n",
+			len(report.OrphanedReplies), len(report.UnregisteredProjects))
+	} else if repairable {
+		fmt.Println("\nRun with --fix to repair orphaned replies and unregistered projects")
+	}
+
+	if len(missing) > 0 {
+		if *pruneMissing {
+			if err := pruneMissingProjects(report); err != nil {
+				log.Fatalf("Failed to prune projects: %v", err)
+			}
+			fmt.Printf("\nRemoved %d project(s) with missing directories and their %d comment(s)\n",
+				len(missing), missingComments)
+		} else {
+			fmt.Printf("\nKept %d project(s) with missing directories; run with --prune-missing to delete them\n",
+				len(missing))
+		}
+	}
+
+	if len(report.IntegrityErrors) > 0 {
+		fmt.Println("Integrity errors can't be repaired automatically")
+		os.Exit(1)
+	}
+}
+
+func runRounds() {
+	// Parse flags
+	roundsCmd := flag.NewFlagSet("rounds", flag.ExitOnError)
+	projectDir := roundsCmd.String("project", "", "Project directory")
+	filePath := roundsCmd.String("file", "", "File path relative to project directory")
+	format := roundsCmd.String("format", "text", "Output format: text or json")
+
+	if err := roundsCmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	*projectDir, *filePath = resolveFileFlags(*projectDir, *filePath)
+	if *format != "text" && *format != "json" {
+		fmt.Printf("Error: unknown format %q (expected text or json)\n", *format)
+		os.Exit(1)
+	}
+
+	// Initialize database
+	if err := initDB(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	summaries, err := getRoundSummaries(*projectDir, *filePath)
+	if err != nil {
+		log.Fatalf("Failed to summarize review rounds: %v", err)
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(summaries); err != nil {
+			log.Fatalf("Failed to encode review rounds: %v", err)
+		}
+		return
+	}
+
+	if len(summaries) == 0 {
+		fmt.Printf("No review rounds for %s\n", *filePath)
+		return
+	}
+
+	fmt.Printf("Review rounds for %s:\n", *filePath)
+	for _, summary := range summaries {
+		by := ""
+		if summary.AuthorName != "" {
+			by = " by " + summary.AuthorName
+		}
+		submitted := summary.SubmittedAt.Local().Format("2006-01-02 15:04")
+		fmt.Printf("\nRound %d (submitted %s%s)\n", summary.Round, submitted, by)
+		fmt.Printf("  Opened:   %s\n", formatThreadIDs(summary.Opened))
+		fmt.Printf("  Answered: %s\n", formatThreadIDs(summary.Answered))
+		fmt.Printf("  Resolved: %s\n", formatThreadIDs(summary.Resolved))
+	}
+	fmt.Printf("\n%d round(s)\n", len(summaries))
+}
+
+// formatThreadIDs formats a count followed by the thread IDs, e.g. "2 thread(s) (#3, #7)"
+func formatThreadIDs(ids []int) string {
+	if len(ids) == 0 {
+		return "0 thread(s)"
+	}
+	refs := make([]string, len(ids))
+	for i, id := range ids {
+		refs[i] = fmt.Sprintf("#%d", id)
+	}
+	return fmt.Sprintf("%d thread(s) (%s)", len(ids), strings.Join(refs, ", "))
+}
+
+func runVerdict() {
+	// Parse flags
+	verdictCmd := flag.NewFlagSet("verdict", flag.ExitOnError)
+	projectDir := verdictCmd.String("project", "", "Project directory")
+	filePath := verdictCmd.String("file", "", "File path relative to project directory")
+	approve := verdictCmd.Bool("approve", false, "Approve the file")
+	requestChanges := verdictCmd.Bool("request-changes", false, "Request changes to the file")
+	inProgress := verdictCmd.Bool("in-progress", false, "Mark the review as in progress again")
+	message := verdictCmd.String("message", "", "Optional note explaining the verdict")
+	author := verdictCmd.String("author", "", "Name of the reviewer giving the verdict")
+
+	if err := verdictCmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	var statuses []string
+	if *approve {
+		statuses = append(statuses, statusApproved)
+	}
+	if *requestChanges {
+		statuses = append(statuses, statusChangesRequested)
+	}
+	if *inProgress {
+		statuses = append(statuses, statusInProgress)
+	}
+	if len(statuses) != 1 {
+		fmt.Println("Error: exactly one of --approve, --request-changes or --in-progress is required")
+		os.Exit(1)
+	}
+
+	*projectDir, *filePath = resolveFileFlags(*projectDir, *filePath)
+
+	// Initialize database
+	if err := initDB(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	verdict := &Verdict{
+		ProjectDirectory: *projectDir,
+		FilePath:         *filePath,
+		Status:           statuses[0],
+		AuthorName:       strings.TrimSpace(*author),
+		Note:             *message,
+	}
+
+	// A verdict can be the first thing recorded for a project
+	if _, err := createProject(*projectDir); err != nil {
+		log.Fatalf("Failed to register project: %v", err)
+	}
+	if err := createVerdict(verdict); err != nil {
+		log.Fatalf("Failed to record verdict: %v", err)
+	}
+
+	fmt.Printf("%s is now %s\n", *filePath, formatStatus(verdict.Status))
+
+	// Notify server about the new status (if server is running)
+	notifyServer(*projectDir, *filePath, "verdict_changed", 0)
+}
+
+func runStatus() {
+	// Parse flags
+	statusCmd := flag.NewFlagSet("status", flag.ExitOnError)
+	projectDir := statusCmd.String("project", "", "Project directory")
+	filePath := statusCmd.String("file", "", "File path relative to project directory")
+	history := statusCmd.Bool("history", false, "Show every verdict, not just the current one")
+
+	if err := statusCmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	*projectDir, *filePath = resolveFileFlags(*projectDir, *filePath)
+
+	// Initialize database
+	if err := initDB(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	verdicts, err := getVerdicts(*projectDir, *filePath)
+	if err != nil {
+		log.Fatalf("Failed to get verdicts: %v", err)
+	}
+
+	if len(verdicts) == 0 {
+		fmt.Printf("%s: %s (no verdict yet)\n", *filePath, formatStatus(statusInProgress))
+		os.Exit(1)
+	}
+
+	if *history {
+		for _, v := range verdicts {
+			fmt.Printf("  %s  %s\n", v.CreatedAt.Local().Format("2006-01-02 15:04"), formatVerdict(v))
+		}
+		fmt.Println()
+	}
+
+	current := verdicts[len(verdicts)-1]
+	fmt.Printf("%s: %s\n", *filePath, formatVerdict(current))
+
+	// Agents and git hooks gate on human sign-off through the exit code
+	if current.Status != statusApproved {
+		os.Exit(1)
+	}
+}
+
+func runCheck() {
+	// Parse flags
+	checkCmd := flag.NewFlagSet("check", flag.ExitOnError)
+	projectDir := checkCmd.String("project", "", "Project directory (with --staged, any directory of the repository)")
+	staged := checkCmd.Bool("staged", false, "Only check files staged for commit, in whichever projects they belong to")
+
+	if err := checkCmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	if *projectDir == "" || *projectDir == "." {
+		cwd, err := os.Getwd()
+		if err != nil {
+			log.Fatalf("Failed to get current directory: %v", err)
+		}
+		*projectDir = cwd
+	}
+
+	// Initialize database
+	if err := initDB(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	var pending []*FileReviewState
+	if *staged {
+		pending = stagedReviewStates(*projectDir)
+	} else {
+		states, err := getReviewStates(*projectDir)
+		if err != nil {
+			log.Fatalf("Failed to get review states: %v", err)
+		}
+		for _, state := range states {
+			if strings.HasSuffix(strings.ToLower(state.FilePath), ".md") && state.NeedsAttention() {
+				pending = append(pending, state)
+			}
+		}
+		sort.Slice(pending, func(i, j int) bool { return pending[i].FilePath < pending[j].FilePath })
+	}
+
+	if len(pending) == 0 {
+		fmt.Println("No open review feedback")
+		return
+	}
+
+	fmt.Printf("%d file(s) with open review feedback:\n", len(pending))
+	for _, state := range pending {
+		var problems []string
+		if state.UnresolvedThreads > 0 {
+			problems = append(problems, fmt.Sprintf("%d unresolved thread(s)", state.UnresolvedThreads))
+		}
+		if state.Verdict != nil && state.Verdict.Status != statusApproved {
+			problems = append(problems, formatVerdict(*state.Verdict))
+		}
+		fmt.Printf("  %s: %s\n", state.FilePath, strings.Join(problems, ", "))
+	}
+	if *staged {
+		fmt.Println("\nAddress the feedback before committing, or commit with --no-verify to skip this check")
+	}
+	os.Exit(1)
+}
+
+// stagedReviewStates returns the review states that need attention of the Markdown files staged for commit in the
+// repository containing dir. Each file is checked against the registered project it belongs to, which need not be
+// the root of the repository.
+func stagedReviewStates(dir string) []*FileReviewState {
+	files, err := stagedFiles(dir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	projects, err := getAllProjects()
+	if err != nil {
+		log.Fatalf("Failed to get projects: %v", err)
+	}
+	sort.Strings(files)
+
+	var pending []*FileReviewState
+	statesByProject := make(map[string]map[string]*FileReviewState)
+	for _, file := range files {
+		if !strings.HasSuffix(strings.ToLower(file), ".md") {
+			continue
+		}
+		project, filePath, ok := projectOf(projects, file)
+		if !ok {
+			continue
+		}
+
+		states, ok := statesByProject[project]
+		if !ok {
+			states, err = getReviewStates(project)
+			if err != nil {
+				log.Fatalf("Failed to get review states: %v", err)
+			}
+			statesByProject[project] = states
+		}
+		if state := states[filePath]; state != nil && state.NeedsAttention() {
+			pending = append(pending, state)
+		}
+	}
+	return pending
+}
+
+// resolveFileFlags applies the defaults shared by commands that operate on one file: the project defaults to the
+// current directory, --file is required and an @ prefix (from Claude Code file references) is removed
+func resolveFileFlags(projectDir, filePath string) (string, string) {
+	if projectDir == "" || projectDir == "." {
+		cwd, err := os.Getwd()
+		if err != nil {
+			log.Fatalf("Failed to get current directory: %v", err)
+		}
+		projectDir = cwd
+	}
+	if filePath == "" {
+		fmt.Println("Error: --file flag is required")
+		os.Exit(1)
+	}
+	return projectDir, strings.TrimPrefix(filePath, "@")
+}
+
+// formatStatus turns a review status into words, e.g. "changes requested"
+func formatStatus(status string) string {
+	return strings.ReplaceAll(status, "_", " ")
+}
+
+// formatVerdict describes a verdict, e.g. "approved by alice: Looks good"
+func formatVerdict(v Verdict) string {
+	text := formatStatus(v.Status)
+	if v.AuthorName != "" {
+		text += " by " + v.AuthorName
+	}
+	if v.Note != "" {
+		text += ": " + v.Note
+	}
+	return text
+}
+
 func runVersion() {
 	fmt.Println(Version)
 }
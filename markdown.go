@@ -1,24 +1,64 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/BurntSushi/toml"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
 	"github.com/yuin/goldmark"
 	highlighting "github.com/yuin/goldmark-highlighting/v2"
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
 	gmhtml "github.com/yuin/goldmark/renderer/html"
 	"github.com/yuin/goldmark/text"
 	"github.com/yuin/goldmark/util"
+	"gopkg.in/yaml.v3"
 )
 
+// newlineIndex holds the offsets of all newlines in a source, so that line numbers can be looked up
+// without rescanning the source from the start for every node
+type newlineIndex []int
+
+func newNewlineIndex(source []byte) newlineIndex {
+	index := make(newlineIndex, 0, bytes.Count(source, []byte{'\n'}))
+	for i, c := range source {
+		if c == '\n' {
+			index = append(index, i)
+		}
+	}
+	return index
+}
+
+// before returns the number of newlines before the given offset
+func (idx newlineIndex) before(offset int) int {
+	return sort.SearchInts(idx, offset)
+}
+
 // LineAttributeTransformer adds data-line-start and data-line-end attributes to all block nodes
 type LineAttributeTransformer struct{}
 
 func (t *LineAttributeTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
-	source := reader.Source()
+	newlines := newNewlineIndex(reader.Source())
 
 	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
 		if !entering {
@@ -40,20 +80,20 @@ func (t *LineAttributeTransformer) Transform(doc *ast.Document, reader text.Read
 				// Use the Info segment to find the opening fence line
 				if fcb.Info != nil {
 					infoStart := fcb.Info.Segment.Start
-					startLine = bytes.Count(source[:infoStart], []byte{'\n'}) + 1
+					startLine = newlines.before(infoStart) + 1
 				} else {
 					// No info, use first line of content
 					if fcb.Lines().Len() > 0 {
 						firstLine := fcb.Lines().At(0)
 						// The opening fence is on the line before the first content line
-						startLine = bytes.Count(source[:firstLine.Start], []byte{'\n'})
+						startLine = newlines.before(firstLine.Start)
 					}
 				}
 
 				// End line is after the last content line (includes closing fence)
 				if fcb.Lines().Len() > 0 {
 					lastLine := fcb.Lines().At(fcb.Lines().Len() - 1)
-					endLine = bytes.Count(source[:lastLine.Stop], []byte{'\n'}) + 1
+					endLine = newlines.before(lastLine.Stop) + 1
 					// Add 1 for the closing fence line
 					endLine++
 				}
@@ -63,14 +103,14 @@ func (t *LineAttributeTransformer) Transform(doc *ast.Document, reader text.Read
 				if lines.Len() > 0 {
 					// Node has direct line info
 					firstLine := lines.At(0)
-					startLine = bytes.Count(source[:firstLine.Start], []byte{'\n'}) + 1
+					startLine = newlines.before(firstLine.Start) + 1
 
 					lastLine := lines.At(lines.Len() - 1)
-					endLine = bytes.Count(source[:lastLine.Stop], []byte{'\n'}) + 1
+					endLine = newlines.before(lastLine.Stop) + 1
 				} else {
 					// Node has no direct line info
 					// Calculate from children
-					startLine, endLine = getChildLineRange(node, source)
+					startLine, endLine = getChildLineRange(node, newlines)
 					if startLine == 0 {
 						// No line info available from children either
 						return ast.WalkContinue, nil
@@ -88,7 +128,7 @@ func (t *LineAttributeTransformer) Transform(doc *ast.Document, reader text.Read
 }
 
 // getChildLineRange calculates line range from a node's children
-func getChildLineRange(node ast.Node, source []byte) (int, int) {
+func getChildLineRange(node ast.Node, newlines newlineIndex) (int, int) {
 	var startLine, endLine int
 
 	// Walk children to find first and last line numbers
@@ -96,10 +136,10 @@ func getChildLineRange(node ast.Node, source []byte) (int, int) {
 		lines := child.Lines()
 		if lines.Len() > 0 {
 			firstLine := lines.At(0)
-			childStart := bytes.Count(source[:firstLine.Start], []byte{'\n'}) + 1
+			childStart := newlines.before(firstLine.Start) + 1
 
 			lastLine := lines.At(lines.Len() - 1)
-			childEnd := bytes.Count(source[:lastLine.Stop], []byte{'\n'}) + 1
+			childEnd := newlines.before(lastLine.Stop) + 1
 
 			if startLine == 0 || childStart < startLine {
 				startLine = childStart
@@ -109,7 +149,7 @@ func getChildLineRange(node ast.Node, source []byte) (int, int) {
 			}
 		} else {
 			// Recursively check grandchildren
-			childStart, childEnd := getChildLineRange(child, source)
+			childStart, childEnd := getChildLineRange(child, newlines)
 			if childStart > 0 {
 				if startLine == 0 || childStart < startLine {
 					startLine = childStart
@@ -176,53 +216,730 @@ func customWrapperRenderer(w util.BufWriter, context highlighting.CodeBlockConte
 	}
 }
 
-// RenderMarkdownWithLineNumbers renders markdown to HTML with line number attributes
-func RenderMarkdownWithLineNumbers(source []byte) ([]byte, error) {
-	md := goldmark.New(
-		goldmark.WithExtensions(
-			&LineAttributeExtension{},
-			highlighting.NewHighlighting(
-				highlighting.WithStyle("friendly"),
-				highlighting.WithFormatOptions(
-					html.WithClasses(false),          // Use inline styles
-					html.PreventSurroundingPre(true), // Don't write <pre>, we handle it in customWrapperRenderer
-				),
-				highlighting.WithWrapperRenderer(customWrapperRenderer),
-			),
+// defaultFenceRenderers maps fence languages to the commands that turn their contents into SVG.
+// A renderer is only used when its executable is found in PATH.
+var defaultFenceRenderers = map[string][]string{
+	"dot":      {"dot", "-Tsvg"},
+	"mermaid":  {"mmdc", "--input", "-", "--output", "-", "--outputFormat", "svg", "--quiet"},
+	"plantuml": {"plantuml", "-tsvg", "-pipe"},
+}
+
+// fenceRendererTimeout bounds how long a single diagram command may run
+const fenceRendererTimeout = 10 * time.Second
+
+// fenceRenderers holds the active fence renderers, keyed by fence language
+var fenceRenderers = loadFenceRenderers(os.Getenv("CR_FENCE_RENDERERS"))
+
+// loadFenceRenderers merges the default fence renderers with overrides of the form
+// "lang=command args;lang2=command args". An empty command disables the language.
+func loadFenceRenderers(spec string) map[string][]string {
+	renderers := make(map[string][]string, len(defaultFenceRenderers))
+	for lang, command := range defaultFenceRenderers {
+		renderers[lang] = command
+	}
+
+	for _, entry := range strings.Split(spec, ";") {
+		lang, command, ok := strings.Cut(entry, "=")
+		lang = strings.TrimSpace(lang)
+		if !ok || lang == "" {
+			continue
+		}
+		if fields := strings.Fields(command); len(fields) > 0 {
+			renderers[lang] = fields
+		} else {
+			delete(renderers, lang)
+		}
+	}
+
+	return renderers
+}
+
+// diagramCacheSize bounds the number of rendered diagrams, and of failed renders, kept in memory
+const diagramCacheSize = 256
+
+// diagramCache holds rendered SVG and diagramFailures the errors of failed renders, both keyed by a hash of the
+// renderer command and fence contents. Failures are kept so a broken diagram doesn't rerun its command on every render.
+var (
+	diagramCache    = newRenderCache(diagramCacheSize)
+	diagramFailures = newRenderCache(diagramCacheSize)
+)
+
+// renderDiagram runs the fence renderer command with the fence contents on stdin and returns the SVG it produced
+func renderDiagram(command []string, source []byte) ([]byte, error) {
+	key := renderCacheKey("diagram", source, command...)
+	if svg, ok := diagramCache.get(key); ok {
+		return svg, nil
+	}
+	if message, ok := diagramFailures.get(key); ok {
+		return nil, errors.New(string(message))
+	}
+
+	svg, err := runDiagramCommand(command, source)
+	if err != nil {
+		diagramFailures.add(key, "", []byte(err.Error()), nil)
+		return nil, err
+	}
+	diagramCache.add(key, "", svg, nil)
+	return svg, nil
+}
+
+func runDiagramCommand(command []string, source []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), fenceRendererTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(source)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w: %s", command[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	// Drop anything before the SVG element, such as log lines some renderers print to stdout
+	output := stdout.Bytes()
+	start := bytes.Index(output, []byte("<svg"))
+	if start == -1 {
+		return nil, fmt.Errorf("%s did not produce SVG output", command[0])
+	}
+	return bytes.TrimSpace(output[start:]), nil
+}
+
+// KindDiagramBlock is the node kind of a fenced code block rendered as a diagram
+var KindDiagramBlock = ast.NewNodeKind("DiagramBlock")
+
+// DiagramBlock replaces a fenced code block whose language has a fence renderer
+type DiagramBlock struct {
+	ast.BaseBlock
+	Language string
+	SVG      []byte
+}
+
+func (n *DiagramBlock) Kind() ast.NodeKind {
+	return KindDiagramBlock
+}
+
+func (n *DiagramBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Language": n.Language}, nil)
+}
+
+// DiagramTransformer replaces fenced code blocks that have a fence renderer with DiagramBlock nodes.
+// It runs after LineAttributeTransformer so the diagram keeps the line range of its fence.
+type DiagramTransformer struct{}
+
+func (t *DiagramTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	deps, _ := pc.Get(renderDependenciesKey).(*renderDependencies)
+
+	// Collect first, replacing nodes while walking would break the traversal
+	var fences []*ast.FencedCodeBlock
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering && node.Kind() == ast.KindFencedCodeBlock {
+			fences = append(fences, node.(*ast.FencedCodeBlock))
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, fcb := range fences {
+		language := string(fcb.Language(source))
+		command, ok := fenceRenderers[language]
+		if !ok {
+			continue
+		}
+		if !deps.commandExists(command[0]) {
+			continue
+		}
+
+		var content bytes.Buffer
+		lines := fcb.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			line := lines.At(i)
+			content.Write(line.Value(source))
+		}
+
+		svg, err := renderDiagram(command, content.Bytes())
+		if err != nil {
+			// Fall back to the highlighted source
+			log.Printf("Failed to render %s diagram: %v", language, err)
+			continue
+		}
+
+		diagram := &DiagramBlock{Language: language, SVG: svg}
+		diagram.SetLines(lines)
+		for _, attr := range fcb.Attributes() {
+			diagram.SetAttribute(attr.Name, attr.Value)
+		}
+		fcb.Parent().ReplaceChild(fcb.Parent(), fcb, diagram)
+	}
+}
+
+// diagramHTMLRenderer writes DiagramBlock nodes as an image wrapped in a div with line number attributes. The SVG is
+// embedded as a data URL rather than inlined, so scripts and event handlers in the renderer's output never run.
+type diagramHTMLRenderer struct{}
+
+func (r *diagramHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindDiagramBlock, r.renderDiagramBlock)
+}
+
+func (r *diagramHTMLRenderer) renderDiagramBlock(
+	w util.BufWriter,
+	source []byte,
+	node ast.Node,
+	entering bool,
+) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*DiagramBlock)
+	_, _ = w.WriteString(`<div class="diagram" data-language="`)
+	_, _ = w.Write(util.EscapeHTML([]byte(n.Language)))
+	_, _ = w.WriteString(`"`)
+	gmhtml.RenderAttributes(w, n, nil)
+	_, _ = w.WriteString(">\n")
+	_, _ = w.WriteString(`<img src="data:image/svg+xml;base64,`)
+	_, _ = w.WriteString(base64.StdEncoding.EncodeToString(n.SVG))
+	_, _ = w.WriteString(`" alt="`)
+	_, _ = w.Write(util.EscapeHTML([]byte(n.Language)))
+	_, _ = w.WriteString(` diagram">`)
+	_, _ = w.WriteString("\n</div>\n")
+
+	return ast.WalkSkipChildren, nil
+}
+
+// DiagramExtension is a goldmark extension that renders fenced code blocks through fence renderers
+type DiagramExtension struct{}
+
+func (e *DiagramExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithASTTransformers(
+			util.Prioritized(&DiagramTransformer{}, 200),
 		),
-		goldmark.WithRendererOptions(
-			gmhtml.WithUnsafe(), // Allow raw HTML
+	)
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(
+			util.Prioritized(&diagramHTMLRenderer{}, 100),
 		),
 	)
+}
 
-	var buf bytes.Buffer
-	if err := md.Convert(source, &buf); err != nil {
-		return nil, err
+// documentPathKey is the parser context key holding the location of the document being rendered
+var documentPathKey = parser.NewContextKey()
+
+// renderDependenciesKey is the parser context key holding the renderDependencies being recorded for a rendering
+var renderDependenciesKey = parser.NewContextKey()
+
+// documentPath locates a rendered document within its project
+type documentPath struct {
+	projectDir string
+	filePath   string
+}
+
+// renderConfig holds per-document rendering settings
+type renderConfig struct {
+	documentPath *documentPath
+}
+
+// RenderOption configures a single RenderMarkdownWithLineNumbers call
+type RenderOption func(*renderConfig)
+
+// WithDocumentPath tells the renderer where the document lives, so that relative links and images
+// can be resolved to viewer URLs
+func WithDocumentPath(projectDir, filePath string) RenderOption {
+	return func(c *renderConfig) {
+		c.documentPath = &documentPath{projectDir: projectDir, filePath: filePath}
 	}
+}
 
-	return buf.Bytes(), nil
+// resolveLink turns a link destination relative to the document into a project path and a viewer URL.
+// Absolute URLs, absolute paths, bare anchors and paths escaping the project are not resolved.
+func (d *documentPath) resolveLink(destination string) (target, viewerURL string, ok bool) {
+	u, err := url.Parse(destination)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+		return "", "", false
+	}
+
+	target = path.Join(path.Dir(filepath.ToSlash(d.filePath)), u.Path)
+	if target == ".." || strings.HasPrefix(target, "../") {
+		return "", "", false
+	}
+
+	viewerURL = "/projects" + escapePathComponents(d.projectDir)
+	if target != "." {
+		viewerURL += "/" + escapePathComponents(target)
+	}
+	if strings.HasSuffix(u.Path, "/") {
+		viewerURL += "/"
+	}
+	if u.RawQuery != "" {
+		viewerURL += "?" + u.RawQuery
+	}
+	if u.Fragment != "" {
+		viewerURL += "#" + u.EscapedFragment()
+	}
+
+	return target, viewerURL, true
 }
 
-// RenderMarkdown renders markdown to HTML without line number attributes
-func RenderMarkdown(source []byte) ([]byte, error) {
-	md := goldmark.New(
-		goldmark.WithExtensions(
-			highlighting.NewHighlighting(
-				highlighting.WithStyle("friendly"),
-				highlighting.WithFormatOptions(
-					html.WithClasses(false), // Use inline styles
-				),
+// LinkResolverTransformer rewrites relative links and image sources to viewer URLs and marks
+// links to Markdown files that don't exist
+type LinkResolverTransformer struct{}
+
+func (t *LinkResolverTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	docPath, ok := pc.Get(documentPathKey).(*documentPath)
+	if !ok {
+		return
+	}
+	deps, _ := pc.Get(renderDependenciesKey).(*renderDependencies)
+
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := node.(type) {
+		case *ast.Link:
+			target, viewerURL, ok := docPath.resolveLink(string(n.Destination))
+			if !ok {
+				return ast.WalkContinue, nil
+			}
+			n.Destination = []byte(viewerURL)
+
+			if strings.HasSuffix(strings.ToLower(target), ".md") {
+				if !deps.fileExists(filepath.Join(docPath.projectDir, filepath.FromSlash(target))) {
+					n.SetAttributeString("class", []byte("broken-link"))
+					if len(n.Title) == 0 {
+						n.Title = []byte("File not found: " + target)
+					}
+				}
+			}
+		case *ast.Image:
+			if _, viewerURL, ok := docPath.resolveLink(string(n.Destination)); ok {
+				n.Destination = []byte(viewerURL)
+			}
+		}
+
+		return ast.WalkContinue, nil
+	})
+}
+
+// LinkResolverExtension is a goldmark extension that resolves relative links within the viewer
+type LinkResolverExtension struct{}
+
+func (e *LinkResolverExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithASTTransformers(
+			util.Prioritized(&LinkResolverTransformer{}, 300),
+		),
+	)
+}
+
+// FrontMatter is the YAML or TOML metadata block at the top of a document
+type FrontMatter struct {
+	Format  string                 `json:"format"`
+	Fields  map[string]interface{} `json:"fields"`
+	LineEnd int                    `json:"line_end"`
+	keys    []string               // Top-level keys in document order
+}
+
+// ParseFrontMatter splits a leading YAML (---) or TOML (+++) front matter block off a document.
+// The returned body has the front matter lines blanked out so line numbers stay the same.
+// If there is no front matter, or it doesn't parse, it returns nil and the source unchanged.
+func ParseFrontMatter(source []byte) (*FrontMatter, []byte) {
+	lines := bytes.SplitAfter(source, []byte{'\n'})
+	if len(lines) < 2 {
+		return nil, source
+	}
+
+	var format string
+	var closers []string
+	switch strings.TrimRight(string(lines[0]), " \t\r\n") {
+	case "---":
+		format, closers = "yaml", []string{"---", "..."}
+	case "+++":
+		format, closers = "toml", []string{"+++"}
+	default:
+		return nil, source
+	}
+
+	end := -1
+	for i := 1; i < len(lines) && end == -1; i++ {
+		line := strings.TrimRight(string(lines[i]), " \t\r\n")
+		for _, closer := range closers {
+			if line == closer {
+				end = i
+				break
+			}
+		}
+	}
+	if end == -1 {
+		return nil, source
+	}
+
+	content := bytes.Join(lines[1:end], nil)
+	fm := &FrontMatter{Format: format, Fields: make(map[string]interface{}), LineEnd: end + 1}
+
+	switch format {
+	case "yaml":
+		var node yaml.Node
+		if err := yaml.Unmarshal(content, &node); err != nil {
+			return nil, source
+		}
+		if len(node.Content) > 0 {
+			mapping := node.Content[0]
+			if mapping.Kind != yaml.MappingNode {
+				return nil, source
+			}
+			if err := mapping.Decode(&fm.Fields); err != nil {
+				return nil, source
+			}
+			for i := 0; i+1 < len(mapping.Content); i += 2 {
+				fm.keys = append(fm.keys, mapping.Content[i].Value)
+			}
+		}
+	case "toml":
+		meta, err := toml.Decode(string(content), &fm.Fields)
+		if err != nil {
+			return nil, source
+		}
+		for _, key := range meta.Keys() {
+			if len(key) == 1 {
+				fm.keys = append(fm.keys, key[0])
+			}
+		}
+	}
+
+	// Blank out the front matter, keeping one newline per line
+	body := make([]byte, 0, len(source))
+	body = append(body, bytes.Repeat([]byte{'\n'}, end+1)...)
+	for _, line := range lines[end+1:] {
+		body = append(body, line...)
+	}
+
+	return fm, body
+}
+
+// maxFrontMatterSize bounds how much of a file readFrontMatter reads looking for the end of the front matter
+const maxFrontMatterSize = 64 << 10
+
+// readFrontMatter parses the front matter of a file, reading no further than the end of the front matter block.
+// It returns nil if the file has no front matter or can't be read.
+func readFrontMatter(path string) *FrontMatter {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = file.Close() }()
+
+	reader := bufio.NewReader(io.LimitReader(file, maxFrontMatterSize))
+	block, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil
+	}
+	var closers []string
+	switch strings.TrimRight(string(block), " \t\r\n") {
+	case "---":
+		closers = []string{"---", "..."}
+	case "+++":
+		closers = []string{"+++"}
+	default:
+		return nil
+	}
+
+	for closed := false; !closed; {
+		line, err := reader.ReadBytes('\n')
+		block = append(block, line...)
+		closed = slices.Contains(closers, strings.TrimRight(string(line), " \t\r\n"))
+		if err != nil && !closed {
+			return nil
+		}
+	}
+
+	fm, _ := ParseFrontMatter(block)
+	return fm
+}
+
+// Get returns the string form of a top-level front matter field
+func (fm *FrontMatter) Get(key string) string {
+	if fm == nil {
+		return ""
+	}
+	value, ok := fm.Fields[key]
+	if !ok {
+		return ""
+	}
+	return formatFrontMatterValue(value)
+}
+
+// formatFrontMatterValue formats a front matter value for display
+func formatFrontMatterValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339)
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = formatFrontMatterValue(item)
+		}
+		return strings.Join(parts, ", ")
+	case map[string]interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// renderFrontMatter renders front matter as a metadata header carrying its line range
+func renderFrontMatter(fm *FrontMatter) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<div class="front-matter" data-line-start="1" data-line-end="%d">`+"\n", fm.LineEnd)
+	buf.WriteString("<dl>\n")
+	for _, key := range fm.keys {
+		fmt.Fprintf(
+			&buf,
+			"<dt>%s</dt><dd>%s</dd>\n",
+			html.EscapeString(key),
+			html.EscapeString(formatFrontMatterValue(fm.Fields[key])),
+		)
+	}
+	buf.WriteString("</dl>\n</div>\n")
+	return buf.Bytes()
+}
+
+// documentMarkdown renders documents with line number attributes. goldmark instances are safe for
+// concurrent use, so a single one is shared by all requests.
+var documentMarkdown = goldmark.New(
+	goldmark.WithExtensions(
+		&LineAttributeExtension{},
+		&DiagramExtension{},
+		&LinkResolverExtension{},
+		highlighting.NewHighlighting(
+			highlighting.WithStyle("friendly"),
+			highlighting.WithFormatOptions(
+				chromahtml.WithClasses(false),          // Use inline styles
+				chromahtml.PreventSurroundingPre(true), // Don't write <pre>, we handle it in customWrapperRenderer
 			),
+			highlighting.WithWrapperRenderer(customWrapperRenderer),
 		),
-		goldmark.WithRendererOptions(
-			gmhtml.WithUnsafe(), // Allow raw HTML
+	),
+	goldmark.WithParserOptions(
+		parser.WithAutoHeadingID(), // Heading IDs are used as outline anchors
+	),
+	goldmark.WithRendererOptions(
+		gmhtml.WithUnsafe(), // Allow raw HTML
+	),
+)
+
+// commentMarkdown renders comment text for the web UI
+var commentMarkdown = goldmark.New(
+	goldmark.WithExtensions(
+		highlighting.NewHighlighting(
+			highlighting.WithStyle("friendly"),
+			highlighting.WithFormatOptions(
+				chromahtml.WithClasses(false), // Use inline styles
+			),
 		),
-	)
+	),
+	goldmark.WithRendererOptions(
+		gmhtml.WithUnsafe(), // Allow raw HTML
+	),
+)
+
+// outlineMarkdown parses documents for their headings only
+var outlineMarkdown = goldmark.New(
+	goldmark.WithParserOptions(
+		parser.WithAutoHeadingID(),
+	),
+)
+
+// RenderMarkdownWithLineNumbers renders markdown to HTML with line number attributes.
+// Front matter is rendered as a metadata header above the document body.
+// Results are cached by content hash and render options, for as long as the linked files and diagram commands they
+// depended on are unchanged.
+func RenderMarkdownWithLineNumbers(source []byte, opts ...RenderOption) ([]byte, error) {
+	var cfg renderConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	var document string
+	if cfg.documentPath != nil {
+		document = renderCacheDocument(cfg.documentPath.projectDir, cfg.documentPath.filePath)
+	}
+	key := renderCacheKey("document", source, document)
+	if html, ok := renderCache.get(key); ok {
+		return html, nil
+	}
+
+	html, deps, err := renderDocument(source, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	renderCache.add(key, document, html, deps)
+	return html, nil
+}
+
+// renderDocument renders a document without going through the render cache, returning what the rendering depended on
+func renderDocument(source []byte, cfg renderConfig) ([]byte, *renderDependencies, error) {
+	fm, body := ParseFrontMatter(source)
+
+	deps := newRenderDependencies()
+	pc := parser.NewContext()
+	pc.Set(renderDependenciesKey, deps)
+	if cfg.documentPath != nil {
+		pc.Set(documentPathKey, cfg.documentPath)
+	}
+
+	var buf bytes.Buffer
+	if fm != nil {
+		buf.Write(renderFrontMatter(fm))
+	}
+	if err := documentMarkdown.Convert(body, &buf, parser.WithContext(pc)); err != nil {
+		return nil, nil, err
+	}
+
+	return buf.Bytes(), deps, nil
+}
+
+// OutlineItem is a heading of a document together with the line range of its section
+type OutlineItem struct {
+	ID                string         `json:"id"`
+	Title             string         `json:"title"`
+	Level             int            `json:"level"`
+	LineStart         int            `json:"line_start"`
+	LineEnd           int            `json:"line_end"`
+	UnresolvedThreads int            `json:"unresolved_threads"`
+	Children          []*OutlineItem `json:"children,omitempty"`
+}
+
+// BuildOutline returns the headings of a markdown document as a tree. A section spans from its heading
+// to the line before the next heading of the same or higher level, or to the end of the document.
+// Heading IDs match the ones generated by RenderMarkdownWithLineNumbers.
+func BuildOutline(source []byte) []*OutlineItem {
+	_, source = ParseFrontMatter(source)
+	doc := outlineMarkdown.Parser().Parse(text.NewReader(source))
+	newlines := newNewlineIndex(source)
+
+	// Collect headings in document order
+	var headings []*OutlineItem
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering || node.Kind() != ast.KindHeading {
+			return ast.WalkContinue, nil
+		}
+
+		heading := node.(*ast.Heading)
+		item := &OutlineItem{
+			Title: headingText(heading, source),
+			Level: heading.Level,
+		}
+		if id, ok := heading.AttributeString("id"); ok {
+			if idBytes, ok := id.([]byte); ok {
+				item.ID = string(idBytes)
+			}
+		}
+		if lines := heading.Lines(); lines.Len() > 0 {
+			item.LineStart = newlines.before(lines.At(0).Start) + 1
+		}
+		headings = append(headings, item)
+
+		return ast.WalkSkipChildren, nil
+	})
+
+	totalLines := len(newlines)
+	if len(source) > 0 && source[len(source)-1] != '\n' {
+		totalLines++
+	}
+
+	// Close each section at the next heading of the same or higher level
+	for i, item := range headings {
+		item.LineEnd = totalLines
+		for _, next := range headings[i+1:] {
+			if next.Level <= item.Level {
+				item.LineEnd = next.LineStart - 1
+				break
+			}
+		}
+	}
+
+	// Nest headings under the closest preceding heading of a higher level
+	var roots []*OutlineItem
+	var stack []*OutlineItem
+	for _, item := range headings {
+		for len(stack) > 0 && stack[len(stack)-1].Level >= item.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, item)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, item)
+		}
+		stack = append(stack, item)
+	}
+
+	return roots
+}
+
+// headingText returns the plain text of a heading's inline content
+func headingText(heading *ast.Heading, source []byte) string {
+	var buf bytes.Buffer
+	_ = ast.Walk(heading, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := node.(type) {
+		case *ast.Text:
+			buf.Write(n.Segment.Value(source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.Write(n.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(buf.String())
+}
+
+// findOutlineSection looks up a section by its heading title (case-insensitive) or heading ID
+func findOutlineSection(items []*OutlineItem, name string) *OutlineItem {
+	name = strings.TrimSpace(name)
+	for _, item := range items {
+		if strings.EqualFold(item.Title, name) || item.ID == name {
+			return item
+		}
+		if found := findOutlineSection(item.Children, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// RenderMarkdown renders markdown to HTML without line number attributes.
+// Results are cached by content hash.
+func RenderMarkdown(source []byte) ([]byte, error) {
+	key := renderCacheKey("comment", source)
+	if html, ok := commentRenderCache.get(key); ok {
+		return html, nil
+	}
 
 	var buf bytes.Buffer
-	if err := md.Convert(source, &buf); err != nil {
+	if err := commentMarkdown.Convert(source, &buf); err != nil {
 		return nil, err
 	}
 
+	commentRenderCache.add(key, "", buf.Bytes(), nil)
 	return buf.Bytes(), nil
 }
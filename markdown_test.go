@@ -1,6 +1,10 @@
 package main
 
 import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -264,3 +268,350 @@ func TestCustomWrapperRenderer(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadFenceRenderers(t *testing.T) {
+	renderers := loadFenceRenderers("dot=dot -Tpng; plantuml= ;ditaa=ditaa --svg -")
+
+	if got := strings.Join(renderers["dot"], " "); got != "dot -Tpng" {
+		t.Errorf("Expected dot override, got %q", got)
+	}
+	if _, ok := renderers["plantuml"]; ok {
+		t.Errorf("Expected plantuml to be disabled")
+	}
+	if got := strings.Join(renderers["ditaa"], " "); got != "ditaa --svg -" {
+		t.Errorf("Expected ditaa renderer, got %q", got)
+	}
+	if _, ok := renderers["mermaid"]; !ok {
+		t.Errorf("Expected mermaid default to be kept")
+	}
+}
+
+func TestFenceRenderers(t *testing.T) {
+	counterFile := filepath.Join(t.TempDir(), "runs")
+	failureFile := filepath.Join(t.TempDir(), "failures")
+	original := fenceRenderers
+	fenceRenderers = map[string][]string{
+		"fakediagram": {
+			"sh", "-c",
+			`echo run >> "$0"; printf '<?xml version="1.0"?>\n<svg data-src="'; tr -d '\n'; printf '"></svg>\n'`,
+			counterFile,
+		},
+		"brokendiagram": {"sh", "-c", `echo run >> "$0"; echo boom >&2; exit 1`, failureFile},
+	}
+	t.Cleanup(func() { fenceRenderers = original })
+
+	markdown := "# Title\n\n```fakediagram\na -> b\n```\n\n```brokendiagram\nc -> d\n```\n"
+
+	for i := 0; i < 2; i++ {
+		// Vary the document so the diagram cache is exercised rather than the render cache
+		html, err := RenderMarkdownWithLineNumbers([]byte(markdown + strings.Repeat("\nMore text.\n", i)))
+		if err != nil {
+			t.Fatalf("RenderMarkdownWithLineNumbers failed: %v", err)
+		}
+		htmlStr := string(html)
+
+		// The diagram keeps the same line range the code block would have had
+		want := `<div class="diagram" data-language="fakediagram" data-line-start="3" data-line-end="6">`
+		if !strings.Contains(htmlStr, want) {
+			t.Errorf("Expected %q in HTML, got: %s", want, htmlStr)
+		}
+		// The SVG is embedded as an image without the XML prolog, so nothing in it can run as a script
+		svg := base64.StdEncoding.EncodeToString([]byte(`<svg data-src="a -> b"></svg>`))
+		if !strings.Contains(htmlStr, `<img src="data:image/svg+xml;base64,`+svg+`" alt="fakediagram diagram">`) {
+			t.Errorf("Expected embedded SVG in HTML, got: %s", htmlStr)
+		}
+		if strings.Contains(htmlStr, "<svg") {
+			t.Errorf("Did not expect inlined SVG in HTML, got: %s", htmlStr)
+		}
+		if !strings.Contains(htmlStr, `<pre data-line-start="7" data-line-end="10"`) {
+			t.Errorf("Expected failing renderer to fall back to code block, got: %s", htmlStr)
+		}
+	}
+
+	for _, file := range []string{counterFile, failureFile} {
+		runs, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read counter file: %v", err)
+		}
+		if count := strings.Count(string(runs), "run"); count != 1 {
+			t.Errorf("Expected %s renderer to run once thanks to the cache, ran %d times", filepath.Base(file), count)
+		}
+	}
+}
+
+func TestBuildOutline(t *testing.T) {
+	markdown := "# Plan\n\nIntro\n\n## The `Rollout` step\n\nText\n\n### Details\n\nMore\n\nSetext\n------\n\nEnd\n"
+
+	outline := BuildOutline([]byte(markdown))
+	if len(outline) != 1 {
+		t.Fatalf("Expected 1 top-level item, got %d", len(outline))
+	}
+
+	root := outline[0]
+	if root.Title != "Plan" || root.ID != "plan" || root.LineStart != 1 || root.LineEnd != 16 {
+		t.Errorf("Unexpected root item: %+v", root)
+	}
+	if len(root.Children) != 2 {
+		t.Fatalf("Expected 2 children, got %d", len(root.Children))
+	}
+
+	rollout := root.Children[0]
+	if rollout.Title != "The Rollout step" || rollout.LineStart != 5 || rollout.LineEnd != 12 {
+		t.Errorf("Unexpected rollout item: %+v", rollout)
+	}
+	if len(rollout.Children) != 1 || rollout.Children[0].Title != "Details" {
+		t.Errorf("Expected Details nested under rollout, got %+v", rollout.Children)
+	}
+
+	setext := root.Children[1]
+	if setext.Title != "Setext" || setext.LineStart != 13 || setext.LineEnd != 16 {
+		t.Errorf("Unexpected setext item: %+v", setext)
+	}
+
+	if found := findOutlineSection(outline, "the rollout STEP"); found != rollout {
+		t.Errorf("Expected to find rollout section by title, got %+v", found)
+	}
+	if found := findOutlineSection(outline, "details"); found == nil || found.Title != "Details" {
+		t.Errorf("Expected to find nested section by ID, got %+v", found)
+	}
+	if found := findOutlineSection(outline, "Missing"); found != nil {
+		t.Errorf("Expected no section, got %+v", found)
+	}
+}
+
+func TestRelativeLinkResolution(t *testing.T) {
+	projectDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(projectDir, "design"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, "design", "DESIGN.md"), []byte("# Design"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+		notWant  string
+	}{
+		{
+			name:     "link to sibling directory",
+			markdown: "[see design](../design/DESIGN.md#goals)",
+			want:     `<a href="/projects` + projectDir + `/design/DESIGN.md#goals">`,
+			notWant:  "broken-link",
+		},
+		{
+			name:     "image in subdirectory",
+			markdown: "![diagram](img/arch%20v2.png)",
+			want:     `<img src="/projects` + projectDir + `/docs/img/arch%20v2.png"`,
+		},
+		{
+			name:     "missing markdown file is marked",
+			markdown: "[missing](NOPE.md)",
+			want:     `title="File not found: docs/NOPE.md" class="broken-link"`,
+		},
+		{
+			name:     "absolute URL is left alone",
+			markdown: "[site](https://example.com/a.md)",
+			want:     `<a href="https://example.com/a.md">`,
+		},
+		{
+			name:     "anchor is left alone",
+			markdown: "[top](#top)",
+			want:     `<a href="#top">`,
+		},
+		{
+			name:     "path escaping the project is left alone",
+			markdown: "[outside](../../secret.md)",
+			want:     `<a href="../../secret.md">`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := RenderMarkdownWithLineNumbers(
+				[]byte(tt.markdown),
+				WithDocumentPath(projectDir, "docs/PLAN.md"),
+			)
+			if err != nil {
+				t.Fatalf("RenderMarkdownWithLineNumbers failed: %v", err)
+			}
+
+			htmlStr := string(html)
+
+			if !strings.Contains(htmlStr, tt.want) {
+				t.Errorf("Expected %q in HTML, got: %s", tt.want, htmlStr)
+			}
+
+			if tt.notWant != "" && strings.Contains(htmlStr, tt.notWant) {
+				t.Errorf("Did not expect %q in HTML, got: %s", tt.notWant, htmlStr)
+			}
+		})
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	t.Run("yaml", func(t *testing.T) {
+		source := "---\nstatus: draft\nowner: alice\nreviewers: [bob, carol]\n---\n# Title\n"
+		fm, body := ParseFrontMatter([]byte(source))
+		if fm == nil {
+			t.Fatal("Expected front matter")
+		}
+		if fm.Format != "yaml" || fm.LineEnd != 5 {
+			t.Errorf("Unexpected front matter: %+v", fm)
+		}
+		if fm.Get("status") != "draft" || fm.Get("reviewers") != "bob, carol" {
+			t.Errorf("Unexpected fields: %v", fm.Fields)
+		}
+		if strings.Join(fm.keys, ",") != "status,owner,reviewers" {
+			t.Errorf("Expected keys in document order, got %v", fm.keys)
+		}
+		if string(body) != "\n\n\n\n\n# Title\n" {
+			t.Errorf("Expected front matter to be blanked out, got %q", body)
+		}
+	})
+
+	t.Run("toml", func(t *testing.T) {
+		source := "+++\nstatus = \"approved\"\nversion = 3\n+++\nBody\n"
+		fm, _ := ParseFrontMatter([]byte(source))
+		if fm == nil {
+			t.Fatal("Expected front matter")
+		}
+		if fm.Format != "toml" || fm.Get("status") != "approved" || fm.Get("version") != "3" {
+			t.Errorf("Unexpected front matter: %+v", fm)
+		}
+	})
+
+	t.Run("thematic break is not front matter", func(t *testing.T) {
+		source := "---\nJust a paragraph\n---\n"
+		fm, body := ParseFrontMatter([]byte(source))
+		if fm != nil {
+			t.Errorf("Did not expect front matter, got %+v", fm)
+		}
+		if string(body) != source {
+			t.Errorf("Expected source unchanged, got %q", body)
+		}
+	})
+
+	t.Run("rendered with correct body line numbers", func(t *testing.T) {
+		source := "---\nstatus: draft\n---\n\n# Title\n"
+		html, err := RenderMarkdownWithLineNumbers([]byte(source))
+		if err != nil {
+			t.Fatalf("RenderMarkdownWithLineNumbers failed: %v", err)
+		}
+		htmlStr := string(html)
+
+		for _, want := range []string{
+			`<div class="front-matter" data-line-start="1" data-line-end="3">`,
+			"<dt>status</dt><dd>draft</dd>",
+			`<h1 id="title" data-line-start="5" data-line-end="5">Title</h1>`,
+		} {
+			if !strings.Contains(htmlStr, want) {
+				t.Errorf("Expected %q in HTML, got: %s", want, htmlStr)
+			}
+		}
+		if strings.Contains(htmlStr, "<hr") {
+			t.Errorf("Did not expect front matter to render as a horizontal rule, got: %s", htmlStr)
+		}
+	})
+}
+
+func TestReadFrontMatter(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"yaml.md":     "---\nstatus: draft\n...\n" + strings.Repeat("Body text.\n", 10000),
+		"toml.md":     "+++\nstatus = \"approved\"\n+++",
+		"plain.md":    "# Title\n\nstatus: draft\n",
+		"unclosed.md": "---\nstatus: draft\n+++\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"yaml.md", "draft"},
+		{"toml.md", "approved"},
+		{"plain.md", ""},
+		{"unclosed.md", ""},
+		{"missing.md", ""},
+	}
+	for _, tt := range tests {
+		if got := readFrontMatter(filepath.Join(dir, tt.file)).Get("status"); got != tt.want {
+			t.Errorf("readFrontMatter(%s) status = %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
+
+// generateLargeDocument builds a document of roughly the given number of lines mixing
+// headings, paragraphs, lists and code blocks
+func generateLargeDocument(lines int) []byte {
+	var b strings.Builder
+	for section := 1; ; section++ {
+		fmt.Fprintf(&b, "## Section %d\n\n", section)
+		fmt.Fprintf(&b, "Paragraph with **bold**, `code` and a [link](other-%d.md).\n\n", section)
+		b.WriteString("- First item\n- Second item\n- Third item\n\n")
+		b.WriteString("```go\nfunc example() {\n\treturn\n}\n```\n\n")
+		if strings.Count(b.String(), "\n") >= lines {
+			return []byte(b.String())
+		}
+	}
+}
+
+func BenchmarkRenderDocument5kLines(b *testing.B) {
+	source := generateLargeDocument(5000)
+	cfg := renderConfig{documentPath: &documentPath{projectDir: b.TempDir(), filePath: "PLAN.md"}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := renderDocument(source, cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRenderMarkdownWithLineNumbersCached5kLines(b *testing.B) {
+	source := generateLargeDocument(5000)
+	projectDir := b.TempDir()
+	if _, err := RenderMarkdownWithLineNumbers(source, WithDocumentPath(projectDir, "PLAN.md")); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := RenderMarkdownWithLineNumbers(source, WithDocumentPath(projectDir, "PLAN.md")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuildOutline5kLines(b *testing.B) {
+	source := generateLargeDocument(5000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		BuildOutline(source)
+	}
+}
+
+func BenchmarkRenderComments(b *testing.B) {
+	comments := make([]Comment, 50)
+	for i := range comments {
+		comments[i].CommentText = fmt.Sprintf("Please *reword* item %d and add `an example`.", i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := renderCommentsAsHTML(comments); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,618 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mcpProtocolVersion is the Model Context Protocol revision implemented by the mcp command
+const mcpProtocolVersion = "2024-11-05"
+
+// mcpPollInterval is how often wait_for_feedback checks the database for new feedback
+const mcpPollInterval = time.Second
+
+// Timeouts of wait_for_feedback in seconds
+const (
+	mcpDefaultWaitSeconds = 300
+	mcpMaxWaitSeconds     = 1800
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	jsonrpcParseError     = -32700
+	jsonrpcMethodNotFound = -32601
+	jsonrpcInvalidParams  = -32602
+)
+
+type jsonrpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"` // Absent for notifications
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type jsonrpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *jsonrpcError   `json:"error,omitempty"`
+}
+
+type jsonrpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *jsonrpcError) Error() string {
+	return e.Message
+}
+
+// mcpTool is a tool exposed to MCP clients. The handler receives the raw tool arguments and returns a value that
+// is sent to the client as JSON; errors are reported as failed tool calls rather than protocol errors.
+type mcpTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+	handler     func(ctx context.Context, args json.RawMessage) (interface{}, error)
+}
+
+// mcpServer serves the review tools over stdio. Requests are handled concurrently so that a client can keep
+// talking to the server (or cancel) while wait_for_feedback blocks.
+type mcpServer struct {
+	projectDir string
+	agentID    string
+	tools      []mcpTool
+
+	out     io.Writer
+	outMu   sync.Mutex
+	pending map[string]context.CancelFunc
+	mu      sync.Mutex
+}
+
+func runMCP() {
+	cwd, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Initialize database
+	if err := initDB(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	s := newMCPServer(cwd, resolveAgentID(""), os.Stdout)
+	if err := s.serve(os.Stdin); err != nil {
+		log.Fatalf("MCP server failed: %v", err)
+	}
+}
+
+func newMCPServer(projectDir, agentID string, out io.Writer) *mcpServer {
+	s := &mcpServer{
+		projectDir: projectDir,
+		agentID:    agentID,
+		out:        out,
+		pending:    make(map[string]context.CancelFunc),
+	}
+	s.tools = s.reviewTools()
+	return s
+}
+
+// serve reads newline-delimited JSON-RPC messages until the input is closed. Requests still running then are
+// cancelled, as there is no one left to answer.
+func (s *mcpServer) serve(in io.Reader) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var req jsonrpcRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			s.write(jsonrpcResponse{
+				JSONRPC: "2.0",
+				ID:      json.RawMessage("null"),
+				Error:   &jsonrpcError{Code: jsonrpcParseError, Message: err.Error()},
+			})
+			continue
+		}
+
+		// Notifications get no response
+		if len(req.ID) == 0 {
+			if req.Method == "notifications/cancelled" {
+				var params struct {
+					RequestID json.RawMessage `json:"requestId"`
+				}
+				if json.Unmarshal(req.Params, &params) == nil {
+					s.cancel(string(params.RequestID))
+				}
+			}
+			continue
+		}
+
+		// Register the request before reading on, so a cancellation right behind it finds it
+		reqCtx, reqCancel := context.WithCancel(ctx)
+		s.mu.Lock()
+		s.pending[string(req.ID)] = reqCancel
+		s.mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handle(reqCtx, reqCancel, req)
+		}()
+	}
+	return scanner.Err()
+}
+
+func (s *mcpServer) handle(ctx context.Context, cancel context.CancelFunc, req jsonrpcRequest) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, string(req.ID))
+		s.mu.Unlock()
+		cancel()
+	}()
+
+	resp := jsonrpcResponse{JSONRPC: "2.0", ID: req.ID}
+	result, err := s.dispatch(ctx, req)
+	if err != nil {
+		var rpcErr *jsonrpcError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &jsonrpcError{Code: jsonrpcInvalidParams, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+	} else {
+		resp.Result = result
+	}
+
+	// A cancelled request must not be answered
+	if ctx.Err() != nil {
+		return
+	}
+	s.write(resp)
+}
+
+func (s *mcpServer) dispatch(ctx context.Context, req jsonrpcRequest) (interface{}, error) {
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": "claude-review", "version": Version},
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": s.tools}, nil
+	case "tools/call":
+		return s.callTool(ctx, req.Params)
+	default:
+		return nil, &jsonrpcError{Code: jsonrpcMethodNotFound, Message: "method not found: " + req.Method}
+	}
+}
+
+func (s *mcpServer) callTool(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var call struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &call); err != nil {
+		return nil, err
+	}
+	if len(call.Arguments) == 0 {
+		call.Arguments = json.RawMessage("{}")
+	}
+
+	for _, tool := range s.tools {
+		if tool.Name != call.Name {
+			continue
+		}
+
+		result, err := tool.handler(ctx, call.Arguments)
+		if err != nil {
+			return mcpToolResult(err.Error(), true), nil
+		}
+		text, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return mcpToolResult(string(text), false), nil
+	}
+
+	return nil, fmt.Errorf("unknown tool: %s", call.Name)
+}
+
+// mcpToolResult wraps the output of a tool call as text content
+func mcpToolResult(text string, isError bool) map[string]interface{} {
+	return map[string]interface{}{
+		"content": []map[string]string{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
+
+func (s *mcpServer) cancel(requestID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel, ok := s.pending[requestID]; ok {
+		cancel()
+	}
+}
+
+func (s *mcpServer) write(resp jsonrpcResponse) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Failed to marshal MCP response: %v", err)
+		return
+	}
+
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	if _, err := fmt.Fprintf(s.out, "%s\n", data); err != nil {
+		log.Printf("Failed to write MCP response: %v", err)
+	}
+}
+
+// mcpFileArgs are the arguments shared by the tools that operate on one file
+type mcpFileArgs struct {
+	FilePath         string `json:"file_path"`
+	ProjectDirectory string `json:"project_directory"`
+}
+
+// resolve applies the same defaults as the CLI: the server's working directory and no @ prefix
+func (a *mcpFileArgs) resolve(defaultProjectDir string) error {
+	if a.ProjectDirectory == "" || a.ProjectDirectory == "." {
+		a.ProjectDirectory = defaultProjectDir
+	}
+	a.FilePath = strings.TrimPrefix(a.FilePath, "@")
+	if a.FilePath == "" {
+		return errors.New("file_path is required")
+	}
+	return nil
+}
+
+// mcpFeedback is the result of wait_for_feedback
+type mcpFeedback struct {
+	Threads  []addressThread `json:"threads"`           // Unresolved threads where the reviewer spoke last
+	Verdict  *Verdict        `json:"verdict,omitempty"` // Latest verdict on the file
+	TimedOut bool            `json:"timed_out"`
+}
+
+// objectSchema builds the JSON schema of a tool's arguments
+func objectSchema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func schemaProperty(typ, description string) map[string]interface{} {
+	return map[string]interface{}{"type": typ, "description": description}
+}
+
+func (s *mcpServer) reviewTools() []mcpTool {
+	fileProperties := func(extra map[string]interface{}) map[string]interface{} {
+		properties := map[string]interface{}{
+			"file_path": schemaProperty("string", "Markdown file path relative to the project directory"),
+			"project_directory": schemaProperty("string",
+				"Absolute project directory (defaults to the directory the MCP server was started in)"),
+		}
+		for name, property := range extra {
+			properties[name] = property
+		}
+		return properties
+	}
+	agentIDProperty := schemaProperty("string", "Agent session ID to record (defaults to $"+agentIDEnvVar+")")
+
+	return []mcpTool{
+		{
+			Name: "list_threads",
+			Description: "List the review threads of a Markdown file with all of their messages. Only unresolved " +
+				"threads are listed unless include_resolved is set. Drafts the reviewer hasn't submitted are counted " +
+				"but not shown.",
+			InputSchema: objectSchema(fileProperties(map[string]interface{}{
+				"include_resolved": schemaProperty("boolean", "Also list resolved threads"),
+			}), "file_path"),
+			handler: s.listThreads,
+		},
+		{
+			Name:        "get_thread",
+			Description: "Get one review thread, by the ID of its root comment or of any reply.",
+			InputSchema: objectSchema(map[string]interface{}{
+				"comment_id": schemaProperty("integer", "Comment ID"),
+			}, "comment_id"),
+			handler: s.getThread,
+		},
+		{
+			Name:        "reply",
+			Description: "Reply to a review thread as the agent.",
+			InputSchema: objectSchema(map[string]interface{}{
+				"comment_id": schemaProperty("integer", "ID of the thread's root comment"),
+				"message":    schemaProperty("string", "Reply text (Markdown)"),
+				"agent_id":   agentIDProperty,
+			}, "comment_id", "message"),
+			handler: s.reply,
+		},
+		{
+			Name: "resolve",
+			Description: "Resolve a review thread by comment_id, or every unresolved thread of a file by " +
+				"file_path.",
+			InputSchema: objectSchema(fileProperties(map[string]interface{}{
+				"comment_id": schemaProperty("integer", "ID of any comment in the thread to resolve"),
+				"agent_id":   agentIDProperty,
+			})),
+			handler: s.resolve,
+		},
+		{
+			Name: "open_review",
+			Description: "Start the review server if needed, register the project and return the URL where the " +
+				"user can review the file.",
+			InputSchema: objectSchema(fileProperties(nil), "file_path"),
+			handler:     s.openReview,
+		},
+		{
+			Name: "wait_for_feedback",
+			Description: "Wait until the reviewer has spoken last in an unresolved thread of the file, or records a " +
+				"new verdict, and return those threads and the latest verdict. Returns immediately if there are " +
+				"threads awaiting a response already.",
+			InputSchema: objectSchema(fileProperties(map[string]interface{}{
+				"timeout_seconds": schemaProperty("integer",
+					fmt.Sprintf("How long to wait (default %d, at most %d)", mcpDefaultWaitSeconds, mcpMaxWaitSeconds)),
+			}), "file_path"),
+			handler: s.waitForFeedback,
+		},
+	}
+}
+
+func (s *mcpServer) listThreads(_ context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		mcpFileArgs
+		IncludeResolved bool `json:"include_resolved"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if err := args.resolve(s.projectDir); err != nil {
+		return nil, err
+	}
+
+	comments, err := getComments(args.ProjectDirectory, args.FilePath, false, false)
+	if err != nil {
+		return nil, err
+	}
+	if args.IncludeResolved {
+		resolved, err := getComments(args.ProjectDirectory, args.FilePath, true, false)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, resolved...)
+	}
+
+	drafts, err := countDrafts(args.ProjectDirectory, args.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return addressOutput{
+		ProjectDirectory: args.ProjectDirectory,
+		FilePath:         args.FilePath,
+		Drafts:           drafts,
+		Threads:          toAddressThreads(documentLevelFirst(groupCommentsByThread(comments))),
+	}, nil
+}
+
+func (s *mcpServer) getThread(_ context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		CommentID int `json:"comment_id"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	comment, err := getCommentByID(args.CommentID)
+	if err != nil {
+		return nil, err
+	}
+	if comment == nil || comment.Draft {
+		return nil, fmt.Errorf("comment %d not found", args.CommentID)
+	}
+	rootID := comment.ID
+	if comment.RootID != nil {
+		rootID = *comment.RootID
+	}
+
+	// A thread is resolved as a whole, so it's in one of the two lists
+	for _, resolved := range []bool{false, true} {
+		comments, err := getComments(comment.ProjectDirectory, comment.FilePath, resolved, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, thread := range toAddressThreads(groupCommentsByThread(comments)) {
+			if thread.ID == rootID {
+				return thread, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("comment %d not found", args.CommentID)
+}
+
+func (s *mcpServer) reply(_ context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		CommentID int    `json:"comment_id"`
+		Message   string `json:"message"`
+		AgentID   string `json:"agent_id"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(args.Message) == "" {
+		return nil, errors.New("message is required")
+	}
+	agentID, err := s.resolveAgentID(args.AgentID)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := addReply(args.CommentID, args.Message, "agent", "", agentID)
+	if errors.Is(err, errCommentNotFound) {
+		return nil, fmt.Errorf("comment %d not found", args.CommentID)
+	}
+	return reply, err
+}
+
+func (s *mcpServer) resolve(_ context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		mcpFileArgs
+		CommentID int    `json:"comment_id"`
+		AgentID   string `json:"agent_id"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	agentID, err := s.resolveAgentID(args.AgentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.CommentID != 0 {
+		rootID, count, err := resolveThreadOf(args.CommentID, "agent", agentID)
+		if errors.Is(err, errCommentNotFound) {
+			return nil, fmt.Errorf("comment %d not found", args.CommentID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return map[string]int{"thread_id": rootID, "resolved": count}, nil
+	}
+
+	if err := args.resolve(s.projectDir); err != nil {
+		return nil, errors.New("comment_id or file_path is required")
+	}
+	count, err := resolveComments(args.ProjectDirectory, args.FilePath, agentID)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		notifyServerCommentsChanged(args.ProjectDirectory, args.FilePath)
+	}
+	return map[string]int{"resolved": count}, nil
+}
+
+func (s *mcpServer) openReview(_ context.Context, raw json.RawMessage) (interface{}, error) {
+	var args mcpFileArgs
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if err := args.resolve(s.projectDir); err != nil {
+		return nil, err
+	}
+
+	// Anything written to stdout would corrupt the protocol stream, so starting the server is reported on stderr
+	reviewURL, err := openReview(args.ProjectDirectory, args.FilePath, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"url": reviewURL}, nil
+}
+
+func (s *mcpServer) waitForFeedback(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		mcpFileArgs
+		TimeoutSeconds int `json:"timeout_seconds"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if err := args.resolve(s.projectDir); err != nil {
+		return nil, err
+	}
+	if args.TimeoutSeconds <= 0 {
+		args.TimeoutSeconds = mcpDefaultWaitSeconds
+	}
+	if args.TimeoutSeconds > mcpMaxWaitSeconds {
+		args.TimeoutSeconds = mcpMaxWaitSeconds
+	}
+
+	initial, err := getVerdicts(args.ProjectDirectory, args.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.After(time.Duration(args.TimeoutSeconds) * time.Second)
+	ticker := time.NewTicker(mcpPollInterval)
+	defer ticker.Stop()
+
+	for {
+		feedback, err := pendingFeedback(args.ProjectDirectory, args.FilePath)
+		if err != nil {
+			return nil, err
+		}
+
+		verdicts, err := getVerdicts(args.ProjectDirectory, args.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		if len(verdicts) > 0 {
+			feedback.Verdict = &verdicts[len(verdicts)-1]
+		}
+
+		if len(feedback.Threads) > 0 || len(verdicts) > len(initial) {
+			return feedback, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline:
+			feedback.TimedOut = true
+			return feedback, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// pendingFeedback returns the unresolved threads of a file whose last message is from the reviewer
+func pendingFeedback(projectDir, filePath string) (*mcpFeedback, error) {
+	comments, err := getComments(projectDir, filePath, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	feedback := &mcpFeedback{Threads: []addressThread{}}
+	for _, thread := range toAddressThreads(documentLevelFirst(groupCommentsByThread(comments))) {
+		if thread.Messages[len(thread.Messages)-1].Author == "user" {
+			feedback.Threads = append(feedback.Threads, thread)
+		}
+	}
+	return feedback, nil
+}
+
+// resolveAgentID validates an agent session ID passed to a tool, falling back to the server's
+func (s *mcpServer) resolveAgentID(agentID string) (string, error) {
+	agentID = strings.TrimSpace(agentID)
+	if agentID == "" {
+		return s.agentID, nil
+	}
+	if len(agentID) > maxAuthorNameLength {
+		return "", fmt.Errorf("agent_id must be at most %d characters", maxAuthorNameLength)
+	}
+	return agentID, nil
+}
@@ -11,15 +11,24 @@ import (
 // notifyServerCommentsChanged sends a broadcast event to the server
 // to notify connected clients that comments have changed
 func notifyServerCommentsChanged(projectDir, filePath string) {
+	notifyServer(projectDir, filePath, "comments_resolved", 0)
+}
+
+// notifyServer asks a running server to broadcast an SSE event to the viewers of a file.
+// commentID is included in the event data when non-zero.
+func notifyServer(projectDir, filePath, event string, commentID int) {
 	port := os.Getenv("CR_LISTEN_PORT")
 	if port == "" {
 		port = "4779"
 	}
 
-	payload := map[string]string{
+	payload := map[string]interface{}{
 		"project_directory": projectDir,
 		"file_path":         filePath,
-		"event":             "comments_resolved",
+		"event":             event,
+	}
+	if commentID != 0 {
+		payload["comment_id"] = commentID
 	}
 
 	data, err := json.Marshal(payload)
@@ -0,0 +1,76 @@
+package main
+
+import "time"
+
+// ThreadProgress is what the reviewer is shown about the agent's work on an open thread
+type ThreadProgress struct {
+	ThreadID int           `json:"thread_id"`
+	Status   *ThreadStatus `json:"status,omitempty"`  // Left out once the reviewer wrote in the thread after it
+	Skipped  bool          `json:"skipped,omitempty"` // The agent reported on other threads but left this one alone
+}
+
+// summarizeProgress combines the statuses the agent reported with the unresolved, published comments of a file.
+// A status no longer applies once the reviewer writes in the thread after it. A thread counts as skipped when the
+// agent has finished reporting on other threads since the reviewer last wrote in it, without reporting on or replying
+// to the thread itself. Threads with nothing to show are left out.
+func summarizeProgress(comments []Comment, statuses map[int]ThreadStatus) []ThreadProgress {
+	threads := groupCommentsByThread(comments)
+
+	progress := make([]ThreadProgress, len(threads))
+	lastUserMessages := make([]time.Time, len(threads))
+	working := false
+	for i, thread := range threads {
+		for _, c := range thread {
+			if c.Author == "user" {
+				lastUserMessages[i] = c.CreatedAt
+			}
+		}
+
+		progress[i].ThreadID = thread[0].ID
+		if s, ok := statuses[thread[0].ID]; ok && !s.UpdatedAt.Before(lastUserMessages[i]) {
+			progress[i].Status = &s
+			working = working || s.State == threadWorking
+		}
+	}
+
+	// Threads can only have been skipped once the agent is done with its pass over the file
+	var lastReport time.Time
+	if !working {
+		for _, s := range statuses {
+			if s.UpdatedAt.After(lastReport) {
+				lastReport = s.UpdatedAt
+			}
+		}
+	}
+
+	var shown []ThreadProgress
+	for i, thread := range threads {
+		lastAuthor := thread[len(thread)-1].Author
+		if progress[i].Status == nil {
+			progress[i].Skipped = lastAuthor == "user" && lastReport.After(lastUserMessages[i])
+		}
+		if progress[i].Status != nil || progress[i].Skipped {
+			shown = append(shown, progress[i])
+		}
+	}
+
+	return shown
+}
+
+// getThreadProgress loads the comments and thread statuses of a file and summarizes the agent's progress
+func getThreadProgress(projectDir, filePath string) ([]ThreadProgress, error) {
+	comments, err := getComments(projectDir, filePath, false, false)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := getThreadStatuses(projectDir, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := summarizeProgress(comments, statuses)
+	if progress == nil {
+		progress = []ThreadProgress{}
+	}
+	return progress, nil
+}
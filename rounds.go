@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// RoundSummary describes what happened to the threads of a file during one review round. A round lasts from its
+// submission until the next round is submitted.
+type RoundSummary struct {
+	Round       int       `json:"round"`
+	SubmittedAt time.Time `json:"submitted_at"`
+	AuthorName  string    `json:"author_name,omitempty"`
+	Opened      []int     `json:"opened"`   // Threads started in this round
+	Answered    []int     `json:"answered"` // Threads the agent replied to during this round
+	Resolved    []int     `json:"resolved"` // Threads resolved during this round
+}
+
+// summarizeRounds attributes threads to the review rounds of a file. comments must include both resolved and
+// unresolved comments, but no drafts. Threads started outside of a review (comments published without a draft)
+// count as opened in the round that was in progress at the time, if any.
+func summarizeRounds(rounds []ReviewRound, comments []Comment) []RoundSummary {
+	summaries := make([]RoundSummary, len(rounds))
+	for i, r := range rounds {
+		summaries[i] = RoundSummary{
+			Round:       r.Round,
+			SubmittedAt: r.SubmittedAt,
+			AuthorName:  r.AuthorName,
+			Opened:      []int{},
+			Answered:    []int{},
+			Resolved:    []int{},
+		}
+	}
+
+	// roundAt returns the index of the round in progress at the given time, or -1 before the first round
+	roundAt := func(t time.Time) int {
+		return sort.Search(len(rounds), func(i int) bool { return rounds[i].SubmittedAt.After(t) }) - 1
+	}
+	roundIndex := make(map[int]int, len(rounds))
+	for i, r := range rounds {
+		roundIndex[r.Round] = i
+	}
+
+	answered := make(map[[2]int]bool)
+	for _, c := range comments {
+		if c.RootID == nil {
+			i := -1
+			if c.ReviewRound != nil {
+				if index, ok := roundIndex[*c.ReviewRound]; ok {
+					i = index
+				}
+			} else {
+				i = roundAt(c.CreatedAt)
+			}
+			if i >= 0 {
+				summaries[i].Opened = append(summaries[i].Opened, c.ID)
+			}
+
+			if c.ResolvedAt != nil {
+				if i := roundAt(*c.ResolvedAt); i >= 0 {
+					summaries[i].Resolved = append(summaries[i].Resolved, c.ID)
+				}
+			}
+			continue
+		}
+
+		if c.Author == "agent" {
+			i := roundAt(c.CreatedAt)
+			if i >= 0 && !answered[[2]int{i, *c.RootID}] {
+				answered[[2]int{i, *c.RootID}] = true
+				summaries[i].Answered = append(summaries[i].Answered, *c.RootID)
+			}
+		}
+	}
+
+	for i := range summaries {
+		sort.Ints(summaries[i].Opened)
+		sort.Ints(summaries[i].Answered)
+		sort.Ints(summaries[i].Resolved)
+	}
+
+	return summaries
+}
+
+// getRoundSummaries loads the review rounds of a file and summarizes each of them
+func getRoundSummaries(projectDir, filePath string) ([]RoundSummary, error) {
+	rounds, err := getReviewRounds(projectDir, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	unresolved, err := getComments(projectDir, filePath, false, false)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := getComments(projectDir, filePath, true, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return summarizeRounds(rounds, append(unresolved, resolved...)), nil
+}
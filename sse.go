@@ -81,15 +81,17 @@ func handleSSE(w http.ResponseWriter, r *http.Request) {
 	// Setup file watcher for this file
 	if fileWatcher != nil {
 		if err := fileWatcher.watchFile(projectDir, filePath, func() {
-			sseHub.broadcast(projectDir, filePath, "file_updated", map[string]string{
+			renderCache.invalidate(projectDir, filePath)
+			publishEvent(projectDir, filePath, "file_updated", map[string]string{
 				"file_path": filePath,
 			})
 		}); err != nil {
 			log.Printf("Failed to watch file: %v", err)
+		} else {
+			defer func() {
+				_ = fileWatcher.unwatchFile(projectDir, filePath)
+			}()
 		}
-		defer func() {
-			_ = fileWatcher.unwatchFile(projectDir, filePath)
-		}()
 	}
 
 	// Send initial connection message
@@ -121,6 +123,7 @@ func handleBroadcast(w http.ResponseWriter, r *http.Request) {
 		ProjectDirectory string `json:"project_directory"`
 		FilePath         string `json:"file_path"`
 		Event            string `json:"event"`
+		CommentID        int    `json:"comment_id,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -128,9 +131,13 @@ func handleBroadcast(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sseHub.broadcast(req.ProjectDirectory, req.FilePath, req.Event, map[string]string{
+	data := map[string]interface{}{
 		"file_path": req.FilePath,
-	})
+	}
+	if req.CommentID != 0 {
+		data["comment_id"] = req.CommentID
+	}
+	publishEvent(req.ProjectDirectory, req.FilePath, req.Event, data)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]string{"status": "broadcast"}); err != nil {
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+)
+
+// terminal puts the controlling terminal into raw mode for a full-screen interface and restores it afterwards.
+// It goes through stty rather than terminal ioctls, which differ between platforms.
+type terminal struct {
+	saved string // Terminal settings from before raw mode, as printed by stty -g
+}
+
+// isTerminal reports whether a file is connected to a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// stty runs stty on the terminal connected to standard input
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	return strings.TrimSpace(string(output)), err
+}
+
+// openTerminal switches to raw mode and the alternate screen
+func openTerminal() (*terminal, error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read terminal settings: %w", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("failed to switch terminal to raw mode: %w", err)
+	}
+
+	// Alternate screen, hidden cursor
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	return &terminal{saved: saved}, nil
+}
+
+// close leaves the alternate screen and restores the terminal settings
+func (t *terminal) close() {
+	fmt.Print("\x1b[?25h\x1b[?1049l")
+	_, _ = stty(t.saved)
+}
+
+// size returns the number of columns and rows of the terminal
+func (t *terminal) size() (int, int) {
+	output, err := stty("size")
+	var rows, cols int
+	if err == nil {
+		_, err = fmt.Sscanf(output, "%d %d", &rows, &cols)
+	}
+	if err != nil || rows <= 0 || cols <= 0 {
+		return 80, 24
+	}
+	return cols, rows
+}
+
+// escapeKeys maps the escape sequences of special keys to their names
+var escapeKeys = map[string]string{
+	"[A": "up", "[B": "down", "[C": "right", "[D": "left",
+	"OA": "up", "OB": "down", "OC": "right", "OD": "left",
+	"[H": "home", "[F": "end", "OH": "home", "OF": "end",
+	"[1~": "home", "[4~": "end", "[7~": "home", "[8~": "end",
+	"[5~": "pgup", "[6~": "pgdown", "[3~": "delete",
+}
+
+// parseKeys splits what was read from a raw terminal into keys. Printable characters are returned as themselves and
+// other keys by name, e.g. "enter", "up" or "ctrl-c". Unknown escape sequences are dropped.
+func parseKeys(input []byte) []string {
+	var keys []string
+	for len(input) > 0 {
+		switch b := input[0]; {
+		case b == 0x1b:
+			// Escape on its own, or followed by an ordinary key as sent by alt combinations
+			if len(input) == 1 || (input[1] != '[' && input[1] != 'O') {
+				keys = append(keys, "esc")
+				input = input[1:]
+				continue
+			}
+			// A sequence ends at the first letter or ~ after its introducer
+			end := 2
+			for end < len(input) && !isSequenceEnd(input[end]) {
+				end++
+			}
+			if end < len(input) {
+				end++
+			}
+			if key, ok := escapeKeys[string(input[1:end])]; ok {
+				keys = append(keys, key)
+			}
+			input = input[end:]
+		case b == '\r' || b == '\n':
+			keys = append(keys, "enter")
+			input = input[1:]
+		case b == 0x7f || b == 0x08:
+			keys = append(keys, "backspace")
+			input = input[1:]
+		case b == '\t':
+			keys = append(keys, "tab")
+			input = input[1:]
+		case b < 0x20:
+			keys = append(keys, "ctrl-"+string(rune('a'+b-1)))
+			input = input[1:]
+		default:
+			r, size := utf8.DecodeRune(input)
+			if r != utf8.RuneError {
+				keys = append(keys, string(r))
+			}
+			input = input[size:]
+		}
+	}
+	return keys
+}
+
+func isSequenceEnd(b byte) bool {
+	return b == '~' || (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z')
+}
@@ -0,0 +1,746 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// Actions the reviewer can take in the terminal UI
+const (
+	tuiComment = "comment"
+	tuiReply   = "reply"
+	tuiResolve = "resolve"
+	tuiQuit    = "quit"
+)
+
+// tuiHelp is shown in the status line when there is nothing else to show
+const tuiHelp = "j/k move · v select · c comment · C whole document · n/N threads · r reply · x resolve · q quit"
+
+// tuiAction is a change to the review asked for in the terminal UI
+type tuiAction struct {
+	Kind      string
+	LineStart int // Lines of a new comment, 0 for a comment on the whole document
+	LineEnd   int
+	ThreadID  int // Thread to reply to or resolve
+	Message   string
+}
+
+// tuiInput is a message being written in the status line. Its action is completed with the message on enter.
+type tuiInput struct {
+	prompt string
+	text   []rune
+	action tuiAction
+}
+
+// tuiModel is the state of the terminal UI. It doesn't touch the terminal or the database, so that key handling and
+// rendering can be tested on their own.
+type tuiModel struct {
+	filePath string
+	lines    []string
+	threads  [][]Comment // Unresolved threads, those on the whole document first, then by line
+	progress map[int]ThreadProgress
+
+	width, height int
+	cursor        int // Line under the cursor, counting from 0
+	top           int // First line on screen
+	anchor        int // Other end of the selected lines, -1 without a selection
+	thread        int // Index of the thread shown in the thread panel, -1 for none
+	threadScroll  int // First line of the thread panel's content on screen
+
+	input      *tuiInput
+	confirming *tuiAction // Waiting for a yes before it's carried out
+	status     string     // Outcome of the last action, shown instead of the help
+	live       bool       // Whether updates are streamed from the server
+}
+
+func newTUIModel(filePath string) *tuiModel {
+	return &tuiModel{filePath: filePath, width: 80, height: 24, anchor: -1, thread: -1}
+}
+
+// setData replaces the document and its threads, keeping the cursor and the thread on screen where possible
+func (m *tuiModel) setData(lines []string, comments []Comment, progress []ThreadProgress) {
+	var selectedID int
+	if thread := m.selectedThread(); thread != nil {
+		selectedID = thread[0].ID
+	}
+
+	m.lines = lines
+	m.threads = groupCommentsByThread(comments)
+	sort.SliceStable(m.threads, func(i, j int) bool {
+		return threadLine(m.threads[i]) < threadLine(m.threads[j])
+	})
+	m.progress = make(map[int]ThreadProgress)
+	for _, p := range progress {
+		m.progress[p.ThreadID] = p
+	}
+
+	m.cursor = max(0, min(m.cursor, len(m.lines)-1))
+	if m.anchor >= len(m.lines) {
+		m.anchor = -1
+	}
+	m.thread = -1
+	for i, thread := range m.threads {
+		if thread[0].ID == selectedID {
+			m.thread = i
+		}
+	}
+	// Otherwise show a thread under the cursor, such as one that was just started there
+	if m.thread < 0 {
+		m.moveCursor(0)
+	}
+}
+
+// threadLine returns the first line of a thread's selection, or 0 for a thread on the whole document
+func threadLine(thread []Comment) int {
+	if thread[0].LineStart == nil {
+		return 0
+	}
+	return *thread[0].LineStart
+}
+
+// threadCovers reports whether a thread's selection includes a line, counting from 0
+func threadCovers(thread []Comment, line int) bool {
+	root := thread[0]
+	return root.LineStart != nil && root.LineEnd != nil && *root.LineStart-1 <= line && line <= *root.LineEnd-1
+}
+
+func (m *tuiModel) selectedThread() []Comment {
+	if m.thread < 0 || m.thread >= len(m.threads) {
+		return nil
+	}
+	return m.threads[m.thread]
+}
+
+// selection returns the selected lines, or the line under the cursor, counting from 1
+func (m *tuiModel) selection() (int, int) {
+	if m.anchor < 0 {
+		return m.cursor + 1, m.cursor + 1
+	}
+	return min(m.anchor, m.cursor) + 1, max(m.anchor, m.cursor) + 1
+}
+
+// layout returns the number of rows for the document and for the thread panel, including its title
+func (m *tuiModel) layout() (int, int) {
+	body := m.height - 2 // Header and status line
+	if m.selectedThread() == nil || body < 8 {
+		return max(body, 0), 0
+	}
+	panel := max(body*2/5, 4)
+	return body - panel, panel
+}
+
+// handleKey updates the model for a key and returns the action it asks for, if any
+func (m *tuiModel) handleKey(key string) *tuiAction {
+	if m.input != nil {
+		return m.handleInputKey(key)
+	}
+	if m.confirming != nil {
+		action := m.confirming
+		m.confirming = nil
+		m.status = ""
+		if key == "y" || key == "Y" {
+			return action
+		}
+		return nil
+	}
+
+	m.status = ""
+	sourceRows, _ := m.layout()
+	switch key {
+	case "q", "ctrl-c":
+		return &tuiAction{Kind: tuiQuit}
+	case "j", "down":
+		m.moveCursor(1)
+	case "k", "up":
+		m.moveCursor(-1)
+	case "pgdown", "ctrl-f", " ":
+		m.moveCursor(max(sourceRows-1, 1))
+	case "pgup", "ctrl-b":
+		m.moveCursor(-max(sourceRows-1, 1))
+	case "g", "home":
+		m.moveCursor(-len(m.lines))
+	case "G", "end":
+		m.moveCursor(len(m.lines))
+	case "v":
+		if m.anchor < 0 {
+			m.anchor = m.cursor
+		} else {
+			m.anchor = -1
+		}
+	case "esc":
+		m.anchor = -1
+	case "c":
+		if len(m.lines) == 0 {
+			return nil
+		}
+		start, end := m.selection()
+		m.input = &tuiInput{
+			prompt: fmt.Sprintf("Comment on %s: ", formatLineRange(start, end)),
+			action: tuiAction{Kind: tuiComment, LineStart: start, LineEnd: end},
+		}
+	case "C":
+		m.input = &tuiInput{prompt: "Comment on the whole document: ", action: tuiAction{Kind: tuiComment}}
+	case "n", "tab":
+		m.selectThread(m.thread + 1)
+	case "N", "p":
+		m.selectThread(m.thread - 1)
+	case "enter":
+		m.selectThreadAtCursor()
+	case "r":
+		if thread := m.requireThread(); thread != nil {
+			m.input = &tuiInput{
+				prompt: fmt.Sprintf("Reply to #%d: ", thread[0].ID),
+				action: tuiAction{Kind: tuiReply, ThreadID: thread[0].ID},
+			}
+		}
+	case "x":
+		if thread := m.requireThread(); thread != nil {
+			m.confirming = &tuiAction{Kind: tuiResolve, ThreadID: thread[0].ID}
+			m.status = fmt.Sprintf("Resolve thread #%d? (y/n)", thread[0].ID)
+		}
+	case "J":
+		m.threadScroll++
+	case "K":
+		m.threadScroll = max(m.threadScroll-1, 0)
+	}
+	return nil
+}
+
+// handleInputKey edits the message being written, returning its action when it's submitted
+func (m *tuiModel) handleInputKey(key string) *tuiAction {
+	switch key {
+	case "esc", "ctrl-c":
+		m.input = nil
+	case "enter":
+		message := strings.TrimSpace(string(m.input.text))
+		action := m.input.action
+		m.input = nil
+		if message == "" {
+			return nil
+		}
+		if action.Kind == tuiComment {
+			m.anchor = -1
+		}
+		action.Message = message
+		return &action
+	case "backspace":
+		if len(m.input.text) > 0 {
+			m.input.text = m.input.text[:len(m.input.text)-1]
+		}
+	case "ctrl-u":
+		m.input.text = nil
+	default:
+		// Named keys such as "up" have no place in a message
+		if utf8.RuneCountInString(key) == 1 {
+			m.input.text = append(m.input.text, []rune(key)...)
+		}
+	}
+	return nil
+}
+
+// moveCursor moves the cursor by delta lines and shows the thread on the new line, if there is one
+func (m *tuiModel) moveCursor(delta int) {
+	m.cursor = max(0, min(m.cursor+delta, len(m.lines)-1))
+	if thread := m.selectedThread(); thread != nil && threadCovers(thread, m.cursor) {
+		return
+	}
+	m.thread = -1
+	for i, thread := range m.threads {
+		if threadCovers(thread, m.cursor) {
+			m.thread = i
+			m.threadScroll = 0
+			break
+		}
+	}
+}
+
+// selectThread shows the i-th thread, wrapping around, and moves the cursor to its selection
+func (m *tuiModel) selectThread(i int) {
+	if len(m.threads) == 0 {
+		m.status = "No open threads"
+		return
+	}
+	m.thread = (i%len(m.threads) + len(m.threads)) % len(m.threads)
+	m.threadScroll = 0
+	if line := threadLine(m.threads[m.thread]); line > 0 {
+		m.cursor = min(line-1, max(len(m.lines)-1, 0))
+	}
+}
+
+// selectThreadAtCursor cycles through the threads on the line under the cursor
+func (m *tuiModel) selectThreadAtCursor() {
+	var covering []int
+	for i, thread := range m.threads {
+		if threadCovers(thread, m.cursor) {
+			covering = append(covering, i)
+		}
+	}
+	if len(covering) == 0 {
+		m.status = "No thread on this line"
+		return
+	}
+	next := covering[0]
+	for _, i := range covering {
+		if i > m.thread {
+			next = i
+			break
+		}
+	}
+	m.thread = next
+	m.threadScroll = 0
+}
+
+func (m *tuiModel) requireThread() []Comment {
+	thread := m.selectedThread()
+	if thread == nil {
+		m.status = "No thread selected: press n, or enter on a marked line"
+	}
+	return thread
+}
+
+// render draws the whole screen
+func (m *tuiModel) render() string {
+	sourceRows, panelRows := m.layout()
+
+	// Keep the cursor on screen
+	if m.cursor < m.top {
+		m.top = m.cursor
+	}
+	if m.cursor >= m.top+sourceRows {
+		m.top = m.cursor - sourceRows + 1
+	}
+
+	rows := []string{m.renderHeader()}
+	rows = append(rows, m.renderSource(sourceRows)...)
+	if panelRows > 0 {
+		rows = append(rows, m.renderThread(panelRows)...)
+	}
+	rows = append(rows, m.renderStatus())
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, row := range rows {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(row)
+		b.WriteString("\x1b[0m\x1b[K")
+	}
+	b.WriteString("\x1b[J")
+	return b.String()
+}
+
+func (m *tuiModel) renderHeader() string {
+	var documentThreads int
+	for _, thread := range m.threads {
+		if thread[0].IsDocumentLevel() {
+			documentThreads++
+		}
+	}
+	summary := fmt.Sprintf("%d open thread(s)", len(m.threads))
+	if documentThreads > 0 {
+		summary += fmt.Sprintf(", %d on the whole document", documentThreads)
+	}
+	connection := "live"
+	if !m.live {
+		connection = "offline"
+	}
+	header := fmt.Sprintf(" claude-review · %s · %s · %s", m.filePath, summary, connection)
+	return "\x1b[7m" + fitWidth(header, m.width)
+}
+
+func (m *tuiModel) renderSource(rows int) []string {
+	numberWidth := len(strconv.Itoa(len(m.lines)))
+	textWidth := max(m.width-numberWidth-5, 1)
+	selStart, selEnd := -1, -1
+	if m.anchor >= 0 {
+		selStart, selEnd = m.selection()
+		selStart, selEnd = selStart-1, selEnd-1
+	}
+	selected := m.selectedThread()
+
+	out := make([]string, 0, rows)
+	for i := m.top; i < m.top+rows; i++ {
+		if i >= len(m.lines) {
+			out = append(out, "\x1b[2m~")
+			continue
+		}
+
+		number := fmt.Sprintf("%*d", numberWidth, i+1)
+		if selected != nil && threadCovers(selected, i) {
+			number = "\x1b[1;33m" + number + "\x1b[0m"
+		}
+		text := truncateWidth(displayText(m.lines[i]), textWidth)
+		switch {
+		case i == m.cursor:
+			text = "\x1b[7m" + fitWidth(text, textWidth)
+		case i >= selStart && i <= selEnd:
+			text = "\x1b[44;37m" + fitWidth(text, textWidth)
+		}
+		out = append(out, fmt.Sprintf("%s %s │ %s", m.marker(i), number, text))
+	}
+	return out
+}
+
+// marker returns the gutter marker of a line: ? for an unanswered question from the agent, a green dot where the agent
+// answered last and a yellow dot where the agent has yet to answer
+func (m *tuiModel) marker(line int) string {
+	marker := " "
+	for _, thread := range m.threads {
+		if !threadCovers(thread, line) {
+			continue
+		}
+		switch last := thread[len(thread)-1]; {
+		case len(thread) == 1 && last.Author == "agent":
+			return "\x1b[35m?\x1b[0m"
+		case last.Author == "agent":
+			marker = "\x1b[32m●\x1b[0m"
+		case marker == " ":
+			marker = "\x1b[33m●\x1b[0m"
+		}
+	}
+	return marker
+}
+
+func (m *tuiModel) renderThread(rows int) []string {
+	thread := m.selectedThread()
+	root := thread[0]
+
+	where := "whole document"
+	if root.LineStart != nil && root.LineEnd != nil {
+		where = formatLineRange(*root.LineStart, *root.LineEnd)
+	}
+	title := fmt.Sprintf("── Thread #%d · %s · %d/%d ", root.ID, where, m.thread+1, len(m.threads))
+	title += strings.Repeat("─", max(m.width-utf8.RuneCountInString(title), 0))
+
+	width := max(m.width-2, 10)
+	var content []string
+	for _, line := range wrapText(root.SelectedText, width-2) {
+		content = append(content, "\x1b[2m> "+line+"\x1b[0m")
+	}
+	if p, ok := m.progress[root.ID]; ok {
+		content = append(content, "\x1b[36m"+progressLabel(p)+"\x1b[0m")
+	}
+	for _, c := range thread {
+		content = append(content, "", "\x1b[1m"+displayText(authorDisplayName(c))+editedMarker(c)+":\x1b[0m")
+		for _, line := range wrapText(c.CommentText, width) {
+			content = append(content, "  "+line)
+		}
+	}
+
+	visible := rows - 1
+	m.threadScroll = max(0, min(m.threadScroll, len(content)-visible))
+	end := min(m.threadScroll+visible, len(content))
+	out := append([]string{"\x1b[2m" + truncateWidth(title, m.width)}, content[m.threadScroll:end]...)
+	if end < len(content) {
+		out[len(out)-1] = "\x1b[2m  … J/K to scroll"
+	}
+	for len(out) < rows {
+		out = append(out, "")
+	}
+	return out
+}
+
+// progressLabel describes what the agent reported about a thread
+func progressLabel(p ThreadProgress) string {
+	if p.Status == nil {
+		return "Skipped by the agent"
+	}
+	label := map[string]string{
+		threadWorking: "Agent is working on this",
+		threadDone:    "Agent is done with this",
+		threadBlocked: "Agent is blocked",
+	}[p.Status.State]
+	if p.Status.Note != "" {
+		label += ": " + displayText(p.Status.Note)
+	}
+	return label
+}
+
+func (m *tuiModel) renderStatus() string {
+	if m.input != nil {
+		prompt := "\x1b[1m" + m.input.prompt + "\x1b[0m"
+		text := []rune(displayText(string(m.input.text)))
+		// Keep the end of a long message in view
+		room := max(m.width-utf8.RuneCountInString(m.input.prompt)-1, 1)
+		if len(text) > room {
+			text = text[len(text)-room:]
+		}
+		return prompt + string(text) + "\x1b[7m \x1b[0m"
+	}
+	if m.status != "" {
+		return "\x1b[1m" + truncateWidth(displayText(m.status), m.width)
+	}
+	return "\x1b[2m" + truncateWidth(tuiHelp, m.width)
+}
+
+// formatLineRange describes lines of a document, e.g. "line 3" or "lines 3-5"
+func formatLineRange(start, end int) string {
+	if start == end {
+		return fmt.Sprintf("line %d", start)
+	}
+	return fmt.Sprintf("lines %d-%d", start, end)
+}
+
+// displayText makes text safe to print on a terminal: tabs are expanded and other control characters replaced
+func displayText(s string) string {
+	s = strings.ReplaceAll(s, "\t", "    ")
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// truncateWidth cuts a line to at most width characters
+func truncateWidth(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
+
+// fitWidth cuts or pads a line to exactly width characters
+func fitWidth(s string, width int) string {
+	s = truncateWidth(s, width)
+	return s + strings.Repeat(" ", width-utf8.RuneCountInString(s))
+}
+
+// wrapText breaks text into lines of at most width characters, at spaces where possible
+func wrapText(text string, width int) []string {
+	if text == "" {
+		return nil
+	}
+	var lines []string
+	for _, paragraph := range strings.Split(displayTextLines(text), "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for utf8.RuneCountInString(word) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				runes := []rune(word)
+				lines = append(lines, string(runes[:width]))
+				word = string(runes[width:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// displayTextLines is displayText for text with line breaks, which are kept
+func displayTextLines(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = displayText(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func runTUI() {
+	// Parse flags
+	tuiCmd := flag.NewFlagSet("tui", flag.ExitOnError)
+	projectDir := tuiCmd.String("project", "", "Project directory")
+	filePath := tuiCmd.String("file", "", "File path relative to project directory")
+	name := tuiCmd.String("name", "", "Reviewer name shown with your comments")
+
+	if err := tuiCmd.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+	*projectDir, *filePath = resolveFileFlags(*projectDir, *filePath)
+	authorName := resolveReviewerName(*name)
+
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		fmt.Println("Error: tui needs an interactive terminal")
+		os.Exit(1)
+	}
+	if _, err := os.Stat(filepath.Join(*projectDir, *filePath)); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// The server streams review activity to the terminal UI as it does to the browser
+	reviewURL, err := openReview(*projectDir, *filePath, os.Stdout)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	term, err := openTerminal()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer term.close()
+	// Log output would garble the screen
+	log.SetOutput(io.Discard)
+
+	m := newTUIModel(*filePath)
+	m.width, m.height = term.size()
+	m.status = "Also open in the browser at " + reviewURL
+
+	load := func() {
+		lines, comments, progress, err := loadTUIData(*projectDir, *filePath)
+		if err != nil {
+			m.status = "Failed to load the review: " + err.Error()
+			return
+		}
+		m.setData(lines, comments, progress)
+	}
+	load()
+
+	keys := make(chan string, 64)
+	go readKeys(keys)
+	events := make(chan string, 16)
+	go followEvents(*projectDir, *filePath, events)
+	resize := make(chan os.Signal, 1)
+	signal.Notify(resize, syscall.SIGWINCH)
+
+	for {
+		fmt.Print(m.render())
+
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				return
+			}
+			action := m.handleKey(key)
+			if action == nil {
+				continue
+			}
+			if action.Kind == tuiQuit {
+				return
+			}
+			m.status = performTUIAction(*action, *projectDir, *filePath, authorName)
+			load()
+		case event := <-events:
+			switch event {
+			case "connected":
+				m.live = true
+			case "disconnected":
+				m.live = false
+			case "file_updated":
+				m.status = "The file changed on disk"
+				load()
+			default:
+				load()
+			}
+		case <-resize:
+			m.width, m.height = term.size()
+		}
+	}
+}
+
+// loadTUIData reads a document with its unresolved threads and the agent's progress on them
+func loadTUIData(projectDir, filePath string) ([]string, []Comment, []ThreadProgress, error) {
+	content, err := os.ReadFile(filepath.Join(projectDir, filePath))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	comments, err := getComments(projectDir, filePath, false, false)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	progress, err := getThreadProgress(projectDir, filePath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	text := strings.TrimSuffix(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	return strings.Split(text, "\n"), comments, progress, nil
+}
+
+// performTUIAction carries out a change made in the terminal UI and describes the outcome
+func performTUIAction(action tuiAction, projectDir, filePath, authorName string) string {
+	switch action.Kind {
+	case tuiComment:
+		var lines string
+		if action.LineStart > 0 {
+			lines = fmt.Sprintf("%d-%d", action.LineStart, action.LineEnd)
+		}
+		comment, err := createUserComment(projectDir, filePath, lines, "", action.Message, authorName)
+		if err != nil {
+			return "Error: " + err.Error()
+		}
+		return fmt.Sprintf("Comment #%d added", comment.ID)
+
+	case tuiReply:
+		reply, err := addReply(action.ThreadID, action.Message, "user", authorName, "")
+		if err != nil {
+			return "Failed to reply: " + err.Error()
+		}
+		return fmt.Sprintf("Reply #%d added to thread #%d", reply.ID, action.ThreadID)
+
+	case tuiResolve:
+		if _, _, err := resolveThreadOf(action.ThreadID, "user", ""); err != nil {
+			return "Failed to resolve thread: " + err.Error()
+		}
+		return fmt.Sprintf("Thread #%d resolved", action.ThreadID)
+	}
+	return ""
+}
+
+// readKeys sends the keys typed on standard input until it's closed
+func readKeys(keys chan<- string) {
+	buf := make([]byte, 256)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			close(keys)
+			return
+		}
+		for _, key := range parseKeys(buf[:n]) {
+			keys <- key
+		}
+	}
+}
+
+// followEvents streams the review activity on a file from the server, reconnecting whenever the stream ends. Besides
+// the server's events it sends "disconnected" when the stream is lost.
+func followEvents(projectDir, filePath string, events chan<- string) {
+	port := os.Getenv("CR_LISTEN_PORT")
+	if port == "" {
+		port = "4779"
+	}
+	streamURL := fmt.Sprintf("http://localhost:%s/api/events?project_directory=%s&file_path=%s", port,
+		url.QueryEscape(projectDir), url.QueryEscape(filePath))
+
+	for {
+		resp, err := http.Get(streamURL)
+		if err == nil {
+			scanner := bufio.NewScanner(resp.Body)
+			for resp.StatusCode == http.StatusOK && scanner.Scan() {
+				if event, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+					events <- event
+				}
+			}
+			_ = resp.Body.Close()
+			events <- "disconnected"
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ansiEscape matches the escape sequences the terminal UI uses for colors and cursor movement
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"printable", "jk é", []string{"j", "k", " ", "é"}},
+		{"arrows", "\x1b[A\x1b[B\x1bOA", []string{"up", "down", "up"}},
+		{"paging", "\x1b[5~\x1b[6~", []string{"pgup", "pgdown"}},
+		{"control", "\r\x7f\x03\t", []string{"enter", "backspace", "ctrl-c", "tab"}},
+		{"escape on its own", "\x1b", []string{"esc"}},
+		{"escape before a key", "\x1bq", []string{"esc", "q"}},
+		{"unknown sequence", "\x1b[99zj", []string{"j"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseKeys([]byte(tt.input)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseKeys(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	got := wrapText("The quick brown fox\n\njumps over supercalifragilistic", 10)
+	want := []string{"The quick", "brown fox", "", "jumps over", "supercalif", "ragilistic"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrapText() = %q, want %q", got, want)
+	}
+}
+
+// newTestTUI returns a terminal UI showing a document with a thread on lines 3-4, answered by the agent, a question
+// from the agent on line 6 and a thread on the whole document
+func newTestTUI() *tuiModel {
+	line := func(n int) *int { return &n }
+	root := 1
+	comments := []Comment{
+		{ID: 1, LineStart: line(3), LineEnd: line(4), SelectedText: "Third", CommentText: "Fix this", Author: "user"},
+		{ID: 2, RootID: &root, CommentText: "Fixed", Author: "agent", CreatedAt: time.Now()},
+		{ID: 3, LineStart: line(6), LineEnd: line(6), SelectedText: "Sixth", CommentText: "Why?", Author: "agent"},
+		{ID: 4, CommentText: "Shorter please", Author: "user"},
+	}
+	lines := []string{"# Title", "", "Third line", "Fourth line", "", "Sixth line"}
+
+	m := newTUIModel("doc.md")
+	m.setData(lines, comments, []ThreadProgress{{ThreadID: 4, Skipped: true}})
+	return m
+}
+
+func TestTUIModel(t *testing.T) {
+	t.Run("gutter shows threads", func(t *testing.T) {
+		m := newTestTUI()
+		screen := ansiEscape.ReplaceAllString(m.render(), "")
+		for _, want := range []string{"● 3 │ Third line", "● 4 │ Fourth line", "? 6 │ Sixth line", "  1 │ # Title",
+			"3 open thread(s), 1 on the whole document"} {
+			if !strings.Contains(screen, want) {
+				t.Errorf("Screen doesn't contain %q:\n%s", want, screen)
+			}
+		}
+	})
+
+	t.Run("moving onto a thread shows it", func(t *testing.T) {
+		m := newTestTUI()
+		m.handleKey("j")
+		if m.selectedThread() != nil {
+			t.Fatal("Expected no thread on line 2")
+		}
+		m.handleKey("down")
+		if thread := m.selectedThread(); thread == nil || thread[0].ID != 1 {
+			t.Fatalf("Expected thread 1 on line 3, got %v", thread)
+		}
+		screen := ansiEscape.ReplaceAllString(m.render(), "")
+		for _, want := range []string{"Thread #1 · lines 3-4", "> Third", "User:", "  Fix this", "Agent:", "  Fixed"} {
+			if !strings.Contains(screen, want) {
+				t.Errorf("Screen doesn't contain %q:\n%s", want, screen)
+			}
+		}
+	})
+
+	t.Run("commenting on selected lines", func(t *testing.T) {
+		m := newTestTUI()
+		for _, key := range []string{"j", "v", "j", "j", "c", "N", "o", "p", "e", "backspace", "e", " "} {
+			if action := m.handleKey(key); action != nil {
+				t.Fatalf("Unexpected action %+v for %q", action, key)
+			}
+		}
+		if !strings.Contains(ansiEscape.ReplaceAllString(m.render(), ""), "Comment on lines 2-4: Nope") {
+			t.Errorf("Expected the message being written in the status line")
+		}
+
+		action := m.handleKey("enter")
+		want := &tuiAction{Kind: tuiComment, LineStart: 2, LineEnd: 4, Message: "Nope"}
+		if !reflect.DeepEqual(action, want) {
+			t.Errorf("handleKey(enter) = %+v, want %+v", action, want)
+		}
+		if m.input != nil || m.anchor != -1 {
+			t.Error("Expected the input and selection to be cleared")
+		}
+	})
+
+	t.Run("writing can be cancelled", func(t *testing.T) {
+		m := newTestTUI()
+		m.handleKey("C")
+		m.handleKey("x")
+		if action := m.handleKey("esc"); action != nil || m.input != nil {
+			t.Errorf("Expected esc to cancel the comment, got %+v", action)
+		}
+	})
+
+	t.Run("browsing threads", func(t *testing.T) {
+		m := newTestTUI()
+		var ids []int
+		for range 4 {
+			m.handleKey("n")
+			ids = append(ids, m.selectedThread()[0].ID)
+		}
+		if want := []int{4, 1, 3, 4}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("Threads in order %v, want %v", ids, want)
+		}
+		if screen := m.render(); !strings.Contains(screen, "Skipped by the agent") {
+			t.Errorf("Expected the agent's progress on the thread:\n%s", screen)
+		}
+
+		m.handleKey("N")
+		if m.selectedThread()[0].ID != 3 || m.cursor != 5 {
+			t.Errorf("Expected N to go back to thread 3 on line 6, got thread %d on line %d",
+				m.selectedThread()[0].ID, m.cursor+1)
+		}
+	})
+
+	t.Run("replying and resolving", func(t *testing.T) {
+		m := newTestTUI()
+		if m.handleKey("r"); m.input != nil || !strings.Contains(m.status, "No thread selected") {
+			t.Fatal("Expected replying without a thread to be refused")
+		}
+
+		m.handleKey("n")
+		m.handleKey("n")
+		m.handleKey("r")
+		m.handleKey("k")
+		action := m.handleKey("enter")
+		if want := (&tuiAction{Kind: tuiReply, ThreadID: 1, Message: "k"}); !reflect.DeepEqual(action, want) {
+			t.Errorf("Reply action = %+v, want %+v", action, want)
+		}
+
+		m.handleKey("x")
+		if action := m.handleKey("n"); action != nil {
+			t.Errorf("Expected resolving to wait for a yes, got %+v", action)
+		}
+		m.handleKey("x")
+		action = m.handleKey("y")
+		if want := (&tuiAction{Kind: tuiResolve, ThreadID: 1}); !reflect.DeepEqual(action, want) {
+			t.Errorf("Resolve action = %+v, want %+v", action, want)
+		}
+	})
+
+	t.Run("reloading keeps the thread on screen", func(t *testing.T) {
+		m := newTestTUI()
+		m.handleKey("n")
+		m.handleKey("n")
+		m.setData(m.lines, []Comment{m.threads[2][0], m.threads[1][0]}, nil)
+		if thread := m.selectedThread(); thread == nil || thread[0].ID != 1 {
+			t.Errorf("Expected thread 1 to stay selected, got %v", thread)
+		}
+	})
+}
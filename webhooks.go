@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxWebhookAttempts is how often a request is tried before it is given up on
+	maxWebhookAttempts = 15
+	// webhookRetryDelay is the wait after the first failed attempt, doubled after each further one
+	webhookRetryDelay = time.Second
+	// maxWebhookRetryDelay caps the wait between attempts
+	maxWebhookRetryDelay = time.Hour
+	// webhookTimeout limits each attempt
+	webhookTimeout = 10 * time.Second
+	// webhookBatchSize is how many due requests are read from the queue at a time
+	webhookBatchSize = 20
+)
+
+// Events sent to webhooks
+const (
+	webhookCommentCreated  = "comment_created"
+	webhookCommentReplied  = "comment_replied"
+	webhookThreadResolved  = "thread_resolved"
+	webhookVerdictRecorded = "verdict_recorded"
+)
+
+var webhookEvents = []string{
+	webhookCommentCreated,
+	webhookCommentReplied,
+	webhookThreadResolved,
+	webhookVerdictRecorded,
+}
+
+// WebhookConfig is a [[webhooks]] entry of a project's configuration
+type WebhookConfig struct {
+	URL    string   `toml:"url"`
+	Secret string   `toml:"secret"` // Signs the payloads when set
+	Events []string `toml:"events"` // Events to send, all of them when empty
+}
+
+func (w WebhookConfig) wants(event string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+// webhookPayload is the JSON body of a webhook request. Comment is the new comment for comment events and the root
+// of the thread for thread_resolved, which has no comment when all threads of the file were resolved at once.
+type webhookPayload struct {
+	Event            string    `json:"event"`
+	CreatedAt        time.Time `json:"created_at"`
+	ProjectDirectory string    `json:"project_directory"`
+	FilePath         string    `json:"file_path"`
+	Comment          *Comment  `json:"comment,omitempty"`
+	Verdict          *Verdict  `json:"verdict,omitempty"`
+}
+
+// webhookWake wakes up the delivery loop when requests are queued
+var webhookWake = make(chan struct{}, 1)
+
+// enqueueWebhooks queues requests to the project's webhooks for an SSE event, if it is one they are sent for
+func enqueueWebhooks(projectDir, filePath, event string, data interface{}) {
+	config, err := loadProjectConfig(projectDir)
+	if err != nil {
+		log.Printf("Not sending webhooks: %v", err)
+		return
+	}
+	if len(config.Webhooks) == 0 {
+		return
+	}
+	if err := config.checkCommandsAllowed(); err != nil {
+		log.Printf("Not sending webhooks: %v", err)
+		return
+	}
+
+	payloads, err := webhookPayloads(projectDir, filePath, event, data)
+	if err != nil {
+		log.Printf("Failed to build webhook payloads for %s: %v", event, err)
+		return
+	}
+
+	var deliveries []WebhookDelivery
+	for _, payload := range payloads {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("Failed to marshal webhook payload: %v", err)
+			return
+		}
+		for _, webhook := range config.Webhooks {
+			if !webhook.wants(payload.Event) {
+				continue
+			}
+			deliveries = append(deliveries, WebhookDelivery{
+				URL:       webhook.URL,
+				Event:     payload.Event,
+				Payload:   string(body),
+				Signature: signWebhookPayload(webhook.Secret, body),
+			})
+		}
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+
+	if err := enqueueWebhookDeliveries(deliveries); err != nil {
+		log.Printf("Failed to queue webhooks: %v", err)
+		return
+	}
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// webhookPayloads looks up what an SSE event is about and describes it as webhook payloads
+func webhookPayloads(projectDir, filePath, event string, data interface{}) ([]webhookPayload, error) {
+	newPayload := func(webhookEvent string) webhookPayload {
+		return webhookPayload{
+			Event:            webhookEvent,
+			CreatedAt:        time.Now(),
+			ProjectDirectory: projectDir,
+			FilePath:         filePath,
+		}
+	}
+	fields, _ := data.(map[string]interface{})
+
+	switch event {
+	case "review_submitted":
+		// Everything published with the review round
+		round, _ := fields["review_round"].(int)
+		comments, err := getComments(projectDir, filePath, false, false)
+		if err != nil {
+			return nil, err
+		}
+		var payloads []webhookPayload
+		for i := range comments {
+			if comments[i].ReviewRound == nil || *comments[i].ReviewRound != round {
+				continue
+			}
+			payload := newPayload(webhookCommentCreated)
+			if comments[i].RootID != nil {
+				payload.Event = webhookCommentReplied
+			}
+			payload.Comment = &comments[i]
+			payloads = append(payloads, payload)
+		}
+		return payloads, nil
+
+	case "comment_added":
+		commentID, _ := fields["comment_id"].(int)
+		comment, err := getCommentByID(commentID)
+		if err != nil || comment == nil {
+			return nil, err
+		}
+		payload := newPayload(webhookCommentCreated)
+		if comment.RootID != nil {
+			payload.Event = webhookCommentReplied
+		}
+		payload.Comment = comment
+		return []webhookPayload{payload}, nil
+
+	case "comments_resolved":
+		payload := newPayload(webhookThreadResolved)
+		if commentID, _ := fields["comment_id"].(int); commentID != 0 {
+			comment, err := getCommentByID(commentID)
+			if err != nil {
+				return nil, err
+			}
+			if comment != nil && comment.RootID != nil {
+				comment, err = getCommentByID(*comment.RootID)
+				if err != nil {
+					return nil, err
+				}
+			}
+			payload.Comment = comment
+		}
+		return []webhookPayload{payload}, nil
+
+	case "verdict_changed":
+		verdicts, err := getVerdicts(projectDir, filePath)
+		if err != nil || len(verdicts) == 0 {
+			return nil, err
+		}
+		payload := newPayload(webhookVerdictRecorded)
+		payload.Verdict = &verdicts[len(verdicts)-1]
+		return []webhookPayload{payload}, nil
+	}
+
+	return nil, nil
+}
+
+// signWebhookPayload returns the X-Claude-Review-Signature header for a payload: "sha256=" followed by the hex
+// HMAC-SHA256 of the body with the webhook's secret. Without a secret, payloads aren't signed.
+func signWebhookPayload(secret string, body []byte) string {
+	if secret == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// runWebhookDeliveries sends queued webhook requests until the server exits. Requests queued by an earlier server
+// are picked up on start.
+func runWebhookDeliveries() {
+	client := &http.Client{Timeout: webhookTimeout}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		for {
+			deliveries, err := getDueWebhookDeliveries(webhookBatchSize)
+			if err != nil {
+				log.Printf("Failed to read webhook queue: %v", err)
+				break
+			}
+			for _, d := range deliveries {
+				deliverWebhook(client, d)
+			}
+			if len(deliveries) < webhookBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-webhookWake:
+		}
+	}
+}
+
+// deliverWebhook makes one attempt to send a queued request, and removes it from the queue or schedules a retry
+func deliverWebhook(client *http.Client, d WebhookDelivery) {
+	err := postWebhook(client, d)
+	if err == nil {
+		if err := deleteWebhookDelivery(d.ID); err != nil {
+			log.Printf("Failed to remove delivered webhook %d from the queue: %v", d.ID, err)
+		}
+		return
+	}
+
+	attempts := d.Attempts + 1
+	if attempts >= maxWebhookAttempts {
+		log.Printf("Giving up on webhook %d (%s) to %s after %d attempts: %v", d.ID, d.Event, d.URL, attempts, err)
+		if err := recordWebhookFailure(d.ID, attempts, err.Error(), nil); err != nil {
+			log.Printf("Failed to update webhook %d: %v", d.ID, err)
+		}
+		return
+	}
+
+	delay := webhookRetryDelay << (attempts - 1)
+	if delay > maxWebhookRetryDelay {
+		delay = maxWebhookRetryDelay
+	}
+	retryAt := time.Now().Add(delay)
+	log.Printf("Webhook %d (%s) to %s failed, retrying in %s: %v", d.ID, d.Event, d.URL, delay, err)
+	if err := recordWebhookFailure(d.ID, attempts, err.Error(), &retryAt); err != nil {
+		log.Printf("Failed to update webhook %d: %v", d.ID, err)
+	}
+}
+
+func postWebhook(client *http.Client, d WebhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader([]byte(d.Payload)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "claude-review/"+Version)
+	req.Header.Set("X-Claude-Review-Event", d.Event)
+	req.Header.Set("X-Claude-Review-Delivery", strconv.Itoa(d.ID))
+	if d.Signature != "" {
+		req.Header.Set("X-Claude-Review-Signature", d.Signature)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("server returned status %d", resp.StatusCode)
+	}
+	return nil
+}